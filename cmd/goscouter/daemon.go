@@ -7,6 +7,8 @@ import (
 	"path/filepath"
 	"strconv"
 	"syscall"
+
+	"goscouter/internal/server"
 )
 
 const (
@@ -46,7 +48,21 @@ func startDaemon() error {
 	defer logFile.Close()
 
 	// Start process in background
-	cmd := exec.Command(execPath, "run", "--daemon")
+	args := []string{"run", "--daemon"}
+	for _, path := range server.ImportFiles {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		args = append(args, "--import", path)
+	}
+	if server.ScopeFile != "" {
+		path := server.ScopeFile
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+		args = append(args, "--scope", path)
+	}
+	cmd := exec.Command(execPath, args...)
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 	cmd.Stdin = nil
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 
 	"goscouter/internal/server"
 )
@@ -27,7 +28,26 @@ func main() {
 	command := args[0]
 	flags := args[1:]
 
-	for _, flag := range flags {
+	for i := 0; i < len(flags); i++ {
+		flag := flags[i]
+		if flag == "--import" && i+1 < len(flags) {
+			i++
+			server.ImportFiles = append(server.ImportFiles, flags[i])
+			continue
+		}
+		if strings.HasPrefix(flag, "--import=") {
+			server.ImportFiles = append(server.ImportFiles, strings.TrimPrefix(flag, "--import="))
+			continue
+		}
+		if flag == "--scope" && i+1 < len(flags) {
+			i++
+			server.ScopeFile = flags[i]
+			continue
+		}
+		if strings.HasPrefix(flag, "--scope=") {
+			server.ScopeFile = strings.TrimPrefix(flag, "--scope=")
+			continue
+		}
 		if flag == "--debug" || flag == "--verbose" || flag == "-v" {
 			debugMode = true
 			server.DebugMode = true
@@ -68,6 +88,26 @@ func main() {
 		}
 	case "build":
 		buildCommand()
+	case "scan":
+		if err := scanCommand(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "related":
+		if err := relatedCommand(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "ranges":
+		if err := rangesCommand(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case "psl":
+		if err := pslCommand(flags); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 	case "version", "-v", "--version":
 		printVersion()
 	case "help", "-h", "--help":
@@ -243,15 +283,53 @@ Commands:
   stop      Stop the running daemon
   status    Check if daemon is running
   build     Build the frontend and prepare for production
+  scan      Scan domains from the command line (scan -f domains.txt)
+  related   Find other apex domains of the same organization (related <domain> [--scan])
+  ranges    Find hostnames in IP ranges or ASNs (ranges 192.0.2.0/24 AS64500)
+  psl       Update the Public Suffix List (psl update [path])
   version   Show version information and check for updates
   help      Show this help message
 
 Flags:
   -d, --daemon              Run as background daemon
   --debug, --verbose        Enable debug mode (shows DNS lookup logs)
+  --import <file>           Load amass, subfinder, massdns, passive DNS, CSV or hostname-list output as a source (repeatable)
+  --scope <file>            Only resolve, probe and scan hosts allowed by a scope file (JSON, YAML or Burp export)
 
 Environment Variables:
   GOSCOUTER_SKIP_VERSION_CHECK=1    Disable automatic update checks
+  GOSCOUTER_ASN_DB=<path>           Resolve IP owners and expand ASNs from a local iptoasn TSV or MMDB file
+  GOSCOUTER_IPINFO_FALLBACK=1       Query ipinfo.io for IPs missing from the ASN database
+  GOSCOUTER_IPINFO_TOKEN=<token>    Authenticate ipinfo.io requests
+  GOSCOUTER_OWNER_PROVIDERS=<list>  IP owner lookup order, e.g. asndb,rdap,ipinfo
+  GOSCOUTER_CLOUD_RANGES=<dir>      Directory of cloud/CDN IP range JSON files
+  GOSCOUTER_INTEL_SOURCES=<list>    Keyed sources to query, e.g. virustotal,securitytrails,shodan,censys
+  GOSCOUTER_API_KEYS_FILE=<path>    JSON or YAML file with intel API keys
+  GOSCOUTER_VIRUSTOTAL_KEY=<key>    VirusTotal API key
+  GOSCOUTER_SECURITYTRAILS_KEY=<key> SecurityTrails API key
+  GOSCOUTER_SHODAN_KEY=<key>        Shodan API key
+  GOSCOUTER_CENSYS_API_ID=<id>      Censys API ID (with GOSCOUTER_CENSYS_API_SECRET)
+  GOSCOUTER_TLS_INSPECT=1           Handshake with resolved hosts and collect names from their certificates
+  GOSCOUTER_HTTP_PROBE=1            Request each resolved host's root page (sets alive, feeds CDN/WAF hints)
+  GOSCOUTER_FINGERPRINT=1           Probe hosts and detect technologies with the bundled rules
+  GOSCOUTER_FINGERPRINT_RULES=<path> JSON or YAML fingerprint rules used instead of the bundled ones
+  GOSCOUTER_PORT_SCAN=1             TCP connect scan resolved IPs (top 100 ports by default)
+  GOSCOUTER_PORTS=<list>            Ports to scan, e.g. 22,80,443,8000-8100
+  GOSCOUTER_PORT_SCAN_RATE=<n>      Connection attempts per second (default 500)
+  GOSCOUTER_PORT_SCAN_CONCURRENCY=<n> Simultaneous connection attempts (default 100)
+  GOSCOUTER_WEB_ARCHIVE=1           Harvest hostnames from Wayback Machine and Common Crawl URLs
+  GOSCOUTER_SCOPE=<path>            Scope file used when --scope is not given
+  GOSCOUTER_WHOIS_DATA=<path>       CSV or JSON-lines registration records for related-domain hints
+  GOSCOUTER_BATCH_CONCURRENCY=<n>   Domains scanned at once by batch scans (default 4)
+  GOSCOUTER_BATCH_WORKERS=<n>       Network workers shared by a batch's domains (default 50)
+  GOSCOUTER_PTR_RATE=<n>            Reverse lookups per second in range scans and PTR sweeps (default 100)
+  GOSCOUTER_PTR_SWEEP=1             Look up PTR records around every resolved IPv4 address
+  GOSCOUTER_PTR_SWEEP_PREFIX=<bits> Size of the swept network, 22 to 32 (default 24)
+  GOSCOUTER_REQUIRE_AUTHORIZATION=1 Run TLS inspection, probing and port scans only for verified domains
+  GOSCOUTER_AUTH_FILE=<path>        Authorization registry (default ~/.goscouter/authorizations.json)
+  GOSCOUTER_AUTH_AUDIT_LOG=<path>   Audit log (default ~/.goscouter/authorization_audit.log)
+  GOSCOUTER_ADMIN_TOKEN=<token>     Enables admin overrides and revocation via X-Admin-Token
+  GOSCOUTER_PSL=<path>              Public Suffix List file (default ~/.goscouter/public_suffix_list.dat if present)
 
 Examples:
   goscouter run              # Start in foreground on http://localhost:8080
@@ -261,6 +339,10 @@ Examples:
   goscouter status           # Check daemon status
   goscouter build            # Build the frontend (quiet mode)
   goscouter version          # Show version and check for updates
+  goscouter scan -f list.txt # Scan the domains in list.txt as one batch
+  goscouter related acme.com # Suggest sister domains (add --scan to scan them)
+  goscouter ranges AS64500   # Find hostnames in an ASN's networks (add --domain to filter)
+  goscouter psl update       # Refresh the Public Suffix List
 
 For more information, visit: https://github.com/nitayStain/goscouter`)
 }
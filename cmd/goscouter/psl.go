@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"goscouter/internal/server"
+	"goscouter/internal/subdomain"
+)
+
+// pslCommand handles "goscouter psl update [path]".
+func pslCommand(args []string) error {
+	if len(args) == 0 || args[0] != "update" {
+		return fmt.Errorf("usage: goscouter psl update [path]")
+	}
+	path := server.DefaultPublicSuffixListPath()
+	if len(args) > 1 && args[1] != "" && args[1][0] != '-' {
+		path = args[1]
+	}
+	if path == "" {
+		return fmt.Errorf("cannot determine home directory; pass a path")
+	}
+
+	fmt.Printf("📥 Downloading %s...\n", subdomain.PublicSuffixListURL)
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+	client := &http.Client{Timeout: 60 * time.Second}
+	data, err := subdomain.FetchPublicSuffixList(ctx, client, subdomain.PublicSuffixListURL)
+	if err != nil {
+		return fmt.Errorf("download public suffix list: %w", err)
+	}
+
+	// Write next to the target and rename so a running server never reads
+	// a partial file.
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".public_suffix_list-*.dat")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Saved public suffix list to %s\n", path)
+	if os.Getenv("GOSCOUTER_PSL") != "" && os.Getenv("GOSCOUTER_PSL") != path {
+		fmt.Println("Note: GOSCOUTER_PSL points elsewhere and takes precedence")
+	}
+	fmt.Println("Restart GoScouter to use it")
+	return nil
+}
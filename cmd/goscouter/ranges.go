@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+
+	"goscouter/internal/server"
+	"goscouter/internal/subdomain"
+)
+
+// rangesCommand handles "goscouter ranges <cidr|ASN>...". Hostnames found
+// through PTR records and TLS certificates are listed on stderr and the
+// result is written as JSON.
+func rangesCommand(args []string) error {
+	var (
+		outPath string
+		opts    subdomain.RangeOptions
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch {
+		case arg == "--domain":
+			var domain string
+			if domain, err = value(); err == nil {
+				opts.Domains = append(opts.Domains, strings.Split(domain, ",")...)
+			}
+		case arg == "-o" || arg == "--output":
+			outPath, err = value()
+		case arg == "--import" || arg == "--scope":
+			// Handled in main; skip the value.
+			i++
+		case strings.HasPrefix(arg, "-"):
+		case strings.HasPrefix(strings.ToUpper(arg), "AS"):
+			var asn uint32
+			if asn, err = subdomain.ParseASN(arg); err == nil {
+				opts.ASNs = append(opts.ASNs, asn)
+			}
+		default:
+			opts.CIDRs = append(opts.CIDRs, arg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(opts.CIDRs) == 0 && len(opts.ASNs) == 0 {
+		return fmt.Errorf("usage: goscouter ranges <cidr|ASN>... [--domain acme.com] [-o file]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := server.NewFinder().ScanRanges(ctx, opts)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(result.Subdomains))
+	for name := range result.Subdomains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data := result.Subdomains[name]
+		fmt.Fprintf(os.Stderr, "  %s  %s  (%s)\n", name, strings.Join(data.Addresses(), ", "), strings.Join(data.Sources, ", "))
+	}
+	if result.ActiveSkipped != "" {
+		fmt.Fprintf(os.Stderr, "TLS handshakes skipped: %s\n", result.ActiveSkipped)
+	}
+	fmt.Fprintf(os.Stderr, "%d hostnames from %d addresses in %d networks\n", len(names), result.Addresses, len(result.Prefixes))
+	return writeJSON(result, outPath)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"goscouter/internal/server"
+	"goscouter/internal/subdomain"
+)
+
+// relatedCommand handles "goscouter related <domain>". Candidates are
+// listed on stderr and written as JSON; with --scan the domain and the
+// candidates at or above --min-confidence are batch scanned instead.
+func relatedCommand(args []string) error {
+	var (
+		domain        string
+		outPath       string
+		minConfidence = 0.5
+		promote       bool
+		opts          subdomain.PivotOptions
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch {
+		case arg == "--seed":
+			var seed string
+			if seed, err = value(); err == nil {
+				opts.Seeds = append(opts.Seeds, strings.Split(seed, ",")...)
+			}
+		case arg == "--min-confidence":
+			var n string
+			if n, err = value(); err == nil {
+				minConfidence, err = strconv.ParseFloat(n, 64)
+			}
+		case arg == "-o" || arg == "--output":
+			outPath, err = value()
+		case arg == "--scan":
+			promote = true
+		case arg == "--import" || arg == "--scope":
+			// Handled in main; skip the value.
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			domain = arg
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if domain == "" {
+		return fmt.Errorf("usage: goscouter related <domain> [--seed a.com,b.com] [--min-confidence 0.5] [--scan] [-o file]")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	finder := server.NewFinder()
+	fmt.Fprintf(os.Stderr, "🔎 Looking for domains related to %s...\n", domain)
+	result, err := finder.FindRelated(ctx, domain, opts)
+	if err != nil {
+		return err
+	}
+	for _, status := range result.Sources {
+		switch {
+		case status.Skipped:
+			fmt.Fprintf(os.Stderr, "  %s skipped: %s\n", status.Source, status.SkipReason)
+		case !status.OK:
+			fmt.Fprintf(os.Stderr, "  %s failed: %s\n", status.Source, status.Error)
+		}
+	}
+
+	promoted := []string{result.Domain}
+	for _, candidate := range result.Candidates {
+		if candidate.Confidence < minConfidence {
+			continue
+		}
+		promoted = append(promoted, candidate.Domain)
+		kinds := make([]string, 0, len(candidate.Evidence))
+		for _, ev := range candidate.Evidence {
+			kinds = append(kinds, ev.Kind)
+		}
+		fmt.Fprintf(os.Stderr, "  %.2f  %s  (%s)\n", candidate.Confidence, candidate.Domain, strings.Join(kinds, ", "))
+	}
+	fmt.Fprintf(os.Stderr, "%d of %d candidates at or above %.2f\n", len(promoted)-1, len(result.Candidates), minConfidence)
+
+	if !promote {
+		return writeJSON(result, outPath)
+	}
+	if len(promoted) == 1 {
+		return fmt.Errorf("no candidates to scan")
+	}
+	return runBatch(ctx, finder, promoted, subdomain.BatchOptions{}, outPath)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+
+	"goscouter/internal/server"
+	"goscouter/internal/subdomain"
+)
+
+type batchOutput struct {
+	Partial bool                      `json:"partial"`
+	Domains []subdomain.DomainSummary `json:"domains"`
+	Count   int                       `json:"count"`
+	Items   []subdomain.BatchItem     `json:"items"`
+}
+
+// scanCommand handles "goscouter scan [-f file] [domain...]". Progress goes
+// to stderr and the combined JSON result to stdout or the -o file.
+func scanCommand(args []string) error {
+	var (
+		listPath    string
+		outPath     string
+		concurrency int
+		workers     int
+		domains     []string
+		opts        subdomain.ScanOptions
+	)
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s needs a value", arg)
+			}
+			i++
+			return args[i], nil
+		}
+		var err error
+		switch {
+		case arg == "-f" || arg == "--file":
+			listPath, err = value()
+		case arg == "-o" || arg == "--output":
+			outPath, err = value()
+		case arg == "-c" || arg == "--concurrency":
+			var n string
+			if n, err = value(); err == nil {
+				concurrency, err = strconv.Atoi(n)
+			}
+		case arg == "-w" || arg == "--workers":
+			var n string
+			if n, err = value(); err == nil {
+				workers, err = strconv.Atoi(n)
+			}
+		case arg == "--force":
+			opts.AllowPublicSuffix = true
+		case arg == "--import" || arg == "--scope":
+			// Handled in main; skip the value.
+			i++
+		case strings.HasPrefix(arg, "-"):
+			// Global flags such as --debug.
+		default:
+			domains = append(domains, arg)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if listPath != "" {
+		var r io.Reader = os.Stdin
+		if listPath != "-" {
+			file, err := os.Open(listPath)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			r = file
+		}
+		listed, err := subdomain.ReadDomainList(r)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", listPath, err)
+		}
+		domains = append(domains, listed...)
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("usage: goscouter scan -f domains.txt [-c concurrency] [-w workers] [-o result.json] [--force]")
+	}
+	if len(domains) > subdomain.MaxBatchDomains {
+		return fmt.Errorf("too many domains; the limit is %d", subdomain.MaxBatchDomains)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	return runBatch(ctx, server.NewFinder(), domains, subdomain.BatchOptions{ScanOptions: opts, Concurrency: concurrency, Workers: workers}, outPath)
+}
+
+// runBatch scans domains, reporting progress on stderr, and writes the
+// combined result as JSON.
+func runBatch(ctx context.Context, finder *subdomain.Finder, domains []string, opts subdomain.BatchOptions, outPath string) error {
+	var mu sync.Mutex
+	done := 0
+	fmt.Fprintf(os.Stderr, "🔎 Scanning %d domains...\n", len(domains))
+	opts.Progress = func(summary subdomain.DomainSummary) {
+		mu.Lock()
+		defer mu.Unlock()
+		done++
+		if summary.OK {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d subdomains, %d alive (%dms)\n",
+				done, len(domains), summary.Domain, summary.Count, summary.Alive, summary.DurationMS)
+		} else {
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %s\n", done, len(domains), summary.Domain, strings.ReplaceAll(summary.Error, "\n", "; "))
+		}
+	}
+	result := finder.ScanBatch(ctx, domains, opts)
+
+	items := result.Combined()
+	out := batchOutput{Partial: result.Partial, Domains: result.Summaries, Count: len(items), Items: items}
+	if err := writeJSON(out, outPath); err != nil {
+		return err
+	}
+	if outPath != "" {
+		fmt.Fprintf(os.Stderr, "✅ %d subdomains across %d domains written to %s\n", len(items), len(domains), outPath)
+	}
+	return nil
+}
+
+// writeJSON prints v as indented JSON to stdout, or writes it to path.
+func writeJSON(v any, path string) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+type authorizationResponse struct {
+	subdomain.Authorization
+	TXTName      string `json:"txt_name"`
+	TXTValue     string `json:"txt_value"`
+	WellKnownURL string `json:"well_known_url"`
+}
+
+type authorizationListResponse struct {
+	Count          int                     `json:"count"`
+	Authorizations []authorizationResponse `json:"authorizations"`
+}
+
+type auditResponse struct {
+	Count   int                    `json:"count"`
+	Entries []subdomain.AuditEntry `json:"entries"`
+}
+
+func newAuthorizationResponse(a subdomain.Authorization) authorizationResponse {
+	name, value := a.TXTRecord()
+	return authorizationResponse{Authorization: a, TXTName: name, TXTValue: value, WellKnownURL: a.WellKnownURL()}
+}
+
+// requireAdmin checks the X-Admin-Token header and returns the actor named
+// by X-Admin-Actor. It writes the error response itself.
+func requireAdmin(c *gin.Context, adminToken string) (string, bool) {
+	if adminToken == "" {
+		c.JSON(http.StatusForbidden, errorResponse{Error: "admin actions are disabled; set GOSCOUTER_ADMIN_TOKEN"})
+		return "", false
+	}
+	token := c.GetHeader("X-Admin-Token")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		c.JSON(http.StatusForbidden, errorResponse{Error: "invalid admin token"})
+		return "", false
+	}
+	actor := strings.TrimSpace(c.GetHeader("X-Admin-Actor"))
+	if actor == "" {
+		actor = "admin"
+	}
+	return actor, true
+}
+
+// authorizationChallengeHandler issues (or repeats) the token a domain must
+// publish to prove ownership.
+func authorizationChallengeHandler(registry *subdomain.AuthRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := strings.TrimSpace(c.DefaultQuery("domain", c.PostForm("domain")))
+		if domain == "" {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "domain is required"})
+			return
+		}
+		a, err := registry.Challenge(domain)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, subdomain.ErrInvalidDomain) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, errorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newAuthorizationResponse(a))
+	}
+}
+
+func authorizationVerifyHandler(finder *subdomain.Finder, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.DefaultQuery("method", subdomain.VerifyDNS)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		a, err := finder.VerifyDomain(ctx, c.Param("domain"), method)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, subdomain.ErrVerificationFailed) {
+				status = http.StatusUnprocessableEntity
+			}
+			c.JSON(status, errorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, newAuthorizationResponse(a))
+	}
+}
+
+func authorizationListHandler(registry *subdomain.AuthRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		list := registry.List()
+		out := make([]authorizationResponse, 0, len(list))
+		for _, a := range list {
+			out = append(out, newAuthorizationResponse(a))
+		}
+		c.JSON(http.StatusOK, authorizationListResponse{Count: len(out), Authorizations: out})
+	}
+}
+
+func authorizationRevokeHandler(registry *subdomain.AuthRegistry, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor, ok := requireAdmin(c, adminToken)
+		if !ok {
+			return
+		}
+		found, err := registry.Revoke(c.Param("domain"), actor)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse{Error: err.Error()})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, errorResponse{Error: "authorization not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
+
+func authorizationAuditHandler(registry *subdomain.AuthRegistry, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := requireAdmin(c, adminToken); !ok {
+			return
+		}
+		entries := registry.Audit()
+		c.JSON(http.StatusOK, auditResponse{Count: len(entries), Entries: entries})
+	}
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+func certificateHistoryHandler(finder *subdomain.Finder, timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		host := strings.TrimSpace(c.Query("host"))
+		if host == "" {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "host query parameter is required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		history, err := finder.CertificateHistory(ctx, host)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, subdomain.ErrInvalidDomain) {
+				status = http.StatusBadRequest
+			} else if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			c.JSON(status, errorResponse{Error: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, history)
+	}
+}
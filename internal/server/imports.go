@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+// maxImportSize caps a single dataset upload.
+const maxImportSize = 64 << 20
+
+type importListResponse struct {
+	Count    int                  `json:"count"`
+	Datasets []*subdomain.Dataset `json:"datasets"`
+}
+
+// importUploadHandler accepts a dataset either as a multipart "file" field
+// or as the raw request body. Uploads feed every scan on the server, so
+// they need the admin token. The format comes from the format parameter,
+// or a multipart "format" field, and is detected when omitted. Form fields
+// are only read for multipart requests, since parsing a urlencoded form
+// would consume a raw body.
+func importUploadHandler(store *subdomain.DatasetStore, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := requireAdmin(c, adminToken); !ok {
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+		format := c.Query("format")
+		label := strings.TrimSpace(c.Query("label"))
+
+		var body io.Reader = c.Request.Body
+		if c.ContentType() == "multipart/form-data" {
+			if format == "" {
+				format = c.PostForm("format")
+			}
+			header, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: "file form field is required"})
+				return
+			}
+			file, err := header.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+				return
+			}
+			defer file.Close()
+			body = file
+			if label == "" {
+				label = filepath.Base(header.Filename)
+			}
+		}
+		if label == "" {
+			label = "upload"
+		}
+
+		ds, err := subdomain.ParseDataset(body, format, label)
+		if err != nil {
+			status := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, errorResponse{Error: err.Error()})
+			return
+		}
+		if _, err := store.Add(ds); err != nil {
+			c.JSON(http.StatusConflict, errorResponse{Error: err.Error() + "; delete a dataset first"})
+			return
+		}
+		c.JSON(http.StatusCreated, ds)
+	}
+}
+
+func importListHandler(store *subdomain.DatasetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		datasets := store.List()
+		c.JSON(http.StatusOK, importListResponse{Count: len(datasets), Datasets: datasets})
+	}
+}
+
+func importDeleteHandler(store *subdomain.DatasetStore, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := requireAdmin(c, adminToken); !ok {
+			return
+		}
+		if !store.Remove(c.Param("id")) {
+			c.JSON(http.StatusNotFound, errorResponse{Error: "dataset not found"})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+type rangeScanResponse struct {
+	Prefixes      []string              `json:"prefixes"`
+	Addresses     int                   `json:"addresses"`
+	OutOfScope    int                   `json:"out_of_scope,omitempty"`
+	Partial       bool                  `json:"partial"`
+	Count         int                   `json:"count"`
+	Items         []subdomain.Subdomain `json:"items"`
+	Excluded      []subdomain.Exclusion `json:"excluded,omitempty"`
+	ActiveSkipped string                `json:"active_skipped,omitempty"`
+}
+
+// maxAPIRangeAddresses caps range scans started through the API, a /22
+// worth; larger sweeps belong on the command line.
+const maxAPIRangeAddresses = 1024
+
+// rangeScanHandler finds hostnames in the networks given as cidr and asn
+// parameters. A sweep sends thousands of lookups and handshakes for one
+// request, so it needs the admin token. Results are filtered like
+// /api/subdomains; a scan cut short by the timeout returns what it found
+// as partial.
+func rangeScanHandler(finder *subdomain.Finder, timeout time.Duration, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := requireAdmin(c, adminToken); !ok {
+			return
+		}
+		opts := subdomain.RangeOptions{
+			CIDRs:        queryList(c, "cidr"),
+			Domains:      queryList(c, "domain"),
+			MaxAddresses: maxAPIRangeAddresses,
+		}
+		for _, value := range queryList(c, "asn") {
+			asn, err := subdomain.ParseASN(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+				return
+			}
+			opts.ASNs = append(opts.ASNs, asn)
+		}
+		if len(opts.CIDRs) == 0 && len(opts.ASNs) == 0 {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "cidr or asn query parameter is required"})
+			return
+		}
+		filter, err := parseResultFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		scanOpts, ok := parseScanOptions(c, adminToken)
+		if !ok {
+			return
+		}
+		opts.Override = scanOpts.Override
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		// Every error from ScanRanges is about the request itself.
+		result, err := finder.ScanRanges(ctx, opts)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		items := make([]subdomain.Subdomain, 0, len(result.Subdomains))
+		for _, item := range result.Subdomains {
+			if filter.Match(item) {
+				items = append(items, item)
+			}
+		}
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Name < items[j].Name
+		})
+		c.JSON(http.StatusOK, rangeScanResponse{
+			Prefixes:      result.Prefixes,
+			Addresses:     result.Addresses,
+			OutOfScope:    result.OutOfScope,
+			Partial:       result.Partial,
+			Count:         len(items),
+			Items:         items,
+			Excluded:      result.Excluded,
+			ActiveSkipped: result.ActiveSkipped,
+		})
+	}
+}
+
+// queryList reads a query parameter that may be repeated or comma
+// separated.
+func queryList(c *gin.Context, key string) []string {
+	var out []string
+	for _, value := range c.QueryArray(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				out = append(out, item)
+			}
+		}
+	}
+	return out
+}
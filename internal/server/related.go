@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+type promoteRequest struct {
+	Domain     string   `json:"domain"`
+	Candidates []string `json:"candidates"`
+}
+
+// relatedHandler proposes other apexes of the organization behind domain.
+// Earlier findings can be passed as repeated or comma separated seed
+// parameters.
+func relatedHandler(finder *subdomain.Finder, timeout time.Duration, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		domain := strings.TrimSpace(c.Query("domain"))
+		if domain == "" {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "domain query parameter is required"})
+			return
+		}
+		scanOpts, ok := parseScanOptions(c, adminToken)
+		if !ok {
+			return
+		}
+		opts := subdomain.PivotOptions{Override: scanOpts.Override}
+		opts.Seeds = queryList(c, "seed")
+		minConfidence := 0.0
+		if value := c.Query("min_confidence"); value != "" {
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil || n < 0 || n > 1 {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: "min_confidence must be a number between 0 and 1"})
+				return
+			}
+			minConfidence = n
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		result, err := finder.FindRelated(ctx, domain, opts)
+		if err != nil {
+			status := http.StatusBadGateway
+			if errors.Is(err, subdomain.ErrInvalidDomain) || errors.Is(err, subdomain.ErrPublicSuffix) {
+				status = http.StatusBadRequest
+			}
+			c.JSON(status, errorResponse{Error: err.Error()})
+			return
+		}
+		kept := result.Candidates[:0]
+		for _, candidate := range result.Candidates {
+			if candidate.Confidence >= minConfidence {
+				kept = append(kept, candidate)
+			}
+		}
+		result.Candidates = kept
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// relatedPromoteHandler starts a batch scan of domain together with the
+// chosen candidates.
+func relatedPromoteHandler(store *scanStore, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req promoteRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "body must be JSON with domain and candidates"})
+			return
+		}
+		if strings.TrimSpace(req.Domain) == "" || len(req.Candidates) == 0 {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "domain and at least one candidate are required"})
+			return
+		}
+		domains, _ := subdomain.ReadDomainList(strings.NewReader(req.Domain + "\n" + strings.Join(req.Candidates, "\n")))
+		if len(domains) > subdomain.MaxBatchDomains {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "too many domains; the limit is " + strconv.Itoa(subdomain.MaxBatchDomains)})
+			return
+		}
+		opts, ok := parseScanOptions(c, adminToken)
+		if !ok {
+			return
+		}
+		job, err := store.start(domains, 0, opts)
+		if err != nil {
+			c.JSON(http.StatusTooManyRequests, errorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
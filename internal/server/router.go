@@ -2,9 +2,12 @@ package server
 
 import (
 	"io"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,6 +18,13 @@ import (
 
 var DebugMode bool
 
+// ImportFiles are datasets loaded into the import source at startup.
+var ImportFiles []string
+
+// ScopeFile restricts active steps to a scope definition; GOSCOUTER_SCOPE
+// is used when it is empty.
+var ScopeFile string
+
 // setupRouter wires routes for the HTTP server.
 func setupRouter() *gin.Engine {
 	// Set to release mode and disable console color
@@ -35,27 +45,36 @@ func setupRouter() *gin.Engine {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:8080"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "X-Admin-Token", "X-Admin-Actor"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
-	// Create subdomain finder with debug mode if enabled
-	finderOpts := []subdomain.FinderOption{
-		subdomain.WithUserAgent("goscouter-backend/1.0"),
-		subdomain.WithHTTPClient(&http.Client{Timeout: 20 * time.Second}),
-	}
-
-	if DebugMode {
-		finderOpts = append(finderOpts, subdomain.WithDebug(true))
-	}
-
-	finder := subdomain.NewFinder(finderOpts...)
+	env := newScanEnv()
+	finder, datasets, registry, adminToken := env.finder, env.datasets, env.registry, env.adminToken
 
 	// API routes
 	api := r.Group("/api")
-	api.GET("/subdomains", subdomainScanHandler(finder, 30*time.Second))
+	api.GET("/subdomains", subdomainScanHandler(finder, 30*time.Second, adminToken))
+	api.GET("/certificates", certificateHistoryHandler(finder, 30*time.Second))
+	scans := newScanStore(finder, batchConcurrency(), batchWorkers(), 30*time.Second)
+	api.GET("/scans", scanListHandler(scans))
+	api.POST("/scans", scanStartHandler(scans, adminToken))
+	api.GET("/scans/:id", scanGetHandler(scans))
+	api.GET("/related", relatedHandler(finder, 60*time.Second, adminToken))
+	api.POST("/related/promote", relatedPromoteHandler(scans, adminToken))
+	api.GET("/ranges", rangeScanHandler(finder, 2*time.Minute, adminToken))
+	api.GET("/imports", importListHandler(datasets))
+	api.POST("/imports", importUploadHandler(datasets, adminToken))
+	api.DELETE("/imports/:id", importDeleteHandler(datasets, adminToken))
+	if registry != nil {
+		api.GET("/authorizations", authorizationListHandler(registry))
+		api.POST("/authorizations", authorizationChallengeHandler(registry))
+		api.POST("/authorizations/:domain/verify", authorizationVerifyHandler(finder, 30*time.Second))
+		api.DELETE("/authorizations/:domain", authorizationRevokeHandler(registry, adminToken))
+		api.GET("/authorizations/audit", authorizationAuditHandler(registry, adminToken))
+	}
 
 	// Get frontend path from environment or use default
 	frontendPath := os.Getenv("GOSCOUTER_FRONTEND_PATH")
@@ -84,3 +103,309 @@ func setupRouter() *gin.Engine {
 
 	return r
 }
+
+// scanEnv is a Finder configured from the flags and environment, with the
+// stores the API exposes next to it.
+type scanEnv struct {
+	finder     *subdomain.Finder
+	datasets   *subdomain.DatasetStore
+	registry   *subdomain.AuthRegistry
+	adminToken string
+}
+
+// NewFinder returns a Finder configured the way the server's is, for
+// command-line scans.
+func NewFinder() *subdomain.Finder {
+	return newScanEnv().finder
+}
+
+func newScanEnv() *scanEnv {
+	// Create subdomain finder with debug mode if enabled
+	finderOpts := []subdomain.FinderOption{
+		subdomain.WithUserAgent("goscouter-backend/1.0"),
+		subdomain.WithHTTPClient(&http.Client{Timeout: 20 * time.Second}),
+		subdomain.WithDNSRecordMining(true),
+		subdomain.WithSRVDiscovery(true),
+	}
+
+	if DebugMode {
+		finderOpts = append(finderOpts, subdomain.WithDebug(true))
+	}
+
+	// TLS handshakes with resolved hosts to harvest certificate names
+	if os.Getenv("GOSCOUTER_TLS_INSPECT") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithTLSInspection(true))
+	}
+
+	// HTTP probing of resolved hosts, and technology fingerprinting of the
+	// responses with the bundled or a custom rules file
+	if os.Getenv("GOSCOUTER_HTTP_PROBE") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithHTTPProbe(true))
+	}
+	if rulesPath := os.Getenv("GOSCOUTER_FINGERPRINT_RULES"); rulesPath != "" {
+		db, err := subdomain.LoadFingerprintRules(rulesPath)
+		if err != nil {
+			log.Printf("Failed to load fingerprint rules from %s: %v", rulesPath, err)
+		} else {
+			finderOpts = append(finderOpts, subdomain.WithFingerprinting(db))
+		}
+	} else if os.Getenv("GOSCOUTER_FINGERPRINT") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithFingerprinting(nil))
+	}
+
+	// TCP connect scanning of resolved IPs, optionally with a custom port list
+	if os.Getenv("GOSCOUTER_PORT_SCAN") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithPortScan(true))
+		if spec := os.Getenv("GOSCOUTER_PORTS"); spec != "" {
+			ports, err := subdomain.ParsePorts(spec)
+			if err != nil {
+				log.Printf("Invalid GOSCOUTER_PORTS %q: %v", spec, err)
+			} else {
+				finderOpts = append(finderOpts, subdomain.WithScanPorts(ports))
+			}
+		}
+		if rate, err := strconv.Atoi(os.Getenv("GOSCOUTER_PORT_SCAN_RATE")); err == nil {
+			finderOpts = append(finderOpts, subdomain.WithPortScanRate(rate))
+		}
+		if n, err := strconv.Atoi(os.Getenv("GOSCOUTER_PORT_SCAN_CONCURRENCY")); err == nil {
+			finderOpts = append(finderOpts, subdomain.WithPortScanConcurrency(n))
+		}
+	}
+
+	// A local ASN dataset answers IP owners and expands ASNs in range scans
+	asnDB := asnDatabaseFromEnv()
+	if asnDB != nil {
+		finderOpts = append(finderOpts, subdomain.WithASNDatabase(asnDB))
+	}
+
+	// Reverse lookups per second during range scans and PTR sweeps
+	if rate, err := strconv.Atoi(os.Getenv("GOSCOUTER_PTR_RATE")); err == nil && rate > 0 {
+		finderOpts = append(finderOpts, subdomain.WithPTRRate(rate))
+	}
+
+	// Sweep PTR records around every resolved address
+	if os.Getenv("GOSCOUTER_PTR_SWEEP") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithPTRSweep(true))
+		if bits, err := strconv.Atoi(os.Getenv("GOSCOUTER_PTR_SWEEP_PREFIX")); err == nil {
+			finderOpts = append(finderOpts, subdomain.WithPTRSweepPrefix(bits))
+		}
+	}
+
+	// Configure IP owner providers from the environment
+	if providers := ownerProvidersFromEnv(asnDB); len(providers) > 0 {
+		finderOpts = append(finderOpts, subdomain.WithOwnerProviders(providers...))
+	}
+
+	// Classify hosting providers from local range files when configured; a
+	// bad file is skipped without losing the others
+	if rangesDir := os.Getenv("GOSCOUTER_CLOUD_RANGES"); rangesDir != "" {
+		classifier := subdomain.NewCloudClassifier()
+		if err := classifier.LoadDir(rangesDir); err != nil {
+			log.Printf("Failed to load some cloud ranges from %s: %v", rangesDir, err)
+		}
+		finderOpts = append(finderOpts, subdomain.WithCloudClassifier(classifier))
+	}
+
+	// Opt-in keyed intel sources; keys come from a file and/or the environment
+	if names := os.Getenv("GOSCOUTER_INTEL_SOURCES"); names != "" {
+		keys := subdomain.APIKeys{}
+		if keysPath := os.Getenv("GOSCOUTER_API_KEYS_FILE"); keysPath != "" {
+			fileKeys, err := subdomain.LoadAPIKeys(keysPath)
+			if err != nil {
+				log.Printf("Failed to load API keys from %s: %v", keysPath, err)
+			} else {
+				keys = fileKeys
+			}
+		}
+		finderOpts = append(finderOpts,
+			subdomain.WithAPIKeys(keys.Merge(subdomain.APIKeysFromEnv())),
+			subdomain.WithIntelSources(strings.Split(names, ",")...),
+		)
+	}
+
+	// Historical URLs from the Wayback Machine and Common Crawl
+	if os.Getenv("GOSCOUTER_WEB_ARCHIVE") == "1" {
+		finderOpts = append(finderOpts, subdomain.WithWebArchives(true))
+	}
+
+	// Imported datasets from the command line; more can be uploaded later
+	datasets := subdomain.NewDatasetStore()
+	for _, path := range ImportFiles {
+		ds, err := subdomain.LoadDataset(path, subdomain.FormatAuto)
+		if err != nil {
+			log.Printf("Failed to import %s: %v", path, err)
+			continue
+		}
+		if _, err := datasets.Add(ds); err != nil {
+			log.Printf("Failed to import %s: %v", path, err)
+			continue
+		}
+		log.Printf("Imported %d names from %s (%s)", ds.Count, path, ds.Format)
+	}
+	finderOpts = append(finderOpts, subdomain.WithDatasets(datasets))
+
+	// Local registration data for related-domain pivoting
+	if whoisPath := os.Getenv("GOSCOUTER_WHOIS_DATA"); whoisPath != "" {
+		data, err := subdomain.LoadWhoisData(whoisPath)
+		if err != nil {
+			log.Printf("Failed to load WHOIS data from %s: %v", whoisPath, err)
+		} else {
+			finderOpts = append(finderOpts, subdomain.WithWhoisData(data))
+			log.Printf("Loaded WHOIS records for %d domains", data.Len())
+		}
+	}
+
+	// A refreshed Public Suffix List replaces the embedded copy
+	if pslPath := PublicSuffixListPath(); pslPath != "" {
+		if list, err := subdomain.LoadPublicSuffixList(pslPath); err != nil {
+			log.Printf("Failed to load public suffix list %s: %v", pslPath, err)
+		} else {
+			finderOpts = append(finderOpts, subdomain.WithPublicSuffixList(list))
+		}
+	}
+
+	// Scope rules for bug bounty and pentest targets. Scanning without the
+	// intended scope is unsafe, so a bad file stops startup.
+	scopePath := ScopeFile
+	if scopePath == "" {
+		scopePath = os.Getenv("GOSCOUTER_SCOPE")
+	}
+	if scopePath != "" {
+		scope, err := subdomain.LoadScope(scopePath)
+		if err != nil {
+			log.Fatalf("Failed to load scope from %s: %v", scopePath, err)
+		}
+		finderOpts = append(finderOpts, subdomain.WithScope(scope))
+		log.Printf("Loaded scope from %s", scopePath)
+	}
+
+	// Active steps only for verified domains on shared servers
+	var registry *subdomain.AuthRegistry
+	if os.Getenv("GOSCOUTER_REQUIRE_AUTHORIZATION") == "1" {
+		reg, err := subdomain.NewAuthRegistry(stateFile("GOSCOUTER_AUTH_FILE", "authorizations.json"), stateFile("GOSCOUTER_AUTH_AUDIT_LOG", "authorization_audit.log"))
+		if err != nil {
+			log.Fatalf("Failed to load authorization registry: %v", err)
+		}
+		registry = reg
+		finderOpts = append(finderOpts, subdomain.WithAuthorization(registry))
+	}
+	adminToken := os.Getenv("GOSCOUTER_ADMIN_TOKEN")
+
+	return &scanEnv{
+		finder:     subdomain.NewFinder(finderOpts...),
+		datasets:   datasets,
+		registry:   registry,
+		adminToken: adminToken,
+	}
+}
+
+// PublicSuffixListPath returns the list file set by GOSCOUTER_PSL, or the
+// one written by "goscouter psl update" when it exists.
+func PublicSuffixListPath() string {
+	if path := os.Getenv("GOSCOUTER_PSL"); path != "" {
+		return path
+	}
+	path := DefaultPublicSuffixListPath()
+	if path == "" {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// batchConcurrency is how many domains batch scans run at once, from
+// GOSCOUTER_BATCH_CONCURRENCY.
+func batchConcurrency() int {
+	if n, err := strconv.Atoi(os.Getenv("GOSCOUTER_BATCH_CONCURRENCY")); err == nil && n > 0 {
+		return n
+	}
+	return 4
+}
+
+// batchWorkers is how many network workers a batch shares across its
+// domains, from GOSCOUTER_BATCH_WORKERS; zero keeps the default.
+func batchWorkers() int {
+	if n, err := strconv.Atoi(os.Getenv("GOSCOUTER_BATCH_WORKERS")); err == nil && n > 0 {
+		return n
+	}
+	return 0
+}
+
+// stateFile returns the path set in env, or name under ~/.goscouter.
+func stateFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goscouter", name)
+}
+
+// DefaultPublicSuffixListPath is where "goscouter psl update" saves the list.
+func DefaultPublicSuffixListPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".goscouter", "public_suffix_list.dat")
+}
+
+// asnDatabaseFromEnv opens the ASN database at GOSCOUTER_ASN_DB, if set.
+func asnDatabaseFromEnv() subdomain.ASNDatabase {
+	asnPath := os.Getenv("GOSCOUTER_ASN_DB")
+	if asnPath == "" {
+		return nil
+	}
+	db, err := subdomain.OpenASNDatabase(asnPath)
+	if err != nil {
+		log.Printf("Failed to load ASN database %s: %v", asnPath, err)
+		return nil
+	}
+	return db
+}
+
+// ownerProvidersFromEnv builds the IP owner provider chain. The order comes
+// from GOSCOUTER_OWNER_PROVIDERS (e.g. "asndb,rdap,ipinfo"); without it a
+// configured ASN database is used with ipinfo.io as an optional fallback.
+func ownerProvidersFromEnv(asnDB subdomain.ASNDatabase) []subdomain.OwnerProvider {
+	client := &http.Client{Timeout: 10 * time.Second}
+	ipinfo := &subdomain.IPInfoProvider{
+		Client:    client,
+		Token:     os.Getenv("GOSCOUTER_IPINFO_TOKEN"),
+		UserAgent: "goscouter-backend/1.0",
+	}
+
+	order := os.Getenv("GOSCOUTER_OWNER_PROVIDERS")
+	if order == "" {
+		if asnDB == nil {
+			return []subdomain.OwnerProvider{ipinfo}
+		}
+		providers := []subdomain.OwnerProvider{&subdomain.ASNDatabaseProvider{DB: asnDB}}
+		if os.Getenv("GOSCOUTER_IPINFO_FALLBACK") == "1" {
+			providers = append(providers, ipinfo)
+		}
+		return providers
+	}
+
+	var providers []subdomain.OwnerProvider
+	for _, name := range strings.Split(order, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "asndb":
+			if asnDB != nil {
+				providers = append(providers, &subdomain.ASNDatabaseProvider{DB: asnDB})
+			}
+		case "rdap":
+			providers = append(providers, &subdomain.RDAPProvider{Client: client, UserAgent: "goscouter-backend/1.0"})
+		case "ipinfo":
+			providers = append(providers, ipinfo)
+		case "":
+		default:
+			log.Printf("Unknown IP owner provider %q", name)
+		}
+	}
+	return providers
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"goscouter/internal/subdomain"
+)
+
+// Batch job states.
+const (
+	scanQueued  = "queued"
+	scanRunning = "running"
+	scanDone    = "done"
+)
+
+// maxStoredScans is how many batch jobs are kept; the oldest finished ones
+// are dropped first.
+const maxStoredScans = 20
+
+// maxQueuedScans is how many batch jobs may be queued or running at once.
+const maxQueuedScans = 5
+
+// errScanQueueFull rejects a batch while maxQueuedScans jobs are pending.
+var errScanQueueFull = errors.New("too many batch scans queued; try again later")
+
+type scanRequest struct {
+	Domains     []string `json:"domains"`
+	Concurrency int      `json:"concurrency"`
+}
+
+// scanJob is a batch scan started through the API.
+type scanJob struct {
+	ID         string                    `json:"id"`
+	Status     string                    `json:"status"`
+	Domains    []string                  `json:"domains"`
+	CreatedAt  time.Time                 `json:"created_at"`
+	FinishedAt *time.Time                `json:"finished_at,omitempty"`
+	Summaries  []subdomain.DomainSummary `json:"summaries"`
+
+	result *subdomain.BatchResult
+}
+
+type scanJobResponse struct {
+	scanJob
+	Partial bool                  `json:"partial"`
+	Count   int                   `json:"count"`
+	Items   []subdomain.BatchItem `json:"items,omitempty"`
+}
+
+type scanListResponse struct {
+	Count int       `json:"count"`
+	Scans []scanJob `json:"scans"`
+}
+
+// scanStore runs batch jobs one at a time, so the concurrency budget holds
+// across every batch on the server, and keeps their results in memory.
+type scanStore struct {
+	finder      *subdomain.Finder
+	concurrency int
+	workers     int
+	timeout     time.Duration
+
+	run    sync.Mutex
+	mu     sync.Mutex
+	nextID int
+	jobs   []*scanJob
+}
+
+func newScanStore(finder *subdomain.Finder, concurrency, workers int, timeout time.Duration) *scanStore {
+	return &scanStore{finder: finder, concurrency: concurrency, workers: workers, timeout: timeout}
+}
+
+// start queues a batch of domains and returns its job. It fails with
+// errScanQueueFull while maxQueuedScans jobs are still pending.
+func (s *scanStore) start(domains []string, concurrency int, opts subdomain.ScanOptions) (scanJob, error) {
+	if concurrency <= 0 || concurrency > s.concurrency {
+		concurrency = s.concurrency
+	}
+	s.mu.Lock()
+	pending := 0
+	for _, job := range s.jobs {
+		if job.Status != scanDone {
+			pending++
+		}
+	}
+	if pending >= maxQueuedScans {
+		s.mu.Unlock()
+		return scanJob{}, errScanQueueFull
+	}
+	s.nextID++
+	job := &scanJob{
+		ID:        strconv.Itoa(s.nextID),
+		Status:    scanQueued,
+		Domains:   domains,
+		CreatedAt: time.Now().UTC(),
+		Summaries: []subdomain.DomainSummary{},
+	}
+	s.jobs = append(s.jobs, job)
+	s.evictLocked()
+	snapshot := *job
+	s.mu.Unlock()
+
+	go func() {
+		s.run.Lock()
+		defer s.run.Unlock()
+		s.setStatus(job, scanRunning)
+		result := s.finder.ScanBatch(context.Background(), domains, subdomain.BatchOptions{
+			ScanOptions:   opts,
+			Concurrency:   concurrency,
+			Workers:       s.workers,
+			DomainTimeout: s.timeout,
+			Progress: func(summary subdomain.DomainSummary) {
+				s.mu.Lock()
+				job.Summaries = append(job.Summaries, summary)
+				s.mu.Unlock()
+			},
+		})
+		s.mu.Lock()
+		now := time.Now().UTC()
+		job.Status = scanDone
+		job.FinishedAt = &now
+		job.Summaries = result.Summaries
+		job.result = result
+		s.mu.Unlock()
+	}()
+	return snapshot, nil
+}
+
+func (s *scanStore) setStatus(job *scanJob, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job.Status = status
+}
+
+// evictLocked drops the oldest finished jobs beyond maxStoredScans.
+func (s *scanStore) evictLocked() {
+	for i := 0; len(s.jobs) > maxStoredScans && i < len(s.jobs); {
+		if s.jobs[i].Status != scanDone {
+			i++
+			continue
+		}
+		s.jobs = append(s.jobs[:i:i], s.jobs[i+1:]...)
+	}
+}
+
+// get returns a copy of the job with id.
+func (s *scanStore) get(id string) (scanJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.ID == id {
+			snapshot := *job
+			snapshot.Summaries = append([]subdomain.DomainSummary(nil), job.Summaries...)
+			return snapshot, true
+		}
+	}
+	return scanJob{}, false
+}
+
+func (s *scanStore) list() []scanJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]scanJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		snapshot := *job
+		snapshot.Summaries = append([]subdomain.DomainSummary(nil), job.Summaries...)
+		out = append(out, snapshot)
+	}
+	return out
+}
+
+// scanStartHandler accepts {"domains": [...]} as JSON, or a plain-text list
+// with one domain per line.
+func scanStartHandler(store *scanStore, adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req scanRequest
+		if strings.HasPrefix(c.ContentType(), "text/") {
+			domains, err := subdomain.ReadDomainList(http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+				return
+			}
+			req.Domains = domains
+			req.Concurrency, _ = strconv.Atoi(c.Query("concurrency"))
+		} else if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "body must be JSON with a domains list"})
+			return
+		}
+		domains, err := subdomain.ReadDomainList(strings.NewReader(strings.Join(req.Domains, "\n")))
+		if err != nil || len(domains) == 0 {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "at least one domain is required"})
+			return
+		}
+		if len(domains) > subdomain.MaxBatchDomains {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "too many domains; the limit is " + strconv.Itoa(subdomain.MaxBatchDomains)})
+			return
+		}
+		opts, ok := parseScanOptions(c, adminToken)
+		if !ok {
+			return
+		}
+		job, err := store.start(domains, req.Concurrency, opts)
+		if err != nil {
+			c.JSON(http.StatusTooManyRequests, errorResponse{Error: err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, job)
+	}
+}
+
+// scanGetHandler reports a job's progress and, once it is done, the
+// combined results filtered like /api/subdomains.
+func scanGetHandler(store *scanStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := store.get(c.Param("id"))
+		if !ok {
+			c.JSON(http.StatusNotFound, errorResponse{Error: "scan not found"})
+			return
+		}
+		filter, err := parseResultFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		response := scanJobResponse{scanJob: job}
+		if job.result != nil {
+			response.Partial = job.result.Partial
+			for _, item := range job.result.Combined() {
+				if filter.Match(item.Subdomain) {
+					response.Items = append(response.Items, item)
+				}
+			}
+			response.Count = len(response.Items)
+		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+func scanListHandler(store *scanStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		jobs := store.list()
+		c.JSON(http.StatusOK, scanListResponse{Count: len(jobs), Scans: jobs})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"net/http"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,11 +14,27 @@ import (
 	"goscouter/internal/subdomain"
 )
 
+// Values accepted by the view query parameter.
+const (
+	viewLegacy = "legacy"
+	viewFull   = "full"
+)
+
 type subdomainScanResponse struct {
-	Domain      string                `json:"domain"`
-	HasWildcard bool                  `json:"has_wildcard"`
-	Count       int                   `json:"count"`
-	Items       []subdomain.Subdomain `json:"items"`
+	SchemaVersion  int                       `json:"schema_version"`
+	Domain         string                    `json:"domain"`
+	DomainUnicode  string                    `json:"domain_unicode,omitempty"`
+	ETLDPlusOne    string                    `json:"etld_plus_one,omitempty"`
+	HasWildcard    bool                      `json:"has_wildcard"`
+	Partial        bool                      `json:"partial"`
+	Count          int                       `json:"count"`
+	Items          any                       `json:"items"`
+	RelatedDomains []string                  `json:"related_domains,omitempty"`
+	Sources        []subdomain.SourceStatus  `json:"sources,omitempty"`
+	DNSRecords     []subdomain.RecordFinding `json:"dns_records,omitempty"`
+	Excluded       []subdomain.Exclusion     `json:"excluded,omitempty"`
+	ActiveSkipped  string                    `json:"active_skipped,omitempty"`
+	PTRMismatches  []subdomain.PTRRecord     `json:"ptr_mismatches,omitempty"`
 }
 
 type errorResponse struct {
@@ -25,27 +42,54 @@ type errorResponse struct {
 }
 
 type scanResult struct {
-	Domain      string
-	HasWildcard bool
-	Items       []subdomain.Subdomain
+	Domain         string
+	DomainUnicode  string
+	ETLDPlusOne    string
+	HasWildcard    bool
+	Partial        bool
+	Items          []subdomain.Subdomain
+	RelatedDomains []string
+	Sources        []subdomain.SourceStatus
+	DNSRecords     []subdomain.RecordFinding
+	Excluded       []subdomain.Exclusion
+	ActiveSkipped  string
+	PTRMismatches  []subdomain.PTRRecord
 }
 
-func subdomainScanHandler(finder *subdomain.Finder, timeout time.Duration) gin.HandlerFunc {
+func subdomainScanHandler(finder *subdomain.Finder, timeout time.Duration, adminToken string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		domain := strings.TrimSpace(c.Query("domain"))
 		if domain == "" {
 			c.JSON(http.StatusBadRequest, errorResponse{Error: "domain query parameter is required"})
 			return
 		}
+		view := c.DefaultQuery("view", viewLegacy)
+		if view != viewLegacy && view != viewFull {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: "view must be legacy or full"})
+			return
+		}
+		filter, err := parseResultFilter(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		opts, ok := parseScanOptions(c, adminToken)
+		if !ok {
+			return
+		}
 
 		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 		defer cancel()
 
-		result, err := runSubdomainScan(ctx, finder, domain)
+		result, err := runSubdomainScan(ctx, finder, domain, opts, filter)
 		if err != nil {
 			status := http.StatusBadGateway
 			if errors.Is(err, subdomain.ErrInvalidDomain) {
 				status = http.StatusBadRequest
+			} else if errors.Is(err, subdomain.ErrPublicSuffix) {
+				c.JSON(http.StatusBadRequest, errorResponse{Error: err.Error() + " (add force=1 to scan it anyway)"})
+				return
 			} else if errors.Is(err, context.DeadlineExceeded) {
 				status = http.StatusGatewayTimeout
 			}
@@ -53,33 +97,113 @@ func subdomainScanHandler(finder *subdomain.Finder, timeout time.Duration) gin.H
 			return
 		}
 
-		c.JSON(http.StatusOK, subdomainScanResponse{
-			Domain:      result.Domain,
-			HasWildcard: result.HasWildcard,
-			Count:       len(result.Items),
-			Items:       result.Items,
-		})
+		response := subdomainScanResponse{
+			SchemaVersion:  subdomain.SchemaVersion,
+			Domain:         result.Domain,
+			DomainUnicode:  result.DomainUnicode,
+			ETLDPlusOne:    result.ETLDPlusOne,
+			HasWildcard:    result.HasWildcard,
+			Partial:        result.Partial,
+			Count:          len(result.Items),
+			Items:          result.Items,
+			RelatedDomains: result.RelatedDomains,
+			Sources:        result.Sources,
+			DNSRecords:     result.DNSRecords,
+			Excluded:       result.Excluded,
+			ActiveSkipped:  result.ActiveSkipped,
+			PTRMismatches:  result.PTRMismatches,
+		}
+		if view == viewLegacy {
+			response.SchemaVersion = 1
+			response.Items = legacyItems(result.Items)
+		}
+		c.JSON(http.StatusOK, response)
 	}
 }
 
-func runSubdomainScan(ctx context.Context, finder *subdomain.Finder, domain string) (scanResult, error) {
-	results, hasWildcard, err := finder.Find(ctx, domain)
+func runSubdomainScan(ctx context.Context, finder *subdomain.Finder, domain string, opts subdomain.ScanOptions, filter subdomain.ResultFilter) (scanResult, error) {
+	result, err := finder.ScanWith(ctx, domain, opts)
 	if err != nil {
 		return scanResult{}, err
 	}
 
-	items := make([]subdomain.Subdomain, 0, len(results))
-	for _, item := range results {
+	items := make([]subdomain.Subdomain, 0, len(result.Subdomains))
+	for _, item := range result.Subdomains {
+		if !filter.Match(item) {
+			continue
+		}
 		items = append(items, item)
 	}
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].Name < items[j].Name
 	})
 
-	normalizedDomain := strings.TrimSuffix(strings.ToLower(domain), ".")
+	unicodeDomain := ""
+	if result.UnicodeDomain != result.Domain {
+		unicodeDomain = result.UnicodeDomain
+	}
 	return scanResult{
-		Domain:      normalizedDomain,
-		HasWildcard: hasWildcard,
-		Items:       items,
+		Domain:         result.Domain,
+		DomainUnicode:  unicodeDomain,
+		ETLDPlusOne:    result.ETLDPlusOne,
+		HasWildcard:    result.HasWildcard,
+		Partial:        result.Partial,
+		Items:          items,
+		RelatedDomains: result.RelatedDomains,
+		Sources:        result.Sources,
+		DNSRecords:     result.DNSRecords,
+		Excluded:       result.Excluded,
+		ActiveSkipped:  result.ActiveSkipped,
+		PTRMismatches:  result.PTRMismatches,
 	}, nil
 }
+
+// parseScanOptions reads force=1 and an admin override=1 with its reason.
+// It writes the error response itself.
+func parseScanOptions(c *gin.Context, adminToken string) (subdomain.ScanOptions, bool) {
+	opts := subdomain.ScanOptions{AllowPublicSuffix: c.Query("force") == "1"}
+	if c.Query("override") != "1" {
+		return opts, true
+	}
+	actor, ok := requireAdmin(c, adminToken)
+	if !ok {
+		return opts, false
+	}
+	reason := strings.TrimSpace(c.Query("reason"))
+	if reason == "" {
+		c.JSON(http.StatusBadRequest, errorResponse{Error: "reason is required with override=1"})
+		return opts, false
+	}
+	opts.Override = &subdomain.AuthOverride{Actor: actor, Reason: reason}
+	return opts, true
+}
+
+// legacyItems converts items to the flat schema version 1 shape.
+func legacyItems(items []subdomain.Subdomain) []subdomain.LegacySubdomain {
+	out := make([]subdomain.LegacySubdomain, 0, len(items))
+	for _, item := range items {
+		out = append(out, item.Legacy())
+	}
+	return out
+}
+
+// parseResultFilter reads the source and min_confidence query parameters.
+// Sources may be repeated or comma separated.
+func parseResultFilter(c *gin.Context) (subdomain.ResultFilter, error) {
+	var filter subdomain.ResultFilter
+	for _, value := range c.QueryArray("source") {
+		for _, source := range strings.Split(value, ",") {
+			if source = strings.TrimSpace(strings.ToLower(source)); source != "" {
+				filter.Sources = append(filter.Sources, source)
+			}
+		}
+	}
+	if value := strings.TrimSpace(c.Query("min_confidence")); value != "" {
+		minConfidence, err := strconv.ParseFloat(value, 64)
+		if err != nil || minConfidence < 0 || minConfidence > 1 {
+			return filter, errors.New("min_confidence must be a number between 0 and 1")
+		}
+		filter.MinConfidence = minConfidence
+	}
+	return filter, nil
+}
@@ -0,0 +1,275 @@
+// Discovery from web archive URL indexes (Wayback Machine, Common Crawl).
+
+package subdomain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of the web archive sources.
+const (
+	SourceWayback     = "wayback"
+	SourceCommonCrawl = "commoncrawl"
+)
+
+const (
+	defaultMaxArchiveResults   = 50000
+	defaultMaxArchivePages     = 10
+	defaultCommonCrawlIndexes  = 1
+	archiveTimestampLayout     = "20060102150405"
+	maxArchivePageCountPayload = 4 << 10
+)
+
+// WithWebArchives enables the Wayback Machine and Common Crawl sources.
+func WithWebArchives(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.webArchives = enabled
+	}
+}
+
+// WithMaxArchiveResults caps how many archived URLs each archive source
+// reads per scan.
+func WithMaxArchiveResults(limit int) FinderOption {
+	return func(f *Finder) {
+		if limit > 0 {
+			f.maxArchiveResults = limit
+		}
+	}
+}
+
+// WithMaxArchivePages caps how many CDX result pages are requested from
+// each archive index.
+func WithMaxArchivePages(pages int) FinderOption {
+	return func(f *Finder) {
+		if pages > 0 {
+			f.maxArchivePages = pages
+		}
+	}
+}
+
+// WithCommonCrawlIndexes sets how many of the most recent Common Crawl
+// indexes are searched.
+func WithCommonCrawlIndexes(n int) FinderOption {
+	return func(f *Finder) {
+		if n > 0 {
+			f.ccIndexes = n
+		}
+	}
+}
+
+func (f *Finder) archiveSources() []discoverySource {
+	if !f.webArchives {
+		return nil
+	}
+	return []discoverySource{
+		{SourceWayback, f.collectFromWayback},
+		{SourceCommonCrawl, f.collectFromCommonCrawl},
+	}
+}
+
+// archiveBudget counts archived URLs against maxArchiveResults.
+type archiveBudget struct {
+	left   int
+	capped bool
+}
+
+// take consumes one URL from the budget, reporting false once it is spent.
+func (b *archiveBudget) take() bool {
+	if b.left <= 0 {
+		b.capped = true
+		return false
+	}
+	b.left--
+	return true
+}
+
+// collectFromWayback lists archived URLs under *.domain from the Wayback
+// CDX API, one CDX page at a time. Only the first capture of each URL is
+// requested, and its timestamp is recorded as when the name was seen.
+func (f *Finder) collectFromWayback(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	baseURL := fmt.Sprintf("%s/cdx/search/cdx?url=%s&fl=original,timestamp&collapse=urlkey",
+		f.sourceBaseURL(SourceWayback), neturl.QueryEscape("*."+domain))
+
+	pages, err := f.cdxPageCount(ctx, SourceWayback, baseURL)
+	if err != nil {
+		return run, fmt.Errorf("wayback request failed: %w", err)
+	}
+	if pages > f.maxArchivePages {
+		pages = f.maxArchivePages
+		run.capped = true
+	}
+
+	budget := archiveBudget{left: f.maxArchiveResults}
+	for page := 0; page < pages && !budget.capped; page++ {
+		url := fmt.Sprintf("%s&output=json&page=%d", baseURL, page)
+		capped, err := streamJSONArray(ctx, f, SourceWayback, url, func(row []string) {
+			// The first row of every page is the field header.
+			if len(row) < 2 || row[0] == "original" || !budget.take() {
+				return
+			}
+			addArchivedURL(results, row[0], row[1], SourceWayback, domain)
+		})
+		if err != nil {
+			return run, fmt.Errorf("wayback request failed: %w", err)
+		}
+		if capped {
+			run.capped = true
+		}
+		if f.debug {
+			log.Printf("[DEBUG] wayback page %d/%d for %s read", page+1, pages, domain)
+		}
+	}
+	run.capped = run.capped || budget.capped
+	return run, nil
+}
+
+type commonCrawlIndex struct {
+	ID     string `json:"id"`
+	CDXAPI string `json:"cdx-api"`
+}
+
+type commonCrawlRecord struct {
+	URL       string `json:"url"`
+	Timestamp string `json:"timestamp"`
+}
+
+// collectFromCommonCrawl searches the newest ccIndexes Common Crawl
+// indexes for *.domain, paging through each.
+func (f *Finder) collectFromCommonCrawl(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	var indexes []commonCrawlIndex
+	if err := f.fetchJSON(ctx, SourceCommonCrawl, f.sourceBaseURL(SourceCommonCrawl)+"/collinfo.json", &indexes); err != nil {
+		return run, fmt.Errorf("commoncrawl index list failed: %w", err)
+	}
+	if len(indexes) > f.ccIndexes {
+		indexes = indexes[:f.ccIndexes]
+	}
+
+	budget := archiveBudget{left: f.maxArchiveResults}
+	for _, index := range indexes {
+		if budget.capped {
+			break
+		}
+		baseURL := fmt.Sprintf("%s?url=%s&fl=url,timestamp", index.CDXAPI, neturl.QueryEscape("*."+domain))
+		pages, err := f.cdxPageCount(ctx, SourceCommonCrawl, baseURL)
+		if responseStatus(err) == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return run, fmt.Errorf("commoncrawl %s request failed: %w", index.ID, err)
+		}
+		if pages > f.maxArchivePages {
+			pages = f.maxArchivePages
+			run.capped = true
+		}
+
+		for page := 0; page < pages && !budget.capped; page++ {
+			url := fmt.Sprintf("%s&output=json&page=%d", baseURL, page)
+			capped, err := f.readCommonCrawlPage(ctx, url, func(record commonCrawlRecord) {
+				if budget.take() {
+					addArchivedURL(results, record.URL, record.Timestamp, SourceCommonCrawl, domain)
+				}
+			})
+			if responseStatus(err) == http.StatusNotFound {
+				break
+			}
+			if err != nil {
+				return run, fmt.Errorf("commoncrawl %s request failed: %w", index.ID, err)
+			}
+			if capped {
+				run.capped = true
+			}
+		}
+		if f.debug {
+			log.Printf("[DEBUG] commoncrawl %s for %s read (%d pages)", index.ID, domain, pages)
+		}
+	}
+	run.capped = run.capped || budget.capped
+	return run, nil
+}
+
+// readCommonCrawlPage decodes the newline-delimited records of one index
+// page. A body cut off at maxBodySize keeps the records read so far.
+func (f *Finder) readCommonCrawlPage(ctx context.Context, url string, fn func(commonCrawlRecord)) (bool, error) {
+	body, err := f.openURL(ctx, SourceCommonCrawl, url)
+	if err != nil {
+		return false, err
+	}
+	defer body.Close()
+
+	limited := &io.LimitedReader{R: body, N: f.maxBodySize}
+	decoder := json.NewDecoder(limited)
+	for {
+		var record commonCrawlRecord
+		if err := decoder.Decode(&record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return limited.N <= 0, nil
+			}
+			if limited.N <= 0 {
+				return true, nil
+			}
+			return false, err
+		}
+		fn(record)
+	}
+}
+
+// cdxPageCount asks a CDX server how many result pages a query spans.
+// Wayback answers with a bare number, pywb-based servers such as Common
+// Crawl with a JSON object.
+func (f *Finder) cdxPageCount(ctx context.Context, source, baseURL string) (int, error) {
+	body, err := f.openURL(ctx, source, baseURL+"&showNumPages=true")
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, maxArchivePageCountPayload))
+	if err != nil {
+		return 0, err
+	}
+
+	text := strings.TrimSpace(string(data))
+	if n, err := strconv.Atoi(text); err == nil {
+		return n, nil
+	}
+	var info struct {
+		Pages int `json:"pages"`
+	}
+	if err := json.Unmarshal([]byte(text), &info); err != nil {
+		return 0, fmt.Errorf("unexpected page count %q", text)
+	}
+	return info.Pages, nil
+}
+
+// addArchivedURL adds the host of an archived URL when it falls under
+// domain. Archives keep URLs as crawled, so scheme-less values and ports
+// are expected.
+func addArchivedURL(results map[string]Subdomain, rawURL, timestamp, source, domain string) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return
+	}
+	name := normalizeName(u.Hostname())
+	if !isSubdomainOf(name, domain) {
+		return
+	}
+	seen, err := time.Parse(archiveTimestampLayout, timestamp)
+	if err != nil {
+		seen = time.Time{}
+	}
+	addSubdomain(results, name, source, seen, nil)
+}
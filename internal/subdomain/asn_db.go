@@ -0,0 +1,220 @@
+// Offline IP-to-ASN lookups backed by a local database file.
+
+package subdomain
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASNRecord describes the autonomous system announcing an IP.
+type ASNRecord struct {
+	ASN     uint32
+	Org     string
+	Country string
+	Network string
+}
+
+// ASNDatabase resolves IPs to the autonomous system that announces them.
+type ASNDatabase interface {
+	LookupASN(ip netip.Addr) (ASNRecord, bool)
+}
+
+// ASNExpander lists the networks an autonomous system announces.
+type ASNExpander interface {
+	Prefixes(asn uint32) []netip.Prefix
+}
+
+// OpenASNDatabase loads an ASN database from path. Files ending in .mmdb
+// are read as MaxMind DB; anything else is parsed as an iptoasn TSV dump,
+// optionally gzip compressed.
+func OpenASNDatabase(path string) (ASNDatabase, error) {
+	if strings.HasSuffix(strings.ToLower(path), ".mmdb") {
+		return OpenMMDB(path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var r io.Reader = file
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return ParseASNTable(r)
+}
+
+type asnRange struct {
+	start netip.Addr
+	end   netip.Addr
+	rec   ASNRecord
+}
+
+// ASNTable is an in-memory range table loaded from an iptoasn TSV file.
+type ASNTable struct {
+	v4 []asnRange
+	v6 []asnRange
+}
+
+// ParseASNTable reads iptoasn TSV rows of the form
+// "range_start\trange_end\tAS_number\tcountry_code\tAS_description".
+// Unrouted ranges (AS 0) are skipped.
+func ParseASNTable(r io.Reader) (*ASNTable, error) {
+	table := &ASNTable{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.SplitN(text, "\t", 5)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("asn table line %d: expected at least 3 fields", line)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("asn table line %d: %w", line, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("asn table line %d: %w", line, err)
+		}
+		asn, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("asn table line %d: %w", line, err)
+		}
+		if asn == 0 {
+			continue
+		}
+
+		rec := ASNRecord{ASN: uint32(asn)}
+		if len(fields) > 3 && fields[3] != "None" {
+			rec.Country = fields[3]
+		}
+		if len(fields) > 4 && fields[4] != "Not routed" {
+			rec.Org = fields[4]
+		}
+		entry := asnRange{start: start.Unmap(), end: end.Unmap(), rec: rec}
+		if entry.start.Is4() {
+			table.v4 = append(table.v4, entry)
+		} else {
+			table.v6 = append(table.v6, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, ranges := range [][]asnRange{table.v4, table.v6} {
+		sort.Slice(ranges, func(i, j int) bool {
+			return ranges[i].start.Less(ranges[j].start)
+		})
+	}
+	return table, nil
+}
+
+// LookupASN finds the range containing ip with a binary search.
+func (t *ASNTable) LookupASN(ip netip.Addr) (ASNRecord, bool) {
+	ip = ip.Unmap()
+	ranges := t.v6
+	if ip.Is4() {
+		ranges = t.v4
+	}
+	i := sort.Search(len(ranges), func(i int) bool {
+		return ip.Less(ranges[i].start)
+	})
+	if i == 0 {
+		return ASNRecord{}, false
+	}
+	entry := ranges[i-1]
+	if entry.end.Less(ip) {
+		return ASNRecord{}, false
+	}
+	rec := entry.rec
+	rec.Network = rangePrefix(ip, entry.start, entry.end).String()
+	return rec, true
+}
+
+// Prefixes returns the CIDR blocks covering every range announced by asn.
+func (t *ASNTable) Prefixes(asn uint32) []netip.Prefix {
+	var out []netip.Prefix
+	for _, ranges := range [][]asnRange{t.v4, t.v6} {
+		for _, entry := range ranges {
+			if entry.rec.ASN == asn {
+				out = append(out, splitRange(entry.start, entry.end)...)
+			}
+		}
+	}
+	return out
+}
+
+// splitRange returns the fewest CIDR blocks exactly covering [start, end].
+func splitRange(start, end netip.Addr) []netip.Prefix {
+	var out []netip.Prefix
+	for cur := start; cur.IsValid() && !end.Less(cur); {
+		prefix := rangePrefix(cur, cur, end)
+		out = append(out, prefix)
+		cur = lastAddr(prefix).Next()
+	}
+	return out
+}
+
+// rangePrefix returns the largest CIDR block containing ip that fits
+// entirely inside [start, end].
+func rangePrefix(ip, start, end netip.Addr) netip.Prefix {
+	for bits := 0; bits <= ip.BitLen(); bits++ {
+		prefix, err := ip.Prefix(bits)
+		if err != nil {
+			continue
+		}
+		if !prefix.Addr().Less(start) && !lastAddr(prefix).Less(ip) && !end.Less(lastAddr(prefix)) {
+			return prefix
+		}
+	}
+	return netip.PrefixFrom(ip, ip.BitLen())
+}
+
+// lastAddr returns the highest address inside prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Masked().Addr()
+	raw := addr.AsSlice()
+	for bit := prefix.Bits(); bit < len(raw)*8; bit++ {
+		raw[bit/8] |= 0x80 >> (bit % 8)
+	}
+	last, _ := netip.AddrFromSlice(raw)
+	return last
+}
+
+// WithASNDatabase makes IP owner lookups use a local ASN database instead
+// of ipinfo.io. Range scans also use it to expand ASNs into networks.
+func WithASNDatabase(db ASNDatabase) FinderOption {
+	return func(f *Finder) {
+		f.asnDB = db
+	}
+}
+
+// WithIPInfoFallback queries ipinfo.io for IPs missing from the local ASN
+// database. It has no effect when no database is configured.
+func WithIPInfoFallback(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.ipinfoFallback = enabled
+	}
+}
@@ -0,0 +1,412 @@
+// Domain authorization: ownership proofs required before active scanning.
+
+package subdomain
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Ways a domain can prove ownership.
+const (
+	VerifyDNS  = "dns"
+	VerifyHTTP = "http"
+)
+
+const (
+	// authTXTLabel is prepended to the domain for the TXT record proof.
+	authTXTLabel = "_goscouter-challenge"
+	// authTXTPrefix starts the TXT record value, followed by the token.
+	authTXTPrefix = "goscouter-verification="
+	// AuthWellKnownPath holds the token for the HTTP proof.
+	AuthWellKnownPath = "/.well-known/goscouter-verification.txt"
+	maxAuthFileSize   = 4 << 10
+)
+
+var (
+	// ErrNotAuthorized is returned when an active step is requested for a
+	// domain that has not been verified.
+	ErrNotAuthorized = errors.New("domain is not verified for active scanning")
+	// ErrVerificationFailed is returned when the ownership proof was not
+	// found.
+	ErrVerificationFailed = errors.New("ownership proof not found")
+)
+
+// Authorization is the verification state of one domain. Verifying a
+// domain authorizes every name below it.
+type Authorization struct {
+	Domain     string    `json:"domain"`
+	Token      string    `json:"token"`
+	Verified   bool      `json:"verified"`
+	Method     string    `json:"method,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	VerifiedAt time.Time `json:"verified_at,omitempty"`
+}
+
+// TXTRecord returns the name and value of the DNS proof.
+func (a Authorization) TXTRecord() (string, string) {
+	return authTXTLabel + "." + a.Domain, authTXTPrefix + a.Token
+}
+
+// WellKnownURL returns where the HTTP proof is fetched from.
+func (a Authorization) WellKnownURL() string {
+	return "https://" + a.Domain + AuthWellKnownPath
+}
+
+// AuditEntry records an action on the registry, most importantly an admin
+// override that let active steps run against an unverified domain.
+type AuditEntry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Domain string    `json:"domain"`
+	Actor  string    `json:"actor,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// Audit actions.
+const (
+	AuditVerified = "verified"
+	AuditRevoked  = "revoked"
+	AuditOverride = "override"
+)
+
+// AuthRegistry tracks which domains may be scanned actively. State is kept
+// in a JSON file and audit entries are appended to a JSON-lines log when
+// paths are given. It is safe for concurrent use.
+type AuthRegistry struct {
+	mu        sync.Mutex
+	path      string
+	auditPath string
+	entries   map[string]*Authorization
+	audit     []AuditEntry
+}
+
+// NewAuthRegistry loads the registry from path and the audit log from
+// auditPath. Either may be empty to keep that part in memory only.
+func NewAuthRegistry(path, auditPath string) (*AuthRegistry, error) {
+	r := &AuthRegistry{path: path, auditPath: auditPath, entries: make(map[string]*Authorization)}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return nil, err
+		default:
+			var list []*Authorization
+			if err := json.Unmarshal(data, &list); err != nil {
+				return nil, fmt.Errorf("parse authorizations: %w", err)
+			}
+			for _, a := range list {
+				r.entries[a.Domain] = a
+			}
+		}
+	}
+	if auditPath != "" {
+		audit, err := readAuditLog(auditPath)
+		if err != nil {
+			return nil, err
+		}
+		r.audit = audit
+	}
+	return r, nil
+}
+
+func readAuditLog(path string) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var audit []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		audit = append(audit, entry)
+	}
+	return audit, scanner.Err()
+}
+
+// Challenge returns the pending or verified authorization for domain,
+// creating a token the first time.
+func (r *AuthRegistry) Challenge(domain string) (Authorization, error) {
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return Authorization{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if a, ok := r.entries[domain]; ok {
+		return *a, nil
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return Authorization{}, err
+	}
+	a := &Authorization{Domain: domain, Token: hex.EncodeToString(token), CreatedAt: time.Now().UTC()}
+	r.entries[domain] = a
+	return *a, r.saveLocked()
+}
+
+// Get returns the authorization for domain itself.
+func (r *AuthRegistry) Get(domain string) (Authorization, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.entries[domain]
+	if !ok {
+		return Authorization{}, false
+	}
+	return *a, true
+}
+
+// List returns every authorization sorted by domain.
+func (r *AuthRegistry) List() []Authorization {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]Authorization, 0, len(r.entries))
+	for _, a := range r.entries {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Domain < out[j].Domain })
+	return out
+}
+
+// Authorized reports whether domain or one of its parents is verified.
+func (r *AuthRegistry) Authorized(domain string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := domain; name != ""; {
+		if a, ok := r.entries[name]; ok && a.Verified {
+			return true
+		}
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			break
+		}
+		name = name[i+1:]
+	}
+	return false
+}
+
+// Revoke removes domain from the registry, reporting whether it existed.
+func (r *AuthRegistry) Revoke(domain, actor string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[domain]; !ok {
+		return false, nil
+	}
+	delete(r.entries, domain)
+	if err := r.saveLocked(); err != nil {
+		return true, err
+	}
+	return true, r.auditLocked(AuditEntry{Action: AuditRevoked, Domain: domain, Actor: actor})
+}
+
+// Audit returns the recorded audit entries, oldest first.
+func (r *AuthRegistry) Audit() []AuditEntry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]AuditEntry(nil), r.audit...)
+}
+
+// RecordOverride audits that actor ran active steps against an unverified
+// domain.
+func (r *AuthRegistry) RecordOverride(domain, actor, reason string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.auditLocked(AuditEntry{Action: AuditOverride, Domain: domain, Actor: actor, Reason: reason})
+}
+
+func (r *AuthRegistry) markVerified(domain, method string) (Authorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.entries[domain]
+	if !ok {
+		return Authorization{}, fmt.Errorf("no challenge issued for %s", domain)
+	}
+	a.Verified = true
+	a.Method = method
+	a.VerifiedAt = time.Now().UTC()
+	if err := r.saveLocked(); err != nil {
+		return *a, err
+	}
+	return *a, r.auditLocked(AuditEntry{Action: AuditVerified, Domain: domain, Reason: method})
+}
+
+// saveLocked writes the registry through a temporary file so a crash never
+// leaves it truncated.
+func (r *AuthRegistry) saveLocked() error {
+	if r.path == "" {
+		return nil
+	}
+	list := make([]*Authorization, 0, len(r.entries))
+	for _, a := range r.entries {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Domain < list[j].Domain })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return err
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.path)
+}
+
+func (r *AuthRegistry) auditLocked(entry AuditEntry) error {
+	entry.Time = time.Now().UTC()
+	r.audit = append(r.audit, entry)
+	if r.auditPath == "" {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.auditPath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.auditPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// WithAuthorization makes active steps (TLS inspection, port scanning, HTTP
+// probing and PTR sweeps) run only for domains verified in registry.
+func WithAuthorization(registry *AuthRegistry) FinderOption {
+	return func(f *Finder) {
+		f.authz = registry
+	}
+}
+
+// AuthOverride lets an administrator run active steps against an
+// unverified domain. Every use is audited.
+type AuthOverride struct {
+	Actor  string
+	Reason string
+}
+
+// VerifyDomain checks the ownership proof for a challenge issued by the
+// Finder's registry and marks the domain verified when it is found.
+func (f *Finder) VerifyDomain(ctx context.Context, domain, method string) (Authorization, error) {
+	if f.authz == nil {
+		return Authorization{}, errors.New("no authorization registry configured")
+	}
+	domain, err := normalizeDomain(domain)
+	if err != nil {
+		return Authorization{}, err
+	}
+	a, ok := f.authz.Get(domain)
+	if !ok {
+		return Authorization{}, fmt.Errorf("no challenge issued for %s", domain)
+	}
+	switch method {
+	case VerifyDNS:
+		err = f.verifyTXT(ctx, a)
+	case VerifyHTTP:
+		err = f.verifyWellKnown(ctx, a)
+	default:
+		return a, fmt.Errorf("unknown verification method %q", method)
+	}
+	if err != nil {
+		return a, err
+	}
+	return f.authz.markVerified(domain, method)
+}
+
+func (f *Finder) verifyTXT(ctx context.Context, a Authorization) error {
+	name, want := a.TXTRecord()
+	records, err := f.resolver.LookupTXT(ctx, name)
+	if err != nil {
+		if isDNSNotFound(err) {
+			return fmt.Errorf("%w: no TXT record at %s", ErrVerificationFailed, name)
+		}
+		return err
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: TXT record at %s does not contain the token", ErrVerificationFailed, name)
+}
+
+// verifyWellKnown fetches the token file over HTTPS. Redirects are not
+// followed, so an open redirect elsewhere cannot satisfy the proof.
+func (f *Finder) verifyWellKnown(ctx context.Context, a Authorization) error {
+	client := &http.Client{
+		Timeout: f.httpClient.Timeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	url := a.WellKnownURL()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %s", ErrVerificationFailed, url, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAuthFileSize))
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(body)) != a.Token {
+		return fmt.Errorf("%w: %s does not contain the token", ErrVerificationFailed, url)
+	}
+	return nil
+}
+
+// activeAllowed decides whether active steps may run for domain, auditing
+// any override. The returned reason explains a refusal.
+func (f *Finder) activeAllowed(domain string, override *AuthOverride) (bool, string) {
+	if f.authz == nil || f.authz.Authorized(domain) {
+		return true, ""
+	}
+	if override != nil {
+		if err := f.authz.RecordOverride(domain, override.Actor, override.Reason); err != nil {
+			// An override that cannot be audited is not honoured.
+			return false, fmt.Sprintf("%v; override could not be audited: %v", ErrNotAuthorized, err)
+		}
+		if f.debug {
+			log.Printf("[DEBUG] Active steps for %s allowed by override from %s", domain, override.Actor)
+		}
+		return true, ""
+	}
+	return false, ErrNotAuthorized.Error()
+}
@@ -0,0 +1,259 @@
+// Batch scanning of many apex domains with shared caches.
+
+package subdomain
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchWorkers     = 50
+	// MaxBatchDomains caps how many domains one batch accepts.
+	MaxBatchDomains = 500
+)
+
+// BatchOptions adjusts a batch scan.
+type BatchOptions struct {
+	ScanOptions
+	// Concurrency is how many domains are scanned at once across the
+	// whole batch.
+	Concurrency int
+	// Workers caps the network workers running at once across the whole
+	// batch: TLS handshakes, HTTP probes, port checks and SRV and PTR
+	// lookups. Each stage also keeps its own per-domain limit (10 TLS, 20
+	// probe, 20 PTR and 10 SRV workers, and the port scan concurrency),
+	// whichever is lower. The default is 50.
+	Workers int
+	// DomainTimeout bounds each domain's scan; zero leaves only the
+	// batch context.
+	DomainTimeout time.Duration
+	// Progress, if set, is called as each domain finishes. Calls may come
+	// from several goroutines.
+	Progress func(DomainSummary)
+}
+
+// DomainSummary is the outcome of one domain in a batch.
+type DomainSummary struct {
+	Domain         string   `json:"domain"`
+	OK             bool     `json:"ok"`
+	Error          string   `json:"error,omitempty"`
+	Count          int      `json:"count"`
+	Alive          int      `json:"alive"`
+	HasWildcard    bool     `json:"has_wildcard"`
+	Partial        bool     `json:"partial"`
+	Excluded       int      `json:"excluded,omitempty"`
+	ActiveSkipped  string   `json:"active_skipped,omitempty"`
+	RelatedDomains []string `json:"related_domains,omitempty"`
+	DurationMS     int64    `json:"duration_ms"`
+}
+
+// BatchResult holds every domain's result in input order.
+type BatchResult struct {
+	// Results has one entry per domain; failed domains are nil.
+	Results   []*ScanResult
+	Summaries []DomainSummary
+	// Partial is set when any domain failed or returned partial results.
+	Partial bool
+}
+
+// BatchItem is a subdomain in the combined results with the apex that was
+// scanned to find it.
+type BatchItem struct {
+	Domain string `json:"domain"`
+	Subdomain
+}
+
+// Combined merges the subdomains of every domain into one list sorted by
+// name. A name found under two scanned domains is listed once, with the
+// domain that came first.
+func (b *BatchResult) Combined() []BatchItem {
+	seen := make(map[string]bool)
+	items := []BatchItem{}
+	for _, result := range b.Results {
+		if result == nil {
+			continue
+		}
+		for name, data := range result.Subdomains {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			items = append(items, BatchItem{Domain: result.Domain, Subdomain: data})
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Name < items[j].Name })
+	return items
+}
+
+// ReadDomainList reads one domain per line, skipping blank lines and
+// "#" comments, and drops duplicates.
+func ReadDomainList(r io.Reader) ([]string, error) {
+	var domains []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return uniqueStrings(domains), nil
+}
+
+// scanCache shares DNS answers and IP owners between the scans of a batch,
+// where apexes of one organization tend to point at the same hosts.
+type scanCache struct {
+	mu     sync.Mutex
+	hosts  map[string]hostAnswer
+	owners map[string]IPOwnerInfo
+}
+
+type hostAnswer struct {
+	ips []string
+	err error
+}
+
+func newScanCache() *scanCache {
+	return &scanCache{hosts: make(map[string]hostAnswer), owners: make(map[string]IPOwnerInfo)}
+}
+
+func (c *scanCache) host(name string) (hostAnswer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	answer, ok := c.hosts[name]
+	return answer, ok
+}
+
+func (c *scanCache) setHost(name string, answer hostAnswer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hosts[name] = answer
+}
+
+func (c *scanCache) owner(ip string) (IPOwnerInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	owner, ok := c.owners[ip]
+	return owner, ok
+}
+
+func (c *scanCache) setOwner(ip string, owner IPOwnerInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.owners[ip] = owner
+}
+
+// ScanBatch scans every domain with at most opts.Concurrency scans running
+// at a time, sharing opts.Workers network workers between them. DNS
+// answers and IP owners are cached across the batch. A domain that fails
+// is reported in its summary and does not stop the others.
+func (f *Finder) ScanBatch(ctx context.Context, domains []string, opts BatchOptions) *BatchResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBatchConcurrency
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+	batch := *f
+	batch.cache = newScanCache()
+	batch.workers = make(chan struct{}, workers)
+
+	out := &BatchResult{
+		Results:   make([]*ScanResult, len(domains)),
+		Summaries: make([]DomainSummary, len(domains)),
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, domain string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			scanCtx, cancel := ctx, context.CancelFunc(func() {})
+			if opts.DomainTimeout > 0 {
+				scanCtx, cancel = context.WithTimeout(ctx, opts.DomainTimeout)
+			}
+			defer cancel()
+
+			start := time.Now()
+			result, err := batch.ScanWith(scanCtx, domain, opts.ScanOptions)
+			summary := summarizeScan(domain, result, err)
+			summary.DurationMS = time.Since(start).Milliseconds()
+			out.Results[i] = result
+			out.Summaries[i] = summary
+			if opts.Progress != nil {
+				opts.Progress(summary)
+			}
+		}(i, domain)
+	}
+	wg.Wait()
+
+	for _, summary := range out.Summaries {
+		if !summary.OK || summary.Partial {
+			out.Partial = true
+		}
+	}
+	return out
+}
+
+// acquireWorker waits for a slot in the batch-wide worker budget. It
+// reports false if ctx ends first. Outside a batch there is no budget and
+// it returns at once.
+func (f *Finder) acquireWorker(ctx context.Context) bool {
+	if f.workers == nil {
+		return true
+	}
+	select {
+	case f.workers <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseWorker returns a slot taken by acquireWorker.
+func (f *Finder) releaseWorker() {
+	if f.workers != nil {
+		<-f.workers
+	}
+}
+
+func summarizeScan(domain string, result *ScanResult, err error) DomainSummary {
+	if err != nil {
+		return DomainSummary{Domain: domain, Error: err.Error()}
+	}
+	summary := DomainSummary{
+		Domain:         result.Domain,
+		OK:             true,
+		Count:          len(result.Subdomains),
+		HasWildcard:    result.HasWildcard,
+		Partial:        result.Partial,
+		Excluded:       len(result.Excluded),
+		ActiveSkipped:  result.ActiveSkipped,
+		RelatedDomains: result.RelatedDomains,
+	}
+	for _, data := range result.Subdomains {
+		if data.Alive {
+			summary.Alive++
+		}
+	}
+	return summary
+}
@@ -0,0 +1,136 @@
+package subdomain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// countingOwners answers every address with one owner and counts lookups.
+type countingOwners struct {
+	mu      sync.Mutex
+	lookups map[string]int
+}
+
+func (p *countingOwners) Name() string { return "stub" }
+
+func (p *countingOwners) LookupOwner(_ context.Context, ip netip.Addr) (IPOwnerInfo, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lookups[ip.String()]++
+	return IPOwnerInfo{ASN: 64496, Org: "Example Org"}, nil
+}
+
+func TestScanBatch(t *testing.T) {
+	crtSh := map[string][]string{
+		"%.example.com":      {"www.example.com", "api.shop.example.com"},
+		"%.shop.example.com": {"api.shop.example.com"},
+		"%.example.org":      {"mail.example.org"},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		var entries []string
+		for _, name := range crtSh[r.URL.Query().Get("q")] {
+			entries = append(entries, fmt.Sprintf(`{"name_value":%q,"serial_number":"01"}`, name))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(entries, ","))
+	})
+	mux.HandleFunc("GET /v1/issuances", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	zone := &dnsZone{a: map[string][]string{
+		"www.example.com":      {"192.0.2.1"},
+		"api.shop.example.com": {"192.0.2.2"},
+		"mail.example.org":     {"192.0.2.1"},
+	}}
+	owners := &countingOwners{lookups: make(map[string]int)}
+	f := NewFinder(
+		WithResolver(dnsStandIn(t, zone)),
+		WithOwnerProviders(owners),
+		WithSourceBaseURL(SourceCrtSh, srv.URL),
+		WithSourceBaseURL(SourceCertSpotter, srv.URL),
+	)
+
+	var progress []string
+	var progressMu sync.Mutex
+	domains := []string{"example.com", "shop.example.com", "example.org", "not a domain"}
+	batch := f.ScanBatch(context.Background(), domains, BatchOptions{
+		Concurrency: 1,
+		Workers:     2,
+		Progress: func(s DomainSummary) {
+			progressMu.Lock()
+			defer progressMu.Unlock()
+			progress = append(progress, s.Domain)
+		},
+	})
+
+	type summary struct {
+		domain string
+		ok     bool
+		count  int
+	}
+	var got []summary
+	for _, s := range batch.Summaries {
+		got = append(got, summary{s.Domain, s.OK, s.Count})
+	}
+	want := []summary{
+		{"example.com", true, 2},
+		{"shop.example.com", true, 1},
+		{"example.org", true, 1},
+		{"not a domain", false, 0},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("summaries = %+v, want %+v", got, want)
+	}
+	if batch.Summaries[3].Error == "" || batch.Results[3] != nil {
+		t.Errorf("invalid domain: error %q, result %v", batch.Summaries[3].Error, batch.Results[3])
+	}
+	if !batch.Partial {
+		t.Error("Partial not set with a failed domain")
+	}
+	if len(progress) != len(domains) {
+		t.Errorf("Progress called for %v, want every domain", progress)
+	}
+
+	// The second scan finds api.shop.example.com again and the .org scan
+	// meets 192.0.2.1 again; both come from the batch cache.
+	if n := zone.count("api.shop.example.com", dnsmessage.TypeA); n != 1 {
+		t.Errorf("api.shop.example.com resolved %d times, want 1", n)
+	}
+	for ip, n := range owners.lookups {
+		if n != 1 {
+			t.Errorf("owner of %s looked up %d times, want 1", ip, n)
+		}
+	}
+	if len(owners.lookups) != 2 {
+		t.Errorf("owner lookups = %v, want 192.0.2.1 and 192.0.2.2", owners.lookups)
+	}
+
+	var combined []string
+	for _, item := range batch.Combined() {
+		combined = append(combined, item.Domain+" "+item.Name)
+	}
+	wantCombined := []string{
+		"example.com api.shop.example.com",
+		"example.org mail.example.org",
+		"example.com www.example.com",
+	}
+	if !reflect.DeepEqual(combined, wantCombined) {
+		t.Errorf("Combined = %v, want %v", combined, wantCombined)
+	}
+
+	if f.cache != nil || f.workers != nil {
+		t.Error("ScanBatch changed the caller's Finder")
+	}
+}
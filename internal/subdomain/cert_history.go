@@ -0,0 +1,189 @@
+// Certificate history and issuance timelines.
+
+package subdomain
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CertTimeline summarises the certificate history of a subdomain.
+type CertTimeline struct {
+	Certificates  int            `json:"certificates"`
+	FirstIssued   time.Time      `json:"first_issued,omitzero"`
+	LastRenewed   time.Time      `json:"last_renewed,omitzero"`
+	LatestExpiry  time.Time      `json:"latest_expiry,omitzero"`
+	Issuers       []string       `json:"issuers,omitempty"`
+	IssuerChanges []IssuerChange `json:"issuer_changes,omitempty"`
+}
+
+// IssuerChange marks the first certificate issued by a different CA than
+// the one before it.
+type IssuerChange struct {
+	At   time.Time `json:"at"`
+	From string    `json:"from"`
+	To   string    `json:"to"`
+}
+
+// CertHistory is the full certificate history of a single host.
+type CertHistory struct {
+	Host         string        `json:"host"`
+	Certificates []Certificate `json:"certificates"`
+	Timeline     CertTimeline  `json:"timeline"`
+}
+
+// CertificateHistory queries the CT sources for certificates naming host
+// exactly and returns them with a derived timeline.
+func (f *Finder) CertificateHistory(ctx context.Context, host string) (*CertHistory, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	normalizedHost, err := normalizeDomain(host)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]Subdomain)
+	var sourceErrs []error
+	if _, err := f.crtShQuery(ctx, normalizedHost, normalizedHost, results); err != nil {
+		sourceErrs = append(sourceErrs, err)
+	}
+	if _, err := f.certSpotterQuery(ctx, normalizedHost, false, normalizedHost, results); err != nil {
+		sourceErrs = append(sourceErrs, err)
+	}
+
+	data, ok := results[normalizedHost]
+	if !ok && len(sourceErrs) > 0 {
+		return nil, errors.Join(sourceErrs...)
+	}
+	data.finalizeCertificates()
+	history := &CertHistory{
+		Host:         normalizedHost,
+		Certificates: data.Certificates,
+	}
+	if data.CertTimeline != nil {
+		history.Timeline = *data.CertTimeline
+	}
+	if history.Certificates == nil {
+		history.Certificates = []Certificate{}
+	}
+	return history, nil
+}
+
+// merge folds other into c. Both describe the same certificate.
+func (c *Certificate) merge(other Certificate) {
+	if c.Serial == "" {
+		c.Serial = other.Serial
+	}
+	if c.Issuer == "" {
+		c.Issuer = other.Issuer
+	}
+	// A precertificate and its final certificate share a serial; once
+	// either source saw the final one, the merged entry is not a precert.
+	if other.Precert != nil && (c.Precert == nil || !*other.Precert) {
+		c.Precert = other.Precert
+	}
+	if other.SANCount > c.SANCount {
+		c.SANCount = other.SANCount
+	}
+	c.LogEntries += other.LogEntries
+}
+
+// ctPoisonOID is the critical extension that marks a precertificate
+// (RFC 6962 section 3.1).
+var ctPoisonOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+// precertFlag reports whether cert carries the CT poison extension.
+func precertFlag(cert *x509.Certificate) *bool {
+	precert := false
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(ctPoisonOID) {
+			precert = true
+			break
+		}
+	}
+	return &precert
+}
+
+// finalizeCertificates sorts the certificates by issuance and rebuilds the
+// timeline.
+func (s *Subdomain) finalizeCertificates() {
+	if len(s.Certificates) == 0 {
+		s.CertTimeline = nil
+		return
+	}
+	sort.SliceStable(s.Certificates, func(i, j int) bool {
+		return s.Certificates[i].NotBefore.Before(s.Certificates[j].NotBefore)
+	})
+	s.CertTimeline = buildCertTimeline(s.Certificates)
+}
+
+func buildCertTimeline(certs []Certificate) *CertTimeline {
+	timeline := &CertTimeline{Certificates: len(certs)}
+	var lastIssuer string
+	for _, cert := range certs {
+		if !cert.NotBefore.IsZero() {
+			if timeline.FirstIssued.IsZero() {
+				timeline.FirstIssued = cert.NotBefore
+			}
+			if cert.NotBefore.After(timeline.LastRenewed) {
+				timeline.LastRenewed = cert.NotBefore
+			}
+		}
+		if cert.NotAfter.After(timeline.LatestExpiry) {
+			timeline.LatestExpiry = cert.NotAfter
+		}
+
+		issuer := issuerOrganization(cert.Issuer)
+		if issuer == "" {
+			continue
+		}
+		if !containsString(timeline.Issuers, issuer) {
+			timeline.Issuers = append(timeline.Issuers, issuer)
+		}
+		if lastIssuer != "" && issuer != lastIssuer {
+			timeline.IssuerChanges = append(timeline.IssuerChanges, IssuerChange{
+				At:   cert.NotBefore,
+				From: lastIssuer,
+				To:   issuer,
+			})
+		}
+		lastIssuer = issuer
+	}
+	return timeline
+}
+
+// issuerOrganization returns the O= component of an issuer DN, so that
+// rotating intermediates of one CA are not reported as issuer changes.
+// Both "C=US, O=X, CN=Y" and "CN=Y,O=X,C=US" orderings are accepted.
+func issuerOrganization(issuer string) string {
+	for _, part := range strings.Split(issuer, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if ok && strings.EqualFold(key, "O") {
+			return strings.Trim(strings.TrimSpace(value), `"`)
+		}
+	}
+	return strings.TrimSpace(issuer)
+}
+
+// normalizeSerial renders a hex serial without separators or leading zeros.
+func normalizeSerial(serial string) string {
+	serial = strings.ToLower(strings.ReplaceAll(serial, ":", ""))
+	serial = strings.TrimLeft(serial, "0")
+	return serial
+}
+
+// serialHex formats a certificate serial the way CT sources report it.
+func serialHex(serial *big.Int) string {
+	if serial == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", serial)
+}
@@ -0,0 +1,159 @@
+package subdomain
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCertDER returns a self-signed certificate for name, marked with the
+// CT poison extension when precert is set.
+func testCertDER(t *testing.T, serial int64, name string, precert bool) []byte {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC),
+	}
+	if precert {
+		template.ExtraExtensions = []pkix.Extension{{Id: ctPoisonOID, Critical: true, Value: []byte{0x05, 0x00}}}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestPrecertFlag(t *testing.T) {
+	for _, precert := range []bool{false, true} {
+		cert, err := x509.ParseCertificate(testCertDER(t, 1, "www.example.com", precert))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := precertFlag(cert); got == nil || *got != precert {
+			t.Errorf("precertFlag = %v, want %v", got, precert)
+		}
+	}
+}
+
+func TestCertificateMergePrecert(t *testing.T) {
+	yes, no := true, false
+	tests := []struct {
+		name        string
+		first, then *bool
+		want        *bool
+	}{
+		{"unknown stays unknown", nil, nil, nil},
+		{"precert learned", nil, &yes, &yes},
+		{"final learned", nil, &no, &no},
+		{"final after precert", &yes, &no, &no},
+		{"precert after final", &no, &yes, &no},
+		{"unknown after precert", &yes, nil, &yes},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Subdomain
+			s.addCertificate(Certificate{Serial: "0a", Precert: tt.first, LogEntries: 1})
+			s.addCertificate(Certificate{Serial: "0A", Precert: tt.then, LogEntries: 1})
+			if len(s.Certificates) != 1 {
+				t.Fatalf("got %d certificates, want 1", len(s.Certificates))
+			}
+			got := s.Certificates[0].Precert
+			if (got == nil) != (tt.want == nil) || got != nil && *got != *tt.want {
+				t.Errorf("Precert = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificateSameAs(t *testing.T) {
+	march := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	may := time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC)
+	le := "C=US, O=Let's Encrypt, CN=R3"
+	tests := []struct {
+		name string
+		a, b Certificate
+		want bool
+	}{
+		{"same serial", Certificate{Serial: "0a", NotBefore: march}, Certificate{Serial: "0a"}, true},
+		{"different serials", Certificate{Serial: "0a", NotBefore: march, NotAfter: may}, Certificate{Serial: "0b", NotBefore: march, NotAfter: may}, false},
+		{"same window", Certificate{Serial: "0a", NotBefore: march, NotAfter: may}, Certificate{NotBefore: march, NotAfter: may}, true},
+		{"issuer formats", Certificate{Issuer: le, NotBefore: march, NotAfter: may}, Certificate{Issuer: "CN=R3,O=Let's Encrypt,C=US", NotBefore: march, NotAfter: may}, true},
+		{"one issuer unknown", Certificate{Issuer: le, NotBefore: march, NotAfter: may}, Certificate{NotBefore: march, NotAfter: may}, true},
+		{"different issuers", Certificate{Issuer: le, NotBefore: march, NotAfter: may}, Certificate{Issuer: "C=US, O=Google Trust Services, CN=WR1", NotBefore: march, NotAfter: may}, false},
+		{"different windows", Certificate{NotBefore: march, NotAfter: may}, Certificate{NotBefore: march, NotAfter: may.Add(time.Hour)}, false},
+		{"zero windows", Certificate{Issuer: le}, Certificate{Issuer: le}, false},
+		{"half a window", Certificate{NotBefore: march}, Certificate{NotBefore: march}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.a.sameAs(tt.b); got != tt.want {
+			t.Errorf("%s: sameAs = %v, want %v", tt.name, got, tt.want)
+		}
+		if got := tt.b.sameAs(tt.a); got != tt.want {
+			t.Errorf("%s (swapped): sameAs = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCertificateHistoryPrecert(t *testing.T) {
+	const host = "www.example.com"
+	precertDER := testCertDER(t, 0x1001, host, true)
+	finalDER := testCertDER(t, 0x2002, host, false)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		// crt.sh knows both certificates but not which is a precert.
+		fmt.Fprintf(w, `[
+			{"name_value":%[1]q,"serial_number":"1001","not_before":"2024-03-01T00:00:00","not_after":"2024-05-30T00:00:00"},
+			{"name_value":%[1]q,"serial_number":"3003","not_before":"2024-06-01T00:00:00","not_after":"2024-08-30T00:00:00"}
+		]`, host)
+	})
+	mux.HandleFunc("GET /v1/issuances", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("after") != "" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		fmt.Fprintf(w, `[
+			{"id":"1","dns_names":[%[1]q],"not_before":"2024-03-01T00:00:00Z","not_after":"2024-05-30T00:00:00Z","cert_der":%[2]q},
+			{"id":"2","dns_names":[%[1]q],"not_before":"2024-03-01T00:00:00Z","not_after":"2024-05-30T00:00:00Z","cert_der":%[3]q}
+		]`, host, base64.StdEncoding.EncodeToString(precertDER), base64.StdEncoding.EncodeToString(finalDER))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	f := NewFinder(WithSourceBaseURL(SourceCrtSh, srv.URL), WithSourceBaseURL(SourceCertSpotter, srv.URL))
+	history, err := f.CertificateHistory(context.Background(), host)
+	if err != nil {
+		t.Fatalf("CertificateHistory: %v", err)
+	}
+
+	want := map[string]string{"1001": "true", "2002": "false", "3003": "unset"}
+	got := make(map[string]string)
+	for _, cert := range history.Certificates {
+		flag := "unset"
+		if cert.Precert != nil {
+			flag = fmt.Sprint(*cert.Precert)
+		}
+		got[cert.Serial] = flag
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("precert flags by serial = %v, want %v", got, want)
+	}
+}
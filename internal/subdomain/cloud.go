@@ -0,0 +1,345 @@
+// Cloud provider, CDN and WAF classification of IPs.
+
+package subdomain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CloudInfo describes where an IP is hosted and whether it is an edge node.
+type CloudInfo struct {
+	IP       string `json:"ip"`
+	Provider string `json:"provider,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Region   string `json:"region,omitempty"`
+	CDN      bool   `json:"cdn,omitempty"`
+	WAF      bool   `json:"waf,omitempty"`
+}
+
+type cloudRange struct {
+	prefix   netip.Prefix
+	provider string
+	service  string
+	region   string
+	cdn      bool
+	waf      bool
+}
+
+// CloudClassifier tags IPs using the IP range files published by cloud and
+// CDN providers.
+type CloudClassifier struct {
+	ranges []cloudRange
+}
+
+// NewCloudClassifier returns an empty classifier. Ranges are added with
+// LoadFile or LoadDir; header hints work without any ranges.
+func NewCloudClassifier() *CloudClassifier {
+	return &CloudClassifier{}
+}
+
+// WithCloudClassifier tags every resolved IP with its hosting provider.
+func WithCloudClassifier(c *CloudClassifier) FinderOption {
+	return func(f *Finder) {
+		f.cloudClassifier = c
+	}
+}
+
+// LoadDir loads every .json file in dir. A file that cannot be loaded is
+// skipped and reported in the returned error; the other files stay loaded.
+func (c *CloudClassifier) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, path := range paths {
+		if err := c.LoadFile(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LoadFile loads a provider range file. The format is detected from its
+// contents: AWS ip-ranges.json, Google cloud.json, Azure service tags, the
+// Cloudflare /ips API response, or the generic
+// {"provider": ..., "prefixes": [{"cidr", "service", "region"}]} layout.
+func (c *CloudClassifier) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	ranges, err := parseCloudRanges(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.ranges = append(c.ranges, ranges...)
+	// Most specific prefix first so lookups can stop at the first match.
+	sort.SliceStable(c.ranges, func(i, j int) bool {
+		return c.ranges[i].prefix.Bits() > c.ranges[j].prefix.Bits()
+	})
+	return nil
+}
+
+type cloudRangeFile struct {
+	// AWS
+	IPv6Prefixes []struct {
+		IPv6Prefix string `json:"ipv6_prefix"`
+		Region     string `json:"region"`
+		Service    string `json:"service"`
+	} `json:"ipv6_prefixes"`
+	// AWS, Google and generic
+	Prefixes []struct {
+		IPPrefix   string `json:"ip_prefix"`
+		IPv4Prefix string `json:"ipv4Prefix"`
+		IPv6Prefix string `json:"ipv6Prefix"`
+		CIDR       string `json:"cidr"`
+		Region     string `json:"region"`
+		Scope      string `json:"scope"`
+		Service    string `json:"service"`
+	} `json:"prefixes"`
+	// Azure
+	Cloud  string `json:"cloud"`
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			Region          string   `json:"region"`
+			SystemService   string   `json:"systemService"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+	// Cloudflare
+	Result *struct {
+		IPv4CIDRs []string `json:"ipv4_cidrs"`
+		IPv6CIDRs []string `json:"ipv6_cidrs"`
+	} `json:"result"`
+	// Generic
+	Provider string `json:"provider"`
+	CDN      bool   `json:"cdn"`
+	WAF      bool   `json:"waf"`
+}
+
+func parseCloudRanges(data []byte) ([]cloudRange, error) {
+	var file cloudRangeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+
+	var ranges []cloudRange
+	add := func(cidr string, r cloudRange) {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return
+		}
+		r.prefix = prefix.Masked()
+		ranges = append(ranges, r)
+	}
+
+	switch {
+	case file.Result != nil:
+		for _, cidr := range append(file.Result.IPv4CIDRs, file.Result.IPv6CIDRs...) {
+			add(cidr, cloudRange{provider: "cloudflare", service: "CDN", cdn: true, waf: true})
+		}
+	case file.Values != nil:
+		for _, tag := range file.Values {
+			service := tag.Properties.SystemService
+			if service == "" {
+				service, _, _ = strings.Cut(tag.Name, ".")
+			}
+			cdn := strings.HasPrefix(tag.Name, "AzureFrontDoor") || service == "AzureCDN"
+			for _, cidr := range tag.Properties.AddressPrefixes {
+				add(cidr, cloudRange{
+					provider: "azure",
+					service:  service,
+					region:   tag.Properties.Region,
+					cdn:      cdn,
+					waf:      strings.HasPrefix(tag.Name, "AzureFrontDoor.Frontend"),
+				})
+			}
+		}
+	case isAWSRangeFile(&file):
+		for _, p := range file.Prefixes {
+			add(p.IPPrefix, awsRange(p.Service, p.Region))
+		}
+		for _, p := range file.IPv6Prefixes {
+			add(p.IPv6Prefix, awsRange(p.Service, p.Region))
+		}
+	case file.Provider != "":
+		for _, p := range file.Prefixes {
+			add(p.CIDR, cloudRange{
+				provider: strings.ToLower(file.Provider),
+				service:  p.Service,
+				region:   p.Region,
+				cdn:      file.CDN,
+				waf:      file.WAF,
+			})
+		}
+	default:
+		for _, p := range file.Prefixes {
+			cidr := p.IPv4Prefix
+			if cidr == "" {
+				cidr = p.IPv6Prefix
+			}
+			add(cidr, cloudRange{provider: "gcp", service: p.Service, region: p.Scope})
+		}
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("no IP ranges found")
+	}
+	return ranges, nil
+}
+
+// isAWSRangeFile tells AWS ip-ranges.json apart from Google's cloud.json,
+// which shares its syncToken and prefixes keys but not the prefix fields.
+func isAWSRangeFile(file *cloudRangeFile) bool {
+	if len(file.IPv6Prefixes) > 0 {
+		return true
+	}
+	for _, p := range file.Prefixes {
+		if p.IPPrefix != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func awsRange(service, region string) cloudRange {
+	return cloudRange{
+		provider: "aws",
+		service:  service,
+		region:   region,
+		cdn:      service == "CLOUDFRONT" || service == "CLOUDFRONT_ORIGIN_FACING",
+	}
+}
+
+// Classify returns the hosting details for ip. Range matches take priority;
+// header hints from an HTTP response fill in CDN and WAF detection.
+func (c *CloudClassifier) Classify(ip netip.Addr, header http.Header) (CloudInfo, bool) {
+	info := CloudInfo{IP: ip.String()}
+	found := false
+
+	if best := c.match(ip.Unmap()); best != nil {
+		info.Provider, info.Service, info.Region = best.provider, best.service, best.region
+		info.CDN, info.WAF = best.cdn, best.waf
+		found = true
+	}
+
+	if hint, ok := cloudHeaderHint(header); ok {
+		if info.Provider == "" {
+			info.Provider = hint.Provider
+			info.Service = hint.Service
+		}
+		info.CDN = info.CDN || hint.CDN
+		info.WAF = info.WAF || hint.WAF
+		found = true
+	}
+	return info, found
+}
+
+// match returns the most specific range containing ip. AWS publishes many
+// prefixes under both AMAZON and a specific service, so the specific entry
+// wins when both have the same length.
+func (c *CloudClassifier) match(ip netip.Addr) *cloudRange {
+	if c == nil {
+		return nil
+	}
+	var best *cloudRange
+	for i := range c.ranges {
+		r := &c.ranges[i]
+		if !r.prefix.Contains(ip) {
+			continue
+		}
+		if best == nil {
+			best = r
+			if r.service != "AMAZON" {
+				break
+			}
+			continue
+		}
+		if r.prefix.Bits() < best.prefix.Bits() {
+			break
+		}
+		if r.service != "AMAZON" {
+			best = r
+			break
+		}
+	}
+	return best
+}
+
+type cloudHint struct {
+	header   string
+	value    string
+	provider string
+	service  string
+	cdn      bool
+	waf      bool
+}
+
+// cloudHeaderHints maps response headers to the edge network that adds
+// them. An empty value only checks for the header's presence.
+var cloudHeaderHints = []cloudHint{
+	{header: "CF-Ray", provider: "cloudflare", service: "CDN", cdn: true, waf: true},
+	{header: "Server", value: "cloudflare", provider: "cloudflare", service: "CDN", cdn: true, waf: true},
+	{header: "X-Amz-Cf-Id", provider: "aws", service: "CLOUDFRONT", cdn: true},
+	{header: "X-Amzn-Waf-Action", provider: "aws", service: "WAF", waf: true},
+	{header: "Server", value: "akamaighost", provider: "akamai", service: "CDN", cdn: true},
+	{header: "X-Akamai-Transformed", provider: "akamai", service: "CDN", cdn: true},
+	{header: "Akamai-GRN", provider: "akamai", service: "CDN", cdn: true},
+	{header: "X-Azure-Ref", provider: "azure", service: "AzureFrontDoor", cdn: true},
+	{header: "Via", value: "google", provider: "gcp", service: "Cloud Load Balancing"},
+	{header: "Server", value: "google frontend", provider: "gcp", service: "Google Frontend"},
+	{header: "X-Served-By", value: "cache-", provider: "fastly", service: "CDN", cdn: true},
+	{header: "Fastly-Debug-Digest", provider: "fastly", service: "CDN", cdn: true},
+	{header: "X-Sucuri-ID", provider: "sucuri", service: "WAF", cdn: true, waf: true},
+	{header: "X-Iinfo", provider: "imperva", service: "WAF", cdn: true, waf: true},
+	{header: "X-CDN", value: "imperva", provider: "imperva", service: "WAF", cdn: true, waf: true},
+}
+
+func cloudHeaderHint(header http.Header) (CloudInfo, bool) {
+	if header == nil {
+		return CloudInfo{}, false
+	}
+	for _, hint := range cloudHeaderHints {
+		for _, value := range header.Values(hint.header) {
+			if hint.value != "" && !strings.Contains(strings.ToLower(value), hint.value) {
+				continue
+			}
+			return CloudInfo{
+				Provider: hint.provider,
+				Service:  hint.service,
+				CDN:      hint.cdn,
+				WAF:      hint.waf,
+			}, true
+		}
+	}
+	return CloudInfo{}, false
+}
+
+// classifyResults tags each resolved IP with hosting details, using HTTP
+// probe headers when probing has run.
+func (f *Finder) classifyResults(results map[string]Subdomain, probes map[string]*httpProbe) {
+	for name, data := range results {
+		var header http.Header
+		if probe, ok := probes[name]; ok {
+			header = probe.Header
+		}
+		for i := range data.IPs {
+			addr, err := netip.ParseAddr(data.IPs[i].Address)
+			if err != nil {
+				continue
+			}
+			if info, ok := f.cloudClassifier.Classify(addr, header); ok {
+				data.IPs[i].Cloud = &info
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package subdomain
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Trimmed copies of the published range files.
+const (
+	awsRanges = `{
+  "syncToken": "1718920387",
+  "createDate": "2024-06-20-21-53-07",
+  "prefixes": [
+    {"ip_prefix": "3.2.34.0/26", "region": "af-south-1", "service": "AMAZON", "network_border_group": "af-south-1"},
+    {"ip_prefix": "13.32.0.0/15", "region": "GLOBAL", "service": "CLOUDFRONT", "network_border_group": "GLOBAL"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f14:fff:f800::/56", "region": "us-west-2", "service": "ROUTE53_HEALTHCHECKS", "network_border_group": "us-west-2"}
+  ]
+}`
+	gcpRanges = `{
+  "syncToken": "1718899328193",
+  "creationTime": "2024-06-20T09:02:08.19397",
+  "prefixes": [
+    {"ipv4Prefix": "34.1.208.0/20", "service": "Google Cloud", "scope": "africa-south1"},
+    {"ipv6Prefix": "2600:1900:8000::/44", "service": "Google Cloud", "scope": "us-central1"}
+  ]
+}`
+	azureRanges = `{
+  "changeNumber": 289,
+  "cloud": "Public",
+  "values": [
+    {
+      "name": "AzureFrontDoor.Frontend",
+      "id": "AzureFrontDoor.Frontend",
+      "properties": {"changeNumber": 12, "region": "", "regionId": 0, "platform": "Azure", "systemService": "AzureFrontDoor", "addressPrefixes": ["13.107.246.0/24", "2620:1ec:bdf::/48"]}
+    },
+    {
+      "name": "Storage.WestEurope",
+      "id": "Storage.WestEurope",
+      "properties": {"changeNumber": 40, "region": "westeurope", "regionId": 18, "platform": "Azure", "systemService": "AzureStorage", "addressPrefixes": ["20.38.108.0/23"]}
+    }
+  ]
+}`
+	cloudflareRanges = `{
+  "result": {
+    "ipv4_cidrs": ["104.16.0.0/13"],
+    "ipv6_cidrs": ["2606:4700::/32"],
+    "etag": "38f79d050aa027e3be3865e495dcc9bc"
+  },
+  "success": true,
+  "errors": [],
+  "messages": []
+}`
+	genericRanges = `{
+  "provider": "Fastly",
+  "cdn": true,
+  "prefixes": [
+    {"cidr": "151.101.0.0/16", "service": "CDN"},
+    {"cidr": "2a04:4e40::/32", "service": "CDN", "region": "global"}
+  ]
+}`
+)
+
+func TestParseCloudRanges(t *testing.T) {
+	type want struct {
+		prefix, provider, service, region string
+		cdn, waf                          bool
+	}
+	tests := []struct {
+		name    string
+		data    string
+		want    []want
+		wantErr bool
+	}{
+		{name: "aws", data: awsRanges, want: []want{
+			{"3.2.34.0/26", "aws", "AMAZON", "af-south-1", false, false},
+			{"13.32.0.0/15", "aws", "CLOUDFRONT", "GLOBAL", true, false},
+			{"2600:1f14:fff:f800::/56", "aws", "ROUTE53_HEALTHCHECKS", "us-west-2", false, false},
+		}},
+		{name: "gcp", data: gcpRanges, want: []want{
+			{"34.1.208.0/20", "gcp", "Google Cloud", "africa-south1", false, false},
+			{"2600:1900:8000::/44", "gcp", "Google Cloud", "us-central1", false, false},
+		}},
+		{name: "azure", data: azureRanges, want: []want{
+			{"13.107.246.0/24", "azure", "AzureFrontDoor", "", true, true},
+			{"2620:1ec:bdf::/48", "azure", "AzureFrontDoor", "", true, true},
+			{"20.38.108.0/23", "azure", "AzureStorage", "westeurope", false, false},
+		}},
+		{name: "cloudflare", data: cloudflareRanges, want: []want{
+			{"104.16.0.0/13", "cloudflare", "CDN", "", true, true},
+			{"2606:4700::/32", "cloudflare", "CDN", "", true, true},
+		}},
+		{name: "generic", data: genericRanges, want: []want{
+			{"151.101.0.0/16", "fastly", "CDN", "", true, false},
+			{"2a04:4e40::/32", "fastly", "CDN", "global", true, false},
+		}},
+		{name: "no ranges", data: `{"syncToken": "1", "prefixes": []}`, wantErr: true},
+		{name: "not json", data: `<html>`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges, err := parseCloudRanges([]byte(tt.data))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseCloudRanges = %d ranges, want an error", len(ranges))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseCloudRanges: %v", err)
+			}
+			var got []want
+			for _, r := range ranges {
+				got = append(got, want{r.prefix.String(), r.provider, r.service, r.region, r.cdn, r.waf})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ranges =\n%+v\nwant\n%+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCloudClassifierLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"aws.json":    awsRanges,
+		"gcp.json":    gcpRanges,
+		"broken.json": `{"unexpected": true}`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := NewCloudClassifier()
+	if err := c.LoadDir(dir); err == nil {
+		t.Error("LoadDir did not report the broken file")
+	}
+
+	tests := []struct {
+		ip, provider, service string
+	}{
+		{"3.2.34.10", "aws", "AMAZON"},
+		{"13.33.1.1", "aws", "CLOUDFRONT"},
+		{"34.1.210.1", "gcp", "Google Cloud"},
+		{"198.51.100.1", "", ""},
+	}
+	for _, tt := range tests {
+		info, _ := c.Classify(netip.MustParseAddr(tt.ip), nil)
+		if info.Provider != tt.provider || info.Service != tt.service {
+			t.Errorf("Classify(%s) = %s/%s, want %s/%s", tt.ip, info.Provider, info.Service, tt.provider, tt.service)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// Source attribution and confidence scoring.
+
+package subdomain
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Discovery records what a single source reported about a subdomain.
+type Discovery struct {
+	Source    string    `json:"source"`
+	Count     int       `json:"count"`
+	FirstSeen time.Time `json:"first_seen,omitzero"`
+	LastSeen  time.Time `json:"last_seen,omitzero"`
+	// Datasets and Via are set for imported names: the files they came
+	// from and the upstream sources those tools credited.
+	Datasets []string `json:"datasets,omitempty"`
+	Via      []string `json:"via,omitempty"`
+}
+
+// sourceWeights is how much a single report from each source is trusted.
+// Live certificates are the strongest signal; unknown sources get
+// defaultSourceWeight.
+var sourceWeights = map[string]float64{
+	SourceCrtSh:       0.5,
+	SourceCertSpotter: 0.5,
+	SourceTLS:         0.7,
+
+	SourceVirusTotal:     0.4,
+	SourceSecurityTrails: 0.4,
+	SourceShodan:         0.4,
+	SourceCensys:         0.5,
+
+	// Archived URLs may be years old.
+	SourceWayback:     0.25,
+	SourceCommonCrawl: 0.25,
+
+	SourceImport:     0.4,
+	SourceDNSRecords: 0.6,
+	SourceSRV:        0.6,
+
+	// PTR records are set by whoever runs the network and go stale; the
+	// sweep only keeps names that resolve back to the same address.
+	SourcePTR:      0.45,
+	SourcePTRSweep: 0.6,
+}
+
+const (
+	defaultSourceWeight = 0.3
+
+	// Share of the final score contributed by each signal.
+	confidenceSourceShare     = 0.55
+	confidenceResolutionShare = 0.25
+	confidenceLivenessShare   = 0.20
+)
+
+// recordDiscovery adds a report from source at t to s.Discoveries.
+func (s *Subdomain) recordDiscovery(source string, t time.Time) {
+	for i := range s.Discoveries {
+		d := &s.Discoveries[i]
+		if d.Source != source {
+			continue
+		}
+		d.Count++
+		if !t.IsZero() && (d.FirstSeen.IsZero() || t.Before(d.FirstSeen)) {
+			d.FirstSeen = t
+		}
+		if t.After(d.LastSeen) {
+			d.LastSeen = t
+		}
+		return
+	}
+	s.Discoveries = append(s.Discoveries, Discovery{Source: source, Count: 1, FirstSeen: t, LastSeen: t})
+	sort.Slice(s.Discoveries, func(i, j int) bool {
+		return s.Discoveries[i].Source < s.Discoveries[j].Source
+	})
+}
+
+// scoreConfidence rates how likely s is a real, in-use name. Independent
+// sources are combined as 1-Π(1-w), then resolution and liveness add fixed
+// shares. The result is rounded to two decimals.
+func (s Subdomain) scoreConfidence() float64 {
+	miss := 1.0
+	for _, d := range s.Discoveries {
+		weight, ok := sourceWeights[d.Source]
+		if !ok {
+			weight = defaultSourceWeight
+		}
+		miss *= 1 - weight
+	}
+	score := confidenceSourceShare * (1 - miss)
+	if len(s.IPs) > 0 {
+		score += confidenceResolutionShare
+	}
+	if s.Alive {
+		score += confidenceLivenessShare
+	}
+	return math.Round(score*100) / 100
+}
+
+// scoreResults computes liveness and confidence for every result.
+func scoreResults(results map[string]Subdomain, probes map[string]*httpProbe) {
+	for name, data := range results {
+		if _, ok := probes[name]; ok {
+			data.Alive = true
+		}
+		for _, ip := range data.IPs {
+			if len(ip.Ports) > 0 {
+				data.Alive = true
+			}
+		}
+		data.Confidence = data.scoreConfidence()
+		results[name] = data
+	}
+}
+
+// ResultFilter selects subdomains by source and confidence.
+type ResultFilter struct {
+	// Sources keeps names reported by at least one of these sources. An
+	// empty list keeps every name.
+	Sources []string
+	// MinConfidence drops names scoring below this value.
+	MinConfidence float64
+}
+
+// Match reports whether s passes the filter.
+func (rf ResultFilter) Match(s Subdomain) bool {
+	if s.Confidence < rf.MinConfidence {
+		return false
+	}
+	if len(rf.Sources) == 0 {
+		return true
+	}
+	for _, d := range s.Discoveries {
+		if containsString(rf.Sources, d.Source) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the subset of results that pass the filter.
+func (rf ResultFilter) Apply(results map[string]Subdomain) map[string]Subdomain {
+	out := make(map[string]Subdomain, len(results))
+	for name, data := range results {
+		if rf.Match(data) {
+			out[name] = data
+		}
+	}
+	return out
+}
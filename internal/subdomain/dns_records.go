@@ -0,0 +1,421 @@
+// Discovery from mail, delegation and verification records: SPF include
+// chains, DMARC report addresses, MX and NS targets and TXT tokens.
+
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SourceDNSRecords reports names found in the domain's own DNS records.
+const SourceDNSRecords = "dns-records"
+
+// spfLookupLimit is the RFC 7208 section 4.6.4 cap on mechanisms and
+// modifiers that trigger DNS lookups during SPF evaluation.
+const spfLookupLimit = 10
+
+// Kinds of record a RecordFinding can come from.
+const (
+	RecordSPF   = "spf"
+	RecordMX    = "mx"
+	RecordNS    = "ns"
+	RecordDMARC = "dmarc"
+	RecordTXT   = "txt"
+)
+
+// RecordFinding is a value read from a DNS record that points at a host or
+// reveals a third-party service.
+type RecordFinding struct {
+	Record string `json:"record"`
+	// Name is the owner name the record was read from.
+	Name string `json:"name"`
+	// Value is the include, target host, report address or token.
+	Value   string `json:"value"`
+	Service string `json:"service,omitempty"`
+	// InScope is set when Value is a host under the scanned domain that
+	// the configured scope allows; only those are added as names.
+	InScope bool `json:"in_scope,omitempty"`
+}
+
+// serviceHint maps a host suffix or TXT token prefix to the service it
+// reveals.
+type serviceHint struct {
+	pattern string
+	service string
+}
+
+// mailServiceHints match SPF includes, MX targets and DMARC report
+// addresses by domain suffix.
+var mailServiceHints = []serviceHint{
+	{"_spf.google.com", "Google Workspace"},
+	{"google.com", "Google Workspace"},
+	{"googlemail.com", "Google Workspace"},
+	{"outlook.com", "Microsoft 365"},
+	{"sendgrid.net", "SendGrid"},
+	{"mailgun.org", "Mailgun"},
+	{"amazonses.com", "Amazon SES"},
+	{"mcsv.net", "Mailchimp"},
+	{"mandrillapp.com", "Mandrill"},
+	{"salesforce.com", "Salesforce"},
+	{"zendesk.com", "Zendesk"},
+	{"mtasv.net", "Postmark"},
+	{"postmarkapp.com", "Postmark"},
+	{"sparkpostmail.com", "SparkPost"},
+	{"freshdesk.com", "Freshdesk"},
+	{"helpscoutemail.com", "Help Scout"},
+	{"hubspotemail.net", "HubSpot"},
+	{"zoho.com", "Zoho Mail"},
+	{"zoho.eu", "Zoho Mail"},
+	{"mimecast.com", "Mimecast"},
+	{"pphosted.com", "Proofpoint"},
+	{"messagelabs.com", "Broadcom Email Security"},
+	{"messagingengine.com", "Fastmail"},
+}
+
+// dnsServiceHints match NS targets by domain suffix.
+var dnsServiceHints = []serviceHint{
+	{"google.com", "Google Cloud DNS"},
+	{"cloudflare.com", "Cloudflare DNS"},
+	{"azure-dns.com", "Azure DNS"},
+	{"azure-dns.net", "Azure DNS"},
+	{"googledomains.com", "Google Domains"},
+	{"domaincontrol.com", "GoDaddy DNS"},
+	{"nsone.net", "NS1"},
+	{"dynect.net", "Oracle Dyn"},
+	{"ultradns.com", "UltraDNS"},
+	{"ultradns.net", "UltraDNS"},
+	{"akam.net", "Akamai Edge DNS"},
+}
+
+// dmarcServiceHints match DMARC report addresses of report processors;
+// mail providers are matched too.
+var dmarcServiceHints = []serviceHint{
+	{"dmarcian.com", "dmarcian"},
+	{"agari.com", "Agari"},
+	{"vali.email", "Valimail"},
+	{"valimail.com", "Valimail"},
+	{"ondmarc.com", "Red Sift OnDMARC"},
+	{"powerdmarc.com", "PowerDMARC"},
+	{"easydmarc.us", "EasyDMARC"},
+	{"uriports.com", "URIports"},
+}
+
+// hostServiceHints lists the hints for each kind of record. The same
+// domain can stand for different services: google.com is Google Workspace
+// in an MX record and Google Cloud DNS in an NS record.
+var hostServiceHints = map[string][][]serviceHint{
+	RecordSPF:   {mailServiceHints},
+	RecordMX:    {mailServiceHints},
+	RecordNS:    {dnsServiceHints},
+	RecordDMARC: {dmarcServiceHints, mailServiceHints},
+}
+
+// tokenServiceHints match verification tokens in apex TXT records by
+// case-insensitive prefix.
+var tokenServiceHints = []serviceHint{
+	{"google-site-verification=", "Google"},
+	{"ms=", "Microsoft 365"},
+	{"facebook-domain-verification=", "Facebook"},
+	{"atlassian-domain-verification=", "Atlassian"},
+	{"docusign=", "DocuSign"},
+	{"apple-domain-verification=", "Apple"},
+	{"adobe-idp-site-verification=", "Adobe"},
+	{"zoom_verify_", "Zoom"},
+	{"stripe-verification=", "Stripe"},
+	{"globalsign-domain-verification=", "GlobalSign"},
+	{"dropbox-domain-verification=", "Dropbox"},
+	{"slack-domain-verification=", "Slack"},
+	{"onetrust-domain-verification=", "OneTrust"},
+	{"cisco-ci-domain-verification=", "Cisco Webex"},
+	{"yandex-verification:", "Yandex"},
+	{"miro-verification=", "Miro"},
+	{"citrix-verification-code=", "Citrix"},
+	{"knowbe4-site-verification=", "KnowBe4"},
+	{"have-i-been-pwned-verification=", "Have I Been Pwned"},
+	{"amazonses:", "Amazon SES"},
+}
+
+// WithDNSRecordMining enables the source that mines SPF, DMARC, MX, NS and
+// TXT records for hosts and third-party services.
+func WithDNSRecordMining(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.mineDNSRecords = enabled
+	}
+}
+
+func (f *Finder) dnsRecordSources() []discoverySource {
+	if !f.mineDNSRecords {
+		return nil
+	}
+	return []discoverySource{{SourceDNSRecords, f.collectFromDNSRecords}}
+}
+
+// recordMiner accumulates what a mining run found.
+type recordMiner struct {
+	f        *Finder
+	domain   string
+	results  map[string]Subdomain
+	findings []RecordFinding
+	seen     time.Time
+	lookups  int
+	failures []error
+}
+
+// collectFromDNSRecords reads the apex TXT, MX and NS records and the
+// DMARC policy, following SPF includes. The run fails only when every
+// lookup failed for a reason other than the record not existing.
+func (f *Finder) collectFromDNSRecords(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	m := &recordMiner{f: f, domain: domain, results: results, seen: time.Now().UTC()}
+	var run sourceRun
+
+	txt, err := m.lookupTXT(ctx, domain)
+	if err == nil {
+		m.mineTokens(domain, txt)
+		if spf := spfRecord(txt); spf != "" {
+			budget := spfLookupLimit
+			run.capped = m.followSPF(ctx, domain, spf, &budget, map[string]bool{domain: true})
+		}
+	}
+	m.mineMX(ctx)
+	m.mineNS(ctx)
+	m.mineDMARC(ctx)
+
+	run.records = m.findings
+	if m.lookups > 0 && len(m.failures) == m.lookups {
+		return run, errors.Join(m.failures...)
+	}
+	return run, nil
+}
+
+// note records a finding and adds its value as a name when it is an
+// in-scope host under the scanned domain.
+func (m *recordMiner) note(record, name, value, service string, host bool) {
+	finding := RecordFinding{Record: record, Name: name, Value: value, Service: service}
+	if host {
+		if target := normalizeName(value); isSubdomainOf(target, m.domain) && m.allowed(target) {
+			finding.InScope = true
+			addSubdomain(m.results, target, SourceDNSRecords, m.seen, nil)
+		}
+	}
+	m.findings = append(m.findings, finding)
+}
+
+// allowed checks a host under the scanned domain against the scope.
+func (m *recordMiner) allowed(host string) bool {
+	ok, reason := m.f.scope.CheckHost(host)
+	if !ok && m.f.debug {
+		log.Printf("[DEBUG] Ignoring %s from DNS records: %s", host, reason)
+	}
+	return ok
+}
+
+func (m *recordMiner) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	if m.f.debug {
+		log.Printf("[DEBUG] TXT lookup: %s", name)
+	}
+	txt, err := m.f.resolver.LookupTXT(ctx, name)
+	m.record(err)
+	return txt, err
+}
+
+// record counts a top-level lookup and keeps its error unless the record
+// simply does not exist.
+func (m *recordMiner) record(err error) {
+	m.lookups++
+	if err != nil && !isDNSNotFound(err) {
+		m.failures = append(m.failures, err)
+	}
+}
+
+// followSPF walks an SPF record, noting every host it references and
+// recursing into include and redirect targets. It reports true when the
+// lookup budget ran out before the chain was fully walked.
+func (m *recordMiner) followSPF(ctx context.Context, owner, record string, budget *int, visited map[string]bool) bool {
+	capped := false
+	for _, term := range strings.Fields(record)[1:] {
+		mechanism, target := splitSPFTerm(term)
+		switch mechanism {
+		case "include", "redirect", "a", "mx", "exists", "ptr":
+		default:
+			continue
+		}
+		if *budget <= 0 {
+			if m.f.debug {
+				log.Printf("[DEBUG] SPF lookup limit reached under %s", owner)
+			}
+			return true
+		}
+		*budget--
+
+		// Macros expand at evaluation time and cannot be followed.
+		if target == "" || strings.Contains(target, "%") {
+			continue
+		}
+		m.note(RecordSPF, owner, target, matchServiceHost(RecordSPF, target), true)
+
+		if mechanism != "include" && mechanism != "redirect" {
+			continue
+		}
+		target = normalizeName(target)
+		if visited[target] {
+			continue
+		}
+		visited[target] = true
+		// Third-party includes are always followed; hosts under the
+		// scanned domain only when in scope.
+		if isSubdomainOf(target, m.domain) && !m.allowed(target) {
+			continue
+		}
+		txt, err := m.f.resolver.LookupTXT(ctx, target)
+		if err != nil {
+			continue
+		}
+		if nested := spfRecord(txt); nested != "" && m.followSPF(ctx, target, nested, budget, visited) {
+			capped = true
+		}
+	}
+	return capped
+}
+
+// splitSPFTerm returns the mechanism or modifier name of an SPF term and
+// its domain argument, dropping any qualifier and CIDR length.
+func splitSPFTerm(term string) (string, string) {
+	term = strings.TrimLeft(strings.ToLower(term), "+-~?")
+	var name, arg string
+	if i := strings.IndexAny(term, ":="); i >= 0 {
+		name, arg = term[:i], term[i+1:]
+	} else {
+		name = term
+	}
+	if i := strings.Index(name, "/"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.Index(arg, "/"); i >= 0 {
+		arg = arg[:i]
+	}
+	return name, arg
+}
+
+// spfRecord returns the SPF policy among TXT strings, if any.
+func spfRecord(txt []string) string {
+	for _, value := range txt {
+		value = strings.TrimSpace(value)
+		if strings.EqualFold(value, "v=spf1") || strings.HasPrefix(strings.ToLower(value), "v=spf1 ") {
+			return value
+		}
+	}
+	return ""
+}
+
+// mineTokens notes apex TXT values that verify the domain with a service.
+func (m *recordMiner) mineTokens(owner string, txt []string) {
+	for _, value := range txt {
+		lower := strings.ToLower(strings.TrimSpace(value))
+		for _, hint := range tokenServiceHints {
+			if strings.HasPrefix(lower, hint.pattern) {
+				m.note(RecordTXT, owner, value, hint.service, false)
+				break
+			}
+		}
+	}
+}
+
+func (m *recordMiner) mineMX(ctx context.Context) {
+	records, err := m.f.resolver.LookupMX(ctx, m.domain)
+	m.record(err)
+	if err != nil {
+		return
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Pref < records[j].Pref })
+	for _, mx := range records {
+		host := normalizeName(mx.Host)
+		if host == "" {
+			continue
+		}
+		m.note(RecordMX, m.domain, host, matchServiceHost(RecordMX, host), true)
+	}
+}
+
+func (m *recordMiner) mineNS(ctx context.Context) {
+	records, err := m.f.resolver.LookupNS(ctx, m.domain)
+	m.record(err)
+	if err != nil {
+		return
+	}
+	for _, ns := range records {
+		host := normalizeName(ns.Host)
+		if host == "" {
+			continue
+		}
+		m.note(RecordNS, m.domain, host, matchServiceHost(RecordNS, host), true)
+	}
+}
+
+// mineDMARC notes the hosts receiving aggregate (rua) and forensic (ruf)
+// reports.
+func (m *recordMiner) mineDMARC(ctx context.Context) {
+	owner := "_dmarc." + m.domain
+	txt, err := m.lookupTXT(ctx, owner)
+	if err != nil {
+		return
+	}
+	for _, value := range txt {
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "v=dmarc1") {
+			continue
+		}
+		for _, tag := range strings.Split(value, ";") {
+			key, uris, ok := strings.Cut(strings.TrimSpace(tag), "=")
+			if !ok || (!strings.EqualFold(key, "rua") && !strings.EqualFold(key, "ruf")) {
+				continue
+			}
+			for _, uri := range strings.Split(uris, ",") {
+				address := strings.TrimSpace(uri)
+				if len(address) >= 7 && strings.EqualFold(address[:7], "mailto:") {
+					address = address[7:]
+				}
+				// A "!size" suffix limits report size.
+				address, _, _ = strings.Cut(address, "!")
+				_, host, ok := strings.Cut(address, "@")
+				if !ok || host == "" {
+					continue
+				}
+				m.note(RecordDMARC, owner, host, matchServiceHost(RecordDMARC, host), true)
+			}
+		}
+	}
+}
+
+// matchServiceHost returns the service whose domain host, read from a
+// record of the given kind, falls under. Route 53 nameservers live under
+// numbered domains (awsdns-NN.com and similar) and Google Cloud DNS under
+// ns-cloud-*.googledomains.com, so they are matched separately.
+func matchServiceHost(record, host string) string {
+	host = normalizeName(host)
+	if record == RecordNS {
+		switch {
+		case strings.Contains(host, ".awsdns-"):
+			return "Amazon Route 53"
+		case strings.HasPrefix(host, "ns-cloud-") && strings.HasSuffix(host, ".googledomains.com"):
+			return "Google Cloud DNS"
+		}
+	}
+	for _, hints := range hostServiceHints[record] {
+		for _, hint := range hints {
+			if host == hint.pattern || strings.HasSuffix(host, "."+hint.pattern) {
+				return hint.service
+			}
+		}
+	}
+	return ""
+}
+
+func isDNSNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,288 @@
+package subdomain
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsZone holds the answers of a test DNS server and counts the queries
+// it receives. ptr is keyed by IPv4 address. Names in no map get NXDOMAIN.
+type dnsZone struct {
+	txt map[string]string
+	a   map[string][]string
+	ptr map[string][]string
+
+	mu      sync.Mutex
+	queries map[string]int
+}
+
+// count returns how many queries of type qtype name received.
+func (z *dnsZone) count(name string, qtype dnsmessage.Type) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return z.queries[name+" "+qtype.String()]
+}
+
+func (z *dnsZone) answer(q dnsmessage.Question) ([]dnsmessage.Resource, bool) {
+	name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	z.mu.Lock()
+	if z.queries == nil {
+		z.queries = make(map[string]int)
+	}
+	z.queries[name+" "+q.Type.String()]++
+	z.mu.Unlock()
+
+	txt, hasTXT := z.txt[name]
+	addrs, hasA := z.a[name]
+	var ptrs []string
+	hasPTR := false
+	for addr, names := range z.ptr {
+		if reverseName(addr) == name {
+			ptrs, hasPTR = names, true
+		}
+	}
+	header := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+	var answers []dnsmessage.Resource
+	switch q.Type {
+	case dnsmessage.TypeTXT:
+		if hasTXT {
+			answers = append(answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.TXTResource{TXT: []string{txt}}})
+		}
+	case dnsmessage.TypeA:
+		for _, addr := range addrs {
+			answers = append(answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: netip.MustParseAddr(addr).As4()}})
+		}
+	case dnsmessage.TypePTR:
+		for _, ptr := range ptrs {
+			answers = append(answers, dnsmessage.Resource{Header: header, Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(ptr + ".")}})
+		}
+	}
+	return answers, hasTXT || hasA || hasPTR
+}
+
+// reverseName returns the in-addr.arpa name of an IPv4 address.
+func reverseName(addr string) string {
+	octets := netip.MustParseAddr(addr).As4()
+	return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", octets[3], octets[2], octets[1], octets[0])
+}
+
+// dnsStandIn serves zone over UDP and returns a resolver that talks only
+// to it.
+func dnsStandIn(t *testing.T, zone *dnsZone) *net.Resolver {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var p dnsmessage.Parser
+			header, err := p.Start(buf[:n])
+			if err != nil {
+				continue
+			}
+			q, err := p.Question()
+			if err != nil {
+				continue
+			}
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true},
+				Questions: []dnsmessage.Question{q},
+			}
+			answers, exists := zone.answer(q)
+			if !exists {
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+			resp.Answers = answers
+			if out, err := resp.Pack(); err == nil {
+				conn.WriteTo(out, addr)
+			}
+		}
+	}()
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+}
+
+func TestFollowSPF(t *testing.T) {
+	zone := map[string]string{
+		"_spf.partner.test":     "v=spf1 include:_spf.google.com ip4:192.0.2.0/24 -all",
+		"_spf.google.com":       "v=spf1 include:_netblocks.google.com ~all",
+		"_netblocks.google.com": "v=spf1 ip4:198.51.100.0/24 ~all",
+		"spf.example.com":       "v=spf1 a:relay.example.com include:loop.test -all",
+		"loop.test":             "v=spf1 include:spf.example.com -all",
+		"internal.example.com":  "v=spf1 a:hidden.example.com -all",
+	}
+	resolver := dnsStandIn(t, &dnsZone{txt: zone})
+
+	var overBudget []string
+	for i := 0; i <= spfLookupLimit; i++ {
+		overBudget = append(overBudget, fmt.Sprintf("a:h%02d.example.com", i))
+	}
+
+	tests := []struct {
+		name   string
+		record string
+		scope  *Scope
+		// wantValues are the noted finding values, in order.
+		wantValues []string
+		wantHosts  []string
+		wantCapped bool
+	}{
+		{
+			name:       "third-party chain",
+			record:     "v=spf1 include:_spf.partner.test -all",
+			wantValues: []string{"_spf.partner.test", "_spf.google.com", "_netblocks.google.com"},
+		},
+		{
+			name:       "loop through an in-domain include",
+			record:     "v=spf1 include:spf.example.com mx -all",
+			wantValues: []string{"spf.example.com", "relay.example.com", "loop.test", "spf.example.com"},
+			wantHosts:  []string{"relay.example.com", "spf.example.com"},
+		},
+		{
+			name:       "out of scope include is not followed",
+			record:     "v=spf1 include:internal.example.com -all",
+			scope:      &Scope{Exclude: []string{"internal.example.com"}},
+			wantValues: []string{"internal.example.com"},
+		},
+		{
+			name:       "macros are skipped",
+			record:     "v=spf1 exists:%{i}._spf.example.com -all",
+			wantValues: nil,
+		},
+		{
+			name:       "lookup budget",
+			record:     "v=spf1 " + strings.Join(overBudget, " ") + " -all",
+			wantValues: hostsFromTerms(overBudget[:spfLookupLimit]),
+			wantHosts:  hostsFromTerms(overBudget[:spfLookupLimit]),
+			wantCapped: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []FinderOption{WithResolver(resolver)}
+			if tt.scope != nil {
+				if err := tt.scope.Compile(); err != nil {
+					t.Fatal(err)
+				}
+				opts = append(opts, WithScope(tt.scope))
+			}
+			m := &recordMiner{f: NewFinder(opts...), domain: "example.com", results: make(map[string]Subdomain), seen: time.Now()}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			budget := spfLookupLimit
+			capped := m.followSPF(ctx, "example.com", tt.record, &budget, map[string]bool{"example.com": true})
+			if capped != tt.wantCapped {
+				t.Errorf("capped = %v, want %v", capped, tt.wantCapped)
+			}
+
+			var values []string
+			for _, finding := range m.findings {
+				values = append(values, finding.Value)
+			}
+			if !reflect.DeepEqual(values, tt.wantValues) {
+				t.Errorf("values = %v, want %v", values, tt.wantValues)
+			}
+			var hosts []string
+			for name := range m.results {
+				hosts = append(hosts, name)
+			}
+			sort.Strings(hosts)
+			if !reflect.DeepEqual(hosts, tt.wantHosts) {
+				t.Errorf("hosts = %v, want %v", hosts, tt.wantHosts)
+			}
+		})
+	}
+}
+
+func hostsFromTerms(terms []string) []string {
+	hosts := make([]string, len(terms))
+	for i, term := range terms {
+		_, hosts[i] = splitSPFTerm(term)
+	}
+	return hosts
+}
+
+func TestSplitSPFTerm(t *testing.T) {
+	tests := []struct {
+		term, wantName, wantArg string
+	}{
+		{"include:_spf.google.com", "include", "_spf.google.com"},
+		{"-Include:Example.COM", "include", "example.com"},
+		{"~a:mail.example.com/24", "a", "mail.example.com"},
+		{"mx/24", "mx", ""},
+		{"redirect=_spf.example.com", "redirect", "_spf.example.com"},
+		{"?all", "all", ""},
+		{"ip4:192.0.2.0/24", "ip4", "192.0.2.0"},
+	}
+	for _, tt := range tests {
+		if name, arg := splitSPFTerm(tt.term); name != tt.wantName || arg != tt.wantArg {
+			t.Errorf("splitSPFTerm(%q) = %q, %q; want %q, %q", tt.term, name, arg, tt.wantName, tt.wantArg)
+		}
+	}
+}
+
+func TestSPFRecord(t *testing.T) {
+	tests := []struct {
+		name string
+		txt  []string
+		want string
+	}{
+		{"none", []string{"google-site-verification=abc"}, ""},
+		{"found", []string{"ms=123", " v=spf1 -all "}, "v=spf1 -all"},
+		{"bare", []string{"V=SPF1"}, "V=SPF1"},
+		{"other version", []string{"v=spf10 -all"}, ""},
+	}
+	for _, tt := range tests {
+		if got := spfRecord(tt.txt); got != tt.want {
+			t.Errorf("%s: spfRecord = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchServiceHost(t *testing.T) {
+	tests := []struct {
+		record, host, want string
+	}{
+		{RecordMX, "aspmx.l.google.com.", "Google Workspace"},
+		{RecordNS, "ns1.google.com", "Google Cloud DNS"},
+		{RecordSPF, "_spf.google.com", "Google Workspace"},
+		{RecordNS, "ns-1234.awsdns-56.org", "Amazon Route 53"},
+		{RecordMX, "ns-1234.awsdns-56.org", ""},
+		{RecordNS, "ns-cloud-a1.googledomains.com", "Google Cloud DNS"},
+		{RecordNS, "ns1.googledomains.com", "Google Domains"},
+		{RecordDMARC, "rua.dmarcian.com", "dmarcian"},
+		{RecordDMARC, "example.mail.protection.outlook.com", "Microsoft 365"},
+		{RecordMX, "notgoogle.com", ""},
+		{RecordTXT, "google.com", ""},
+	}
+	for _, tt := range tests {
+		if got := matchServiceHost(tt.record, tt.host); got != tt.want {
+			t.Errorf("matchServiceHost(%s, %q) = %q, want %q", tt.record, tt.host, got, tt.want)
+		}
+	}
+}
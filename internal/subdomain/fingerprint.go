@@ -0,0 +1,357 @@
+// Technology fingerprinting of HTTP probe responses.
+
+package subdomain
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+//go:embed data/fingerprints.json
+var defaultFingerprintRules []byte
+
+// Technology is a product detected on a host.
+type Technology struct {
+	Name     string `json:"name"`
+	Version  string `json:"version,omitempty"`
+	Category string `json:"category,omitempty"`
+}
+
+// FingerprintRule describes how to recognise a single technology. Pattern
+// values are regular expressions; an empty header, cookie or meta pattern
+// only checks presence, and empty body patterns are ignored.
+// The first capture group of a matching pattern is used as the version.
+type FingerprintRule struct {
+	Name     string            `json:"name"`
+	Category string            `json:"category,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Cookies  map[string]string `json:"cookies,omitempty"`
+	Body     []string          `json:"body,omitempty"`
+	Meta     map[string]string `json:"meta,omitempty"`
+	Favicon  []int32           `json:"favicon,omitempty"`
+}
+
+type fingerprintRuleFile struct {
+	Technologies []FingerprintRule `json:"technologies"`
+}
+
+// FingerprintDB is a compiled set of fingerprint rules.
+type FingerprintDB struct {
+	rules []compiledRule
+}
+
+type compiledRule struct {
+	name     string
+	category string
+	headers  []keyedPattern
+	cookies  []keyedPattern
+	body     []*regexp.Regexp
+	meta     []keyedPattern
+	favicon  map[int32]struct{}
+}
+
+// keyedPattern is a header, cookie or meta pattern. A rule keeps them
+// sorted by key so the version comes from the same pattern every time.
+type keyedPattern struct {
+	key string
+	re  *regexp.Regexp
+}
+
+var metaTagPattern = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+var metaAttrPattern = regexp.MustCompile(`(?is)(name|property|content)\s*=\s*["']([^"']*)["']`)
+
+// DefaultFingerprintDB returns the rules bundled with goscouter.
+func DefaultFingerprintDB() (*FingerprintDB, error) {
+	return ParseFingerprintRules(defaultFingerprintRules, "json")
+}
+
+// LoadFingerprintRules reads a JSON or YAML rules file. The format is
+// chosen by file extension.
+func LoadFingerprintRules(path string) (*FingerprintDB, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	format := "json"
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = "yaml"
+	}
+	return ParseFingerprintRules(data, format)
+}
+
+// ParseFingerprintRules compiles rules from data in the given format
+// ("json" or "yaml").
+func ParseFingerprintRules(data []byte, format string) (*FingerprintDB, error) {
+	var file fingerprintRuleFile
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &file)
+	case "yaml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		return nil, fmt.Errorf("unsupported rules format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse fingerprint rules: %w", err)
+	}
+
+	db := &FingerprintDB{rules: make([]compiledRule, 0, len(file.Technologies))}
+	for _, rule := range file.Technologies {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("fingerprint rule %q: %w", rule.Name, err)
+		}
+		db.rules = append(db.rules, compiled)
+	}
+	return db, nil
+}
+
+func compileRule(rule FingerprintRule) (compiledRule, error) {
+	if strings.TrimSpace(rule.Name) == "" {
+		return compiledRule{}, fmt.Errorf("missing name")
+	}
+	compiled := compiledRule{
+		name:     rule.Name,
+		category: rule.Category,
+		favicon:  make(map[int32]struct{}, len(rule.Favicon)),
+	}
+	var err error
+	if compiled.headers, err = compileKeyed(rule.Headers, strings.ToLower); err != nil {
+		return compiledRule{}, err
+	}
+	if compiled.cookies, err = compileKeyed(rule.Cookies, nil); err != nil {
+		return compiledRule{}, err
+	}
+	if compiled.meta, err = compileKeyed(rule.Meta, strings.ToLower); err != nil {
+		return compiledRule{}, err
+	}
+	for _, pattern := range rule.Body {
+		// A body pattern has nothing to check for presence; an empty one
+		// adds no body condition rather than matching every response.
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return compiledRule{}, err
+		}
+		compiled.body = append(compiled.body, re)
+	}
+	for _, hash := range rule.Favicon {
+		compiled.favicon[hash] = struct{}{}
+	}
+	return compiled, nil
+}
+
+// compileKeyed compiles patterns sorted by key, normalizing keys with
+// normalize when it is set.
+func compileKeyed(patterns map[string]string, normalize func(string) string) ([]keyedPattern, error) {
+	out := make([]keyedPattern, 0, len(patterns))
+	for key, pattern := range patterns {
+		re, err := compilePattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if normalize != nil {
+			key = normalize(key)
+		}
+		out = append(out, keyedPattern{key: key, re: re})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].key < out[j].key })
+	return out, nil
+}
+
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// WithFingerprinting enables HTTP probing and technology detection using
+// db. A nil db selects the bundled rules; if those fail to load, the error
+// is logged and fingerprinting stays off.
+func WithFingerprinting(db *FingerprintDB) FinderOption {
+	return func(f *Finder) {
+		if db == nil {
+			var err error
+			if db, err = DefaultFingerprintDB(); err != nil {
+				log.Printf("Failed to load bundled fingerprint rules: %v", err)
+				return
+			}
+		}
+		f.fingerprint = true
+		f.fingerprintDB = db
+	}
+}
+
+// match returns the technologies recognised in probe.
+func (db *FingerprintDB) match(probe *httpProbe) []Technology {
+	if db == nil || probe == nil {
+		return nil
+	}
+
+	meta := parseMetaTags(probe.Body)
+	cookies := make(map[string]string, len(probe.Cookies))
+	for _, cookie := range probe.Cookies {
+		cookies[cookie.Name] = cookie.Value
+	}
+	var faviconHash int32
+	if len(probe.Favicon) > 0 {
+		faviconHash = FaviconHash(probe.Favicon)
+	}
+
+	var techs []Technology
+	for _, rule := range db.rules {
+		matched, version := false, ""
+		check := func(re *regexp.Regexp, value string) {
+			if re == nil {
+				matched = true
+				return
+			}
+			m := re.FindStringSubmatch(value)
+			if m == nil {
+				return
+			}
+			matched = true
+			if version == "" && len(m) > 1 {
+				version = m[1]
+			}
+		}
+
+		for _, p := range rule.headers {
+			for _, value := range probe.Header.Values(p.key) {
+				check(p.re, value)
+			}
+		}
+		for _, p := range rule.cookies {
+			if value, ok := cookies[p.key]; ok {
+				check(p.re, value)
+			}
+		}
+		for _, p := range rule.meta {
+			if value, ok := meta[p.key]; ok {
+				check(p.re, value)
+			}
+		}
+		for _, re := range rule.body {
+			check(re, string(probe.Body))
+		}
+		if _, ok := rule.favicon[faviconHash]; ok && len(probe.Favicon) > 0 {
+			matched = true
+		}
+
+		if matched {
+			techs = append(techs, Technology{Name: rule.name, Version: version, Category: rule.category})
+		}
+	}
+
+	sort.Slice(techs, func(i, j int) bool {
+		return techs[i].Name < techs[j].Name
+	})
+	return techs
+}
+
+func parseMetaTags(body []byte) map[string]string {
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAll(body, -1) {
+		var name, content string
+		for _, attr := range metaAttrPattern.FindAllSubmatch(tag, -1) {
+			switch strings.ToLower(string(attr[1])) {
+			case "name", "property":
+				name = strings.ToLower(string(attr[2]))
+			case "content":
+				content = string(attr[2])
+			}
+		}
+		if name != "" {
+			meta[name] = content
+		}
+	}
+	return meta
+}
+
+// fingerprintResults attaches detected technologies to every probed host.
+func (f *Finder) fingerprintResults(results map[string]Subdomain, probes map[string]*httpProbe) {
+	for name, probe := range probes {
+		data, ok := results[name]
+		if !ok {
+			continue
+		}
+		data.Technologies = f.fingerprintDB.match(probe)
+		results[name] = data
+	}
+}
+
+// FaviconHash computes the Shodan-style favicon hash: MurmurHash3 (x86,
+// 32-bit) of the base64 encoding with a newline every 76 characters.
+func FaviconHash(data []byte) int32 {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b strings.Builder
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76])
+		b.WriteByte('\n')
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded)
+	b.WriteByte('\n')
+	return int32(murmur3(b.String()))
+}
+
+func murmur3(s string) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	data := []byte(s)
+	var h uint32
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[n*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(tail[0])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,96 @@
+package subdomain
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestMurmur3(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint32
+	}{
+		{"", 0},
+		{"abc", 0xb3dd93fa},
+		{"test", 0xba6bd213},
+		{"Hello, world!", 0xc0363e43},
+		{"The quick brown fox jumps over the lazy dog", 0x2e4ff723},
+	}
+	for _, tt := range tests {
+		if got := murmur3(tt.input); got != tt.want {
+			t.Errorf("murmur3(%q) = %#x, want %#x", tt.input, got, tt.want)
+		}
+	}
+}
+
+// TestFaviconHash checks against values from Python's
+// mmh3.hash(codecs.encode(data, "base64")), the hash Shodan indexes as
+// http.favicon.hash.
+func TestFaviconHash(t *testing.T) {
+	long := make([]byte, 0, 512)
+	for i := 0; i < 2; i++ {
+		for b := 0; b < 256; b++ {
+			long = append(long, byte(b))
+		}
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want int32
+	}{
+		{"short", []byte{0, 1, 2}, 304933308},
+		// Long enough that the base64 is wrapped at 76 characters.
+		{"wrapped", long, -1173581353},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FaviconHash(tt.data); got != tt.want {
+				t.Errorf("FaviconHash = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintServerHeader(t *testing.T) {
+	db, err := DefaultFingerprintDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		server string
+		want   []Technology
+	}{
+		{"Apache/2.4.58 (Ubuntu)", []Technology{{Name: "Apache HTTP Server", Version: "2.4.58", Category: "web-server"}}},
+		{"Apache", []Technology{{Name: "Apache HTTP Server", Category: "web-server"}}},
+		{"Apache-Coyote/1.1", []Technology{{Name: "Apache Tomcat", Category: "web-server"}}},
+		{"nginx/1.25.3", []Technology{{Name: "nginx", Version: "1.25.3", Category: "web-server"}}},
+	}
+	for _, tt := range tests {
+		probe := &httpProbe{Header: http.Header{"Server": {tt.server}}}
+		if got := db.match(probe); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Server %q: match = %+v, want %+v", tt.server, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintVersionOrder(t *testing.T) {
+	rule := FingerprintRule{Name: "Example", Headers: map[string]string{}}
+	probe := &httpProbe{Header: http.Header{}}
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("X-Version-%d", i)
+		rule.Headers[key] = "([\\d.]+)"
+		probe.Header.Set(key, fmt.Sprintf("%d.0", i))
+	}
+	for i := 0; i < 20; i++ {
+		compiled, err := compileRule(rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := &FingerprintDB{rules: []compiledRule{compiled}}
+		if got := db.match(probe); len(got) != 1 || got[0].Version != "0.0" {
+			t.Fatalf("match = %+v, want version 0.0 from the first header by name", got)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// HTTP probing of resolved hosts.
+
+package subdomain
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultProbeTimeout = 10 * time.Second
+	probeWorkers        = 20
+	maxProbeBodySize    = 512 << 10
+	maxProbeRedirects   = 5
+)
+
+// httpProbe holds the response observed when requesting a host's root page.
+type httpProbe struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Cookies    []*http.Cookie
+	Body       []byte
+	Favicon    []byte
+}
+
+// WithHTTPProbe enables requesting each resolved host's root page so that
+// later stages can inspect the response.
+func WithHTTPProbe(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.probeHTTP = enabled
+	}
+}
+
+// WithHTTPProbeTimeout sets the per-request timeout used when probing hosts.
+func WithHTTPProbeTimeout(timeout time.Duration) FinderOption {
+	return func(f *Finder) {
+		if timeout > 0 {
+			f.probeTimeout = timeout
+		}
+	}
+}
+
+// probeHTTPHosts requests the root page of every resolved host, preferring
+// HTTPS and falling back to plain HTTP.
+func (f *Finder) probeHTTPHosts(ctx context.Context, results map[string]Subdomain) map[string]*httpProbe {
+	client := f.newProbeClient()
+	probes := make(map[string]*httpProbe)
+	sem := make(chan struct{}, probeWorkers)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+
+	for name, data := range results {
+		if len(data.IPs) == 0 {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if !f.acquireWorker(ctx) {
+				return
+			}
+			defer f.releaseWorker()
+			probe := f.probeHost(ctx, client, name)
+			if probe == nil {
+				return
+			}
+			mu.Lock()
+			probes[name] = probe
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return probes
+}
+
+func (f *Finder) newProbeClient() *http.Client {
+	return &http.Client{
+		Timeout: f.probeTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		// Only the probed host passed the scope and authorization checks,
+		// so redirects to any other host are not followed; the redirect
+		// response itself is kept as the probe result.
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxProbeRedirects {
+				return http.ErrUseLastResponse
+			}
+			if !strings.EqualFold(req.URL.Hostname(), via[0].URL.Hostname()) {
+				if f.debug {
+					log.Printf("[DEBUG] Not following redirect from %s to %s", via[0].URL.Host, req.URL.Host)
+				}
+				return http.ErrUseLastResponse
+			}
+			return nil
+		},
+	}
+}
+
+func (f *Finder) probeHost(ctx context.Context, client *http.Client, name string) *httpProbe {
+	for _, scheme := range []string{"https", "http"} {
+		url := scheme + "://" + name + "/"
+		probe, err := f.fetchProbe(ctx, client, url)
+		if err != nil {
+			if f.debug {
+				log.Printf("[DEBUG] HTTP probe failed for %s: %v", url, err)
+			}
+			continue
+		}
+		favicon, err := f.fetchProbe(ctx, client, scheme+"://"+name+"/favicon.ico")
+		if err == nil && favicon.StatusCode == http.StatusOK {
+			probe.Favicon = favicon.Body
+		}
+		return probe
+	}
+	return nil
+}
+
+func (f *Finder) fetchProbe(ctx context.Context, client *http.Client, url string) (*httpProbe, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	if err != nil {
+		return nil, err
+	}
+	return &httpProbe{
+		URL:        resp.Request.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Cookies:    resp.Cookies(),
+		Body:       body,
+	}, nil
+}
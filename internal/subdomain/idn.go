@@ -0,0 +1,199 @@
+// Internationalized domain names: IDNA 2008 conversion and homograph checks.
+
+package subdomain
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// idnaProfile maps and validates names the way resolvers do (UTS #46
+// non-transitional processing). STD3 rules are relaxed so underscore labels
+// survive conversion.
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.Transitional(false),
+	idna.StrictDomainName(false),
+)
+
+// IDNInfo describes a name that contains internationalized labels.
+type IDNInfo struct {
+	// Unicode is the name with every A-label decoded.
+	Unicode string `json:"unicode"`
+	// Scripts lists the writing systems used across the name's labels.
+	Scripts []string `json:"scripts,omitempty"`
+	// MixedScript is set when a single label mixes scripts that are not
+	// normally written together, such as Latin and Cyrillic.
+	MixedScript bool `json:"mixed_script,omitempty"`
+	// Homograph is set when a label is made of characters that look like
+	// ASCII letters; Lookalike is the ASCII name it imitates.
+	Homograph bool   `json:"homograph,omitempty"`
+	Lookalike string `json:"lookalike,omitempty"`
+}
+
+// toASCII returns the A-label form of name. Plain ASCII input is returned
+// unchanged so that names from CT logs are not re-validated on every call.
+func toASCII(name string) (string, error) {
+	if isASCII(name) {
+		return name, nil
+	}
+	return idnaProfile.ToASCII(name)
+}
+
+// ToUnicode decodes the A-labels of name. Names that are not valid IDNA
+// are returned unchanged.
+func ToUnicode(name string) string {
+	if !strings.Contains(name, "xn--") {
+		return name
+	}
+	decoded, err := idnaProfile.ToUnicode(name)
+	if err != nil {
+		return name
+	}
+	return decoded
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// idnScripts are the scripts that are checked for mixing. Characters from
+// other scripts, and Common/Inherited ones such as digits and hyphens, are
+// ignored.
+var idnScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Han", unicode.Han},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Hangul", unicode.Hangul},
+	{"Thai", unicode.Thai},
+	{"Devanagari", unicode.Devanagari},
+	{"Georgian", unicode.Georgian},
+	{"Cherokee", unicode.Cherokee},
+}
+
+// compatibleScripts are combinations that are ordinary in one label:
+// Japanese mixes Han with kana, Korean Han with Hangul, and both are
+// commonly written next to Latin.
+var compatibleScripts = map[string]bool{
+	"Han+Hiragana": true, "Han+Katakana": true, "Hiragana+Katakana": true,
+	"Han+Hangul": true,
+	"Han+Latin":  true, "Hiragana+Latin": true, "Katakana+Latin": true, "Hangul+Latin": true,
+}
+
+// latinLookalikes maps characters from other scripts to the ASCII letters
+// they are commonly confused with.
+var latinLookalikes = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'i', 'ј': 'j', 'һ': 'h',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ӏ': 'l', 'ү': 'y',
+	// Greek
+	'α': 'a', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't',
+	'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Latin look-alikes outside ASCII
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ȷ': 'j', 'ɩ': 'i', 'ʏ': 'y',
+	// Armenian
+	'օ': 'o', 'ս': 'u', 'հ': 'h', 'զ': 'q', 'ո': 'n',
+}
+
+// analyzeIDN returns IDN details for name, or nil when it has no
+// internationalized labels.
+func analyzeIDN(name string) *IDNInfo {
+	unicodeName := ToUnicode(name)
+	if unicodeName == name {
+		return nil
+	}
+	info := &IDNInfo{Unicode: unicodeName}
+
+	allScripts := make(map[string]bool)
+	lookalike := make([]string, 0, strings.Count(unicodeName, ".")+1)
+	for _, label := range strings.Split(unicodeName, ".") {
+		scripts := labelScripts(label)
+		for _, script := range scripts {
+			allScripts[script] = true
+		}
+		if !scriptsCompatible(scripts) {
+			info.MixedScript = true
+		}
+		ascii, imitates := latinSkeleton(label)
+		if imitates && ascii != label {
+			info.Homograph = true
+		}
+		lookalike = append(lookalike, ascii)
+	}
+	if info.Homograph {
+		info.Lookalike = strings.Join(lookalike, ".")
+	}
+	for _, script := range idnScripts {
+		if allScripts[script.name] {
+			info.Scripts = append(info.Scripts, script.name)
+		}
+	}
+	return info
+}
+
+// labelScripts returns the scripts used in label, in idnScripts order.
+func labelScripts(label string) []string {
+	var scripts []string
+	for _, script := range idnScripts {
+		for _, r := range label {
+			if unicode.Is(script.table, r) {
+				scripts = append(scripts, script.name)
+				break
+			}
+		}
+	}
+	return scripts
+}
+
+func scriptsCompatible(scripts []string) bool {
+	switch len(scripts) {
+	case 0, 1:
+		return true
+	case 2:
+		return compatibleScripts[scripts[0]+"+"+scripts[1]] || compatibleScripts[scripts[1]+"+"+scripts[0]]
+	}
+	// Japanese can use Han, both kana and Latin together; anything else
+	// with three scripts is suspicious.
+	for _, script := range scripts {
+		switch script {
+		case "Han", "Hiragana", "Katakana", "Latin":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// latinSkeleton replaces look-alike characters in label with the ASCII
+// letters they imitate. It reports true when the result is entirely ASCII,
+// meaning the label could pass for an ASCII name.
+func latinSkeleton(label string) (string, bool) {
+	var b strings.Builder
+	for _, r := range label {
+		if mapped, ok := latinLookalikes[r]; ok {
+			r = mapped
+		}
+		b.WriteRune(r)
+	}
+	skeleton := b.String()
+	return skeleton, isASCII(skeleton)
+}
@@ -0,0 +1,122 @@
+package subdomain
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeIDN(t *testing.T) {
+	tests := []struct {
+		name string
+		// unicode is converted to its A-label form before analysis, as
+		// names are stored.
+		unicode       string
+		wantNil       bool
+		wantScripts   []string
+		wantMixed     bool
+		wantHomograph bool
+		wantLookalike string
+	}{
+		{name: "ascii", unicode: "www.example.com", wantNil: true},
+		{name: "latin with diacritics", unicode: "bücher.example.com", wantScripts: []string{"Latin"}},
+		{name: "japanese", unicode: "日本語.jp", wantScripts: []string{"Latin", "Han"}},
+		{name: "han and katakana", unicode: "テスト漢字.example", wantScripts: []string{"Latin", "Han", "Katakana"}},
+		{
+			name:          "one cyrillic letter",
+			unicode:       "аpple.com",
+			wantScripts:   []string{"Latin", "Cyrillic"},
+			wantMixed:     true,
+			wantHomograph: true,
+			wantLookalike: "apple.com",
+		},
+		{
+			name:          "whole label cyrillic",
+			unicode:       "аррӏе.com",
+			wantScripts:   []string{"Latin", "Cyrillic"},
+			wantHomograph: true,
+			wantLookalike: "apple.com",
+		},
+		{
+			name:        "greek without lookalike",
+			unicode:     "πaypal.com",
+			wantScripts: []string{"Latin", "Greek"},
+			wantMixed:   true,
+		},
+		{name: "cyrillic word", unicode: "пример.рф", wantScripts: []string{"Cyrillic"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ascii, err := toASCII(tt.unicode)
+			if err != nil {
+				t.Fatalf("toASCII(%q): %v", tt.unicode, err)
+			}
+			info := analyzeIDN(ascii)
+			if tt.wantNil {
+				if info != nil {
+					t.Errorf("analyzeIDN(%q) = %+v, want nil", ascii, info)
+				}
+				return
+			}
+			if info == nil {
+				t.Fatalf("analyzeIDN(%q) = nil", ascii)
+			}
+			if info.Unicode != tt.unicode {
+				t.Errorf("Unicode = %q, want %q", info.Unicode, tt.unicode)
+			}
+			if !reflect.DeepEqual(info.Scripts, tt.wantScripts) {
+				t.Errorf("Scripts = %v, want %v", info.Scripts, tt.wantScripts)
+			}
+			if info.MixedScript != tt.wantMixed {
+				t.Errorf("MixedScript = %v, want %v", info.MixedScript, tt.wantMixed)
+			}
+			if info.Homograph != tt.wantHomograph || info.Lookalike != tt.wantLookalike {
+				t.Errorf("Homograph = %v, %q; want %v, %q", info.Homograph, info.Lookalike, tt.wantHomograph, tt.wantLookalike)
+			}
+		})
+	}
+}
+
+func TestNormalizeDomainIDN(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "Example.COM.", want: "example.com"},
+		{input: "Bücher.Example", want: "xn--bcher-kva.example"},
+		{input: "xn--bcher-kva.example", want: "xn--bcher-kva.example"},
+		{input: "ＥＸＡＭＰＬＥ.com", want: "example.com"},
+		{input: "", wantErr: true},
+		{input: "exa mple.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeDomain(tt.input)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidDomain) {
+				t.Errorf("normalizeDomain(%q) = %q, %v; want ErrInvalidDomain", tt.input, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("normalizeDomain(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	tests := []struct {
+		input, want string
+	}{
+		{"example.com", "example.com"},
+		{"xn--bcher-kva.example", "bücher.example"},
+		{"www.xn--e1afmkfd.xn--p1ai", "www.пример.рф"},
+		// Invalid punycode is returned unchanged.
+		{"xn--a.example", "xn--a.example"},
+	}
+	for _, tt := range tests {
+		if got := ToUnicode(tt.input); got != tt.want {
+			t.Errorf("ToUnicode(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
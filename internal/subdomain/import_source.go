@@ -0,0 +1,570 @@
+// Discovery from imported datasets: passive DNS exports and the output of
+// other enumeration tools.
+
+package subdomain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourceImport reports names that came from an imported dataset.
+const SourceImport = "import"
+
+// Dataset formats accepted by ParseDataset.
+const (
+	FormatAuto       = "auto"
+	FormatAmass      = "amass"
+	FormatSubfinder  = "subfinder"
+	FormatMassDNS    = "massdns"
+	FormatPassiveDNS = "pdns"
+	FormatCSV        = "csv"
+	FormatList       = "list"
+)
+
+// MaxDatasetLine is the longest line a dataset may contain.
+const MaxDatasetLine = 1 << 20
+
+// A DatasetStore holds at most MaxStoredDatasets datasets and
+// MaxStoredNames names across them.
+const (
+	MaxStoredDatasets = 100
+	MaxStoredNames    = 5_000_000
+)
+
+var (
+	// ErrUnknownFormat is returned for a dataset format that is not supported.
+	ErrUnknownFormat = errors.New("unknown dataset format")
+	// ErrEmptyDataset is returned when a dataset holds no usable hostnames.
+	ErrEmptyDataset = errors.New("dataset contains no hostnames")
+	// ErrDatasetStoreFull is returned when adding a dataset would exceed the
+	// store's limits.
+	ErrDatasetStoreFull = errors.New("dataset store is full")
+)
+
+// ImportedName is one hostname read from a dataset.
+type ImportedName struct {
+	Name      string
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Via lists the upstream sources the originating tool credited.
+	Via []string
+}
+
+// Dataset is a set of hostnames loaded from a file or upload.
+type Dataset struct {
+	ID       string         `json:"id"`
+	Label    string         `json:"label"`
+	Format   string         `json:"format"`
+	Count    int            `json:"count"`
+	Skipped  int            `json:"skipped,omitempty"`
+	LoadedAt time.Time      `json:"loaded_at"`
+	Names    []ImportedName `json:"-"`
+}
+
+// LoadDataset reads a dataset from path. An empty or "auto" format is
+// detected from the file name and contents.
+func LoadDataset(path, format string) (*Dataset, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseDataset(file, format, filepath.Base(path))
+}
+
+// ParseDataset reads a dataset in the given format, labelled for
+// provenance. Lines that cannot be parsed are counted in Skipped.
+func ParseDataset(r io.Reader, format, label string) (*Dataset, error) {
+	br := bufio.NewReaderSize(r, 64<<10)
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" || format == FormatAuto {
+		sample, _ := br.Peek(8 << 10)
+		format = DetectDatasetFormat(label, sample)
+	}
+
+	ds := &Dataset{Label: label, Format: format, LoadedAt: time.Now().UTC()}
+	var err error
+	switch format {
+	case FormatCSV:
+		err = ds.parseCSV(br)
+	case FormatAmass, FormatSubfinder, FormatMassDNS, FormatPassiveDNS, FormatList:
+		err = ds.parseLines(br)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s dataset: %w", format, err)
+	}
+	ds.Names = mergeImportedNames(ds.Names)
+	ds.Count = len(ds.Names)
+	if ds.Count == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyDataset, label)
+	}
+	return ds, nil
+}
+
+// DetectDatasetFormat guesses the format of a dataset from its file name
+// and the first lines of its contents.
+func DetectDatasetFormat(filename string, sample []byte) string {
+	if strings.EqualFold(filepath.Ext(filename), ".csv") {
+		return FormatCSV
+	}
+	for _, line := range bytes.Split(sample, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		if line[0] == '{' {
+			var keys map[string]json.RawMessage
+			if json.Unmarshal(line, &keys) != nil {
+				return FormatList
+			}
+			switch {
+			case keys["rrname"] != nil:
+				return FormatPassiveDNS
+			case keys["host"] != nil:
+				return FormatSubfinder
+			case keys["name"] != nil && (keys["status"] != nil || keys["data"] != nil):
+				return FormatMassDNS
+			case keys["name"] != nil:
+				return FormatAmass
+			}
+			return FormatList
+		}
+		if fields := strings.Fields(string(line)); len(fields) >= 3 && isDNSRecordType(fields[1]) {
+			return FormatMassDNS
+		}
+		if bytes.Contains(line, []byte(",")) {
+			return FormatCSV
+		}
+		return FormatList
+	}
+	return FormatList
+}
+
+// parseLines handles the line-oriented formats.
+func (ds *Dataset) parseLines(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), MaxDatasetLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		names, ok := parseDatasetLine(ds.Format, line)
+		if !ok {
+			ds.Skipped++
+			continue
+		}
+		ds.Names = append(ds.Names, names...)
+	}
+	return scanner.Err()
+}
+
+type amassRecord struct {
+	Name    string   `json:"name"`
+	Sources []string `json:"sources"`
+	Source  string   `json:"source"`
+}
+
+type subfinderRecord struct {
+	Host   string `json:"host"`
+	Source string `json:"source"`
+}
+
+type massDNSRecord struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Data   struct {
+		Answers []struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+			Data string `json:"data"`
+		} `json:"answers"`
+	} `json:"data"`
+}
+
+type passiveDNSRecord struct {
+	RRName        string          `json:"rrname"`
+	RRType        string          `json:"rrtype"`
+	RData         json.RawMessage `json:"rdata"`
+	TimeFirst     int64           `json:"time_first"`
+	TimeLast      int64           `json:"time_last"`
+	ZoneTimeFirst int64           `json:"zone_time_first"`
+	ZoneTimeLast  int64           `json:"zone_time_last"`
+}
+
+// parseDatasetLine extracts the names on one line of a line-oriented
+// format. It reports false for lines that hold no usable name.
+func parseDatasetLine(format, line string) ([]ImportedName, bool) {
+	var names []ImportedName
+	add := func(name string, via ...string) {
+		if name = normalizeName(name); name != "" && isValidDomain(name) {
+			names = append(names, ImportedName{Name: name, Via: uniqueStrings(via)})
+		}
+	}
+
+	switch format {
+	case FormatAmass:
+		var rec amassRecord
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			return nil, false
+		}
+		add(rec.Name, append(rec.Sources, rec.Source)...)
+	case FormatSubfinder:
+		if !strings.HasPrefix(line, "{") {
+			add(strings.Fields(line)[0])
+			break
+		}
+		var rec subfinderRecord
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			return nil, false
+		}
+		add(rec.Host, rec.Source)
+	case FormatMassDNS:
+		if !strings.HasPrefix(line, "{") {
+			// Simple output: "name. TYPE data". CNAME and similar
+			// targets can be in scope too.
+			fields := strings.Fields(line)
+			if len(fields) < 3 || !isDNSRecordType(fields[1]) {
+				return nil, false
+			}
+			add(fields[0])
+			if recordTargetsHost(fields[1]) {
+				add(fields[2])
+			}
+			break
+		}
+		var rec massDNSRecord
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			return nil, false
+		}
+		if rec.Status != "" && rec.Status != "NOERROR" {
+			return nil, true
+		}
+		add(rec.Name)
+		for _, answer := range rec.Data.Answers {
+			add(answer.Name)
+			if recordTargetsHost(answer.Type) {
+				add(answer.Data)
+			}
+		}
+	case FormatPassiveDNS:
+		var rec passiveDNSRecord
+		if json.Unmarshal([]byte(line), &rec) != nil {
+			return nil, false
+		}
+		first, last := rec.TimeFirst, rec.TimeLast
+		if first == 0 {
+			first, last = rec.ZoneTimeFirst, rec.ZoneTimeLast
+		}
+		add(rec.RRName)
+		if recordTargetsHost(rec.RRType) {
+			for _, target := range passiveDNSRData(rec.RData) {
+				add(target)
+			}
+		}
+		for i := range names {
+			names[i].FirstSeen = unixTime(first)
+			names[i].LastSeen = unixTime(last)
+		}
+	case FormatList:
+		add(strings.Fields(line)[0])
+	}
+	return names, len(names) > 0
+}
+
+// passiveDNSRData accepts rdata as either a string or a list of strings.
+func passiveDNSRData(raw json.RawMessage) []string {
+	var list []string
+	if json.Unmarshal(raw, &list) == nil {
+		return list
+	}
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return []string{single}
+	}
+	return nil
+}
+
+// csvNameColumns are header names that hold the hostname, in preference
+// order.
+var csvNameColumns = []string{"hostname", "host", "fqdn", "subdomain", "rrname", "name", "query", "domain"}
+
+// parseCSV reads a CSV export. The hostname column is found by header;
+// without a recognised header the first column is used. first_seen and
+// last_seen style columns are kept when present.
+func (ds *Dataset) parseCSV(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	nameCol, firstCol, lastCol := 0, -1, -1
+	columns := make(map[string]int, len(header))
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	hasHeader := false
+	for _, column := range csvNameColumns {
+		if i, ok := columns[column]; ok {
+			nameCol, hasHeader = i, true
+			break
+		}
+	}
+	for _, column := range []string{"first_seen", "time_first", "firstseen"} {
+		if i, ok := columns[column]; ok {
+			firstCol = i
+		}
+	}
+	for _, column := range []string{"last_seen", "time_last", "lastseen"} {
+		if i, ok := columns[column]; ok {
+			lastCol = i
+		}
+	}
+
+	if !hasHeader {
+		ds.addCSVRow(header, nameCol, firstCol, lastCol)
+	}
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			ds.Skipped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		ds.addCSVRow(row, nameCol, firstCol, lastCol)
+	}
+}
+
+func (ds *Dataset) addCSVRow(row []string, nameCol, firstCol, lastCol int) {
+	if nameCol >= len(row) {
+		ds.Skipped++
+		return
+	}
+	name := normalizeName(row[nameCol])
+	if name == "" || !isValidDomain(name) {
+		ds.Skipped++
+		return
+	}
+	imported := ImportedName{Name: name}
+	if firstCol >= 0 && firstCol < len(row) {
+		imported.FirstSeen = parseDatasetTime(row[firstCol])
+	}
+	if lastCol >= 0 && lastCol < len(row) {
+		imported.LastSeen = parseDatasetTime(row[lastCol])
+	}
+	ds.Names = append(ds.Names, imported)
+}
+
+// parseDatasetTime accepts Unix seconds or any CT timestamp layout.
+func parseDatasetTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return unixTime(seconds)
+	}
+	return parseCertTime(value)
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0).UTC()
+}
+
+// isDNSRecordType reports whether value is a record type as printed by
+// resolvers.
+func isDNSRecordType(value string) bool {
+	switch strings.ToUpper(value) {
+	case "A", "AAAA", "CNAME", "NS", "MX", "PTR", "SRV", "TXT", "SOA", "DNAME", "CAA":
+		return true
+	}
+	return false
+}
+
+// recordTargetsHost reports whether the data of a record type is a hostname.
+func recordTargetsHost(rrtype string) bool {
+	switch strings.ToUpper(rrtype) {
+	case "CNAME", "DNAME", "NS", "PTR":
+		return true
+	}
+	return false
+}
+
+// mergeImportedNames collapses repeated names, widening the seen window
+// and combining Via.
+func mergeImportedNames(names []ImportedName) []ImportedName {
+	index := make(map[string]int, len(names))
+	out := names[:0]
+	for _, name := range names {
+		i, ok := index[name.Name]
+		if !ok {
+			index[name.Name] = len(out)
+			out = append(out, name)
+			continue
+		}
+		merged := &out[i]
+		if !name.FirstSeen.IsZero() && (merged.FirstSeen.IsZero() || name.FirstSeen.Before(merged.FirstSeen)) {
+			merged.FirstSeen = name.FirstSeen
+		}
+		if name.LastSeen.After(merged.LastSeen) {
+			merged.LastSeen = name.LastSeen
+		}
+		merged.Via = uniqueStrings(append(merged.Via, name.Via...))
+	}
+	return out
+}
+
+// DatasetStore holds imported datasets shared by every scan of a Finder.
+// It is safe for concurrent use.
+type DatasetStore struct {
+	mu       sync.RWMutex
+	nextID   int
+	datasets []*Dataset
+	names    int
+
+	maxDatasets int
+	maxNames    int
+}
+
+func NewDatasetStore() *DatasetStore {
+	return &DatasetStore{maxDatasets: MaxStoredDatasets, maxNames: MaxStoredNames}
+}
+
+// Add stores ds and returns the ID assigned to it. It fails with
+// ErrDatasetStoreFull when the store already holds MaxStoredDatasets
+// datasets or ds would take it past MaxStoredNames names.
+func (s *DatasetStore) Add(ds *Dataset) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.datasets) >= s.maxDatasets {
+		return "", fmt.Errorf("%w: %d datasets stored", ErrDatasetStoreFull, len(s.datasets))
+	}
+	if s.names+len(ds.Names) > s.maxNames {
+		return "", fmt.Errorf("%w: %d of %d names used", ErrDatasetStoreFull, s.names, s.maxNames)
+	}
+	s.nextID++
+	ds.ID = strconv.Itoa(s.nextID)
+	s.datasets = append(s.datasets, ds)
+	s.names += len(ds.Names)
+	return ds.ID, nil
+}
+
+// Remove deletes the dataset with id, reporting whether it existed.
+func (s *DatasetStore) Remove(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, ds := range s.datasets {
+		if ds.ID == id {
+			s.names -= len(ds.Names)
+			s.datasets = append(s.datasets[:i:i], s.datasets[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the stored datasets in the order they were added.
+func (s *DatasetStore) List() []*Dataset {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]*Dataset(nil), s.datasets...)
+}
+
+// WithDatasets makes every scan include matching names from store.
+func WithDatasets(store *DatasetStore) FinderOption {
+	return func(f *Finder) {
+		f.datasets = store
+	}
+}
+
+// importSources lists the import source while any dataset is loaded.
+func (f *Finder) importSources() []discoverySource {
+	if f.datasets == nil || len(f.datasets.List()) == 0 {
+		return nil
+	}
+	return []discoverySource{{SourceImport, f.collectFromDatasets}}
+}
+
+// collectFromDatasets adds the imported names under domain. Each name
+// keeps the time window recorded in the dataset, the datasets it came
+// from and the upstream sources the originating tool listed.
+func (f *Finder) collectFromDatasets(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	datasets := f.datasets.List()
+	now := time.Now().UTC()
+	for _, ds := range datasets {
+		if err := ctx.Err(); err != nil {
+			return sourceRun{}, err
+		}
+		origin := ds.Format + ":" + ds.Label
+		for _, imported := range ds.Names {
+			if !isSubdomainOf(imported.Name, domain) {
+				continue
+			}
+			first, last := imported.FirstSeen, imported.LastSeen
+			if first.IsZero() && last.IsZero() {
+				first = now
+			}
+			addSubdomain(results, imported.Name, SourceImport, first, nil)
+			entry := results[imported.Name]
+			entry.observe("", last)
+			entry.annotateDiscovery(SourceImport, origin, imported.Via, last)
+			results[imported.Name] = entry
+		}
+	}
+	return sourceRun{}, nil
+}
+
+// annotateDiscovery attaches the dataset and upstream sources to the
+// discovery recorded for source and extends its window to lastSeen.
+func (s *Subdomain) annotateDiscovery(source, dataset string, via []string, lastSeen time.Time) {
+	for i := range s.Discoveries {
+		d := &s.Discoveries[i]
+		if d.Source != source {
+			continue
+		}
+		if lastSeen.After(d.LastSeen) {
+			d.LastSeen = lastSeen
+		}
+		if dataset != "" && !containsString(d.Datasets, dataset) {
+			d.Datasets = append(d.Datasets, dataset)
+			sort.Strings(d.Datasets)
+		}
+		for _, v := range via {
+			if !containsString(d.Via, v) {
+				d.Via = append(d.Via, v)
+			}
+		}
+		sort.Strings(d.Via)
+		return
+	}
+}
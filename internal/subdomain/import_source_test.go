@@ -0,0 +1,186 @@
+package subdomain
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDataset(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		format      string
+		label       string
+		wantFormat  string
+		wantNames   []string
+		wantSkipped int
+	}{
+		{
+			name:       "plain list",
+			input:      "# comment\nwww.example.com\nAPI.Example.com.\n\nwww.example.com\n",
+			wantFormat: FormatList,
+			wantNames:  []string{"api.example.com", "www.example.com"},
+		},
+		{
+			name:       "amass json",
+			input:      `{"name":"a.example.com","domain":"example.com","sources":["crtsh"]}` + "\n" + `{"name":"b.example.com","source":"dns"}`,
+			wantFormat: FormatAmass,
+			wantNames:  []string{"a.example.com", "b.example.com"},
+		},
+		{
+			name:        "subfinder json",
+			input:       `{"host":"c.example.com","source":"crtsh"}` + "\n" + `{"host":"not a name"}`,
+			wantFormat:  FormatSubfinder,
+			wantNames:   []string{"c.example.com"},
+			wantSkipped: 1,
+		},
+		{
+			name:       "massdns simple",
+			input:      "www.example.com. CNAME edge.example.com.\nmail.example.com. A 192.0.2.1\n",
+			wantFormat: FormatMassDNS,
+			wantNames:  []string{"edge.example.com", "mail.example.com", "www.example.com"},
+		},
+		{
+			name:       "massdns json skips failed lookups",
+			input:      `{"name":"ok.example.com.","status":"NOERROR","data":{"answers":[{"name":"ok.example.com.","type":"CNAME","data":"lb.example.com."}]}}` + "\n" + `{"name":"gone.example.com.","status":"NXDOMAIN"}`,
+			wantFormat: FormatMassDNS,
+			wantNames:  []string{"lb.example.com", "ok.example.com"},
+		},
+		{
+			name:       "passive dns",
+			input:      `{"rrname":"old.example.com","rrtype":"CNAME","rdata":["cdn.example.com."],"time_first":1600000000,"time_last":1700000000}`,
+			wantFormat: FormatPassiveDNS,
+			wantNames:  []string{"cdn.example.com", "old.example.com"},
+		},
+		{
+			name:        "csv with header",
+			input:       "first_seen,hostname\n1600000000,x.example.com\n1600000000,\n",
+			wantFormat:  FormatCSV,
+			wantNames:   []string{"x.example.com"},
+			wantSkipped: 1,
+		},
+		{
+			name:       "csv detected from label",
+			input:      "y.example.com\n",
+			label:      "export.csv",
+			wantFormat: FormatCSV,
+			wantNames:  []string{"y.example.com"},
+		},
+		{
+			name:       "explicit format",
+			input:      "z.example.com extra fields\n",
+			format:     "LIST",
+			wantFormat: FormatList,
+			wantNames:  []string{"z.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			label := tt.label
+			if label == "" {
+				label = "upload"
+			}
+			ds, err := ParseDataset(strings.NewReader(tt.input), tt.format, label)
+			if err != nil {
+				t.Fatalf("ParseDataset: %v", err)
+			}
+			if ds.Format != tt.wantFormat {
+				t.Errorf("format = %q, want %q", ds.Format, tt.wantFormat)
+			}
+			var names []string
+			for _, name := range ds.Names {
+				names = append(names, name.Name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+			if ds.Count != len(tt.wantNames) {
+				t.Errorf("count = %d, want %d", ds.Count, len(tt.wantNames))
+			}
+			if ds.Skipped != tt.wantSkipped {
+				t.Errorf("skipped = %d, want %d", ds.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestParseDatasetSeenWindow(t *testing.T) {
+	input := `{"rrname":"old.example.com","rrtype":"A","rdata":"192.0.2.1","time_first":1600000000,"time_last":1650000000}` + "\n" +
+		`{"rrname":"old.example.com","rrtype":"A","rdata":"192.0.2.2","time_first":1500000000,"time_last":1700000000}`
+	ds, err := ParseDataset(strings.NewReader(input), FormatPassiveDNS, "pdns")
+	if err != nil {
+		t.Fatalf("ParseDataset: %v", err)
+	}
+	if len(ds.Names) != 1 {
+		t.Fatalf("got %d names, want 1", len(ds.Names))
+	}
+	got := ds.Names[0]
+	if want := time.Unix(1500000000, 0).UTC(); !got.FirstSeen.Equal(want) {
+		t.Errorf("first seen = %v, want %v", got.FirstSeen, want)
+	}
+	if want := time.Unix(1700000000, 0).UTC(); !got.LastSeen.Equal(want) {
+		t.Errorf("last seen = %v, want %v", got.LastSeen, want)
+	}
+}
+
+func TestParseDatasetErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		format  string
+		wantErr error
+	}{
+		{"unknown format", "www.example.com\n", "zonefile", ErrUnknownFormat},
+		{"empty body", "", "", ErrEmptyDataset},
+		{"only comments", "# nothing here\n\n", FormatList, ErrEmptyDataset},
+		{"no valid names", "-invalid-\n_bad_!\n", FormatList, ErrEmptyDataset},
+		{"csv header only", "hostname,first_seen\n", FormatCSV, ErrEmptyDataset},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseDataset(strings.NewReader(tt.input), tt.format, "upload")
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDatasetStoreLimits(t *testing.T) {
+	store := NewDatasetStore()
+	store.maxDatasets, store.maxNames = 3, 10
+	for i := 0; i < store.maxDatasets; i++ {
+		if _, err := store.Add(&Dataset{Names: make([]ImportedName, 1)}); err != nil {
+			t.Fatalf("Add #%d: %v", i+1, err)
+		}
+	}
+	if _, err := store.Add(&Dataset{Names: make([]ImportedName, 1)}); !errors.Is(err, ErrDatasetStoreFull) {
+		t.Fatalf("Add past the dataset limit: err = %v, want ErrDatasetStoreFull", err)
+	}
+	if !store.Remove("1") {
+		t.Fatal("Remove(1) found nothing")
+	}
+	if _, err := store.Add(&Dataset{Names: make([]ImportedName, 1)}); err != nil {
+		t.Errorf("Add after Remove: %v", err)
+	}
+
+	store = NewDatasetStore()
+	store.maxNames = 10
+	big := &Dataset{Names: make([]ImportedName, 9)}
+	if _, err := store.Add(big); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if _, err := store.Add(&Dataset{Names: make([]ImportedName, 2)}); !errors.Is(err, ErrDatasetStoreFull) {
+		t.Errorf("Add past the name limit: err = %v, want ErrDatasetStoreFull", err)
+	}
+	store.Remove(big.ID)
+	if _, err := store.Add(&Dataset{Names: make([]ImportedName, 2)}); err != nil {
+		t.Errorf("Add after freeing names: %v", err)
+	}
+}
@@ -0,0 +1,534 @@
+// Opt-in discovery sources backed by API-keyed intel services.
+
+package subdomain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Names of the keyed intel sources.
+const (
+	SourceVirusTotal     = "virustotal"
+	SourceSecurityTrails = "securitytrails"
+	SourceShodan         = "shodan"
+	SourceCensys         = "censys"
+)
+
+const defaultMaxIntelPages = 20
+
+// ErrQuotaExhausted is returned when an intel API refuses a request because
+// the key has no allowance left.
+var ErrQuotaExhausted = errors.New("API quota exhausted")
+
+// IntelSources lists the keyed sources in the order they are queried.
+var IntelSources = []string{SourceVirusTotal, SourceSecurityTrails, SourceShodan, SourceCensys}
+
+// defaultBaseURLs are the public API endpoints, overridable per source with
+// WithSourceBaseURL.
+var defaultBaseURLs = map[string]string{
+	SourceVirusTotal:     "https://www.virustotal.com",
+	SourceSecurityTrails: "https://api.securitytrails.com",
+	SourceShodan:         "https://api.shodan.io",
+	SourceCensys:         "https://search.censys.io",
+	SourceCrtSh:          "https://crt.sh",
+	SourceCertSpotter:    "https://api.certspotter.com",
+	SourceWayback:        "https://web.archive.org",
+	SourceCommonCrawl:    "https://index.commoncrawl.org",
+}
+
+// APIKeys holds credentials for the keyed intel sources.
+type APIKeys struct {
+	VirusTotal     string `json:"virustotal,omitempty" yaml:"virustotal,omitempty"`
+	SecurityTrails string `json:"securitytrails,omitempty" yaml:"securitytrails,omitempty"`
+	Shodan         string `json:"shodan,omitempty" yaml:"shodan,omitempty"`
+	CensysID       string `json:"censys_id,omitempty" yaml:"censys_id,omitempty"`
+	CensysSecret   string `json:"censys_secret,omitempty" yaml:"censys_secret,omitempty"`
+}
+
+// APIKeysFromEnv reads GOSCOUTER_VIRUSTOTAL_KEY, GOSCOUTER_SECURITYTRAILS_KEY,
+// GOSCOUTER_SHODAN_KEY, GOSCOUTER_CENSYS_API_ID and GOSCOUTER_CENSYS_API_SECRET.
+func APIKeysFromEnv() APIKeys {
+	return APIKeys{
+		VirusTotal:     strings.TrimSpace(os.Getenv("GOSCOUTER_VIRUSTOTAL_KEY")),
+		SecurityTrails: strings.TrimSpace(os.Getenv("GOSCOUTER_SECURITYTRAILS_KEY")),
+		Shodan:         strings.TrimSpace(os.Getenv("GOSCOUTER_SHODAN_KEY")),
+		CensysID:       strings.TrimSpace(os.Getenv("GOSCOUTER_CENSYS_API_ID")),
+		CensysSecret:   strings.TrimSpace(os.Getenv("GOSCOUTER_CENSYS_API_SECRET")),
+	}
+}
+
+// LoadAPIKeys reads keys from a JSON or YAML file, chosen by extension.
+func LoadAPIKeys(path string) (APIKeys, error) {
+	var keys APIKeys
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return keys, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &keys)
+	default:
+		err = json.Unmarshal(data, &keys)
+	}
+	if err != nil {
+		return keys, fmt.Errorf("parse API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Merge returns k with every key that is set in other taking precedence.
+func (k APIKeys) Merge(other APIKeys) APIKeys {
+	pick := func(current, override string) string {
+		if override != "" {
+			return override
+		}
+		return current
+	}
+	return APIKeys{
+		VirusTotal:     pick(k.VirusTotal, other.VirusTotal),
+		SecurityTrails: pick(k.SecurityTrails, other.SecurityTrails),
+		Shodan:         pick(k.Shodan, other.Shodan),
+		CensysID:       pick(k.CensysID, other.CensysID),
+		CensysSecret:   pick(k.CensysSecret, other.CensysSecret),
+	}
+}
+
+// configured reports whether k has credentials for source.
+func (k APIKeys) configured(source string) bool {
+	switch source {
+	case SourceVirusTotal:
+		return k.VirusTotal != ""
+	case SourceSecurityTrails:
+		return k.SecurityTrails != ""
+	case SourceShodan:
+		return k.Shodan != ""
+	case SourceCensys:
+		return k.CensysID != "" && k.CensysSecret != ""
+	}
+	return false
+}
+
+// WithAPIKeys sets credentials for the intel sources. Keys set here
+// override ones from earlier calls.
+func WithAPIKeys(keys APIKeys) FinderOption {
+	return func(f *Finder) {
+		f.apiKeys = f.apiKeys.Merge(keys)
+	}
+}
+
+// WithIntelSources enables keyed sources by name. An enabled source without
+// a key is reported as skipped rather than failing the scan.
+func WithIntelSources(sources ...string) FinderOption {
+	return func(f *Finder) {
+		for _, source := range sources {
+			source = strings.ToLower(strings.TrimSpace(source))
+			if containsString(IntelSources, source) && !containsString(f.intelEnabled, source) {
+				f.intelEnabled = append(f.intelEnabled, source)
+			}
+		}
+	}
+}
+
+// WithMaxIntelPages caps how many result pages are read from each intel
+// source per scan.
+func WithMaxIntelPages(pages int) FinderOption {
+	return func(f *Finder) {
+		if pages > 0 {
+			f.maxIntelPages = pages
+		}
+	}
+}
+
+// WithSourceBaseURL points an HTTP API source at a different endpoint, such as
+// a proxy or a local stand-in.
+func WithSourceBaseURL(source, baseURL string) FinderOption {
+	return func(f *Finder) {
+		baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+		if baseURL == "" {
+			return
+		}
+		if f.sourceBaseURLs == nil {
+			f.sourceBaseURLs = make(map[string]string)
+		}
+		f.sourceBaseURLs[strings.ToLower(source)] = baseURL
+	}
+}
+
+func (f *Finder) sourceBaseURL(source string) string {
+	if baseURL, ok := f.sourceBaseURLs[source]; ok {
+		return baseURL
+	}
+	return defaultBaseURLs[source]
+}
+
+// intelSources returns the enabled keyed sources in IntelSources order.
+// The remaining allowance is looked up after every run, including failed
+// ones, so an exhausted key shows up in the source status.
+func (f *Finder) intelSources() []discoverySource {
+	collectors := map[string]func(context.Context, string, map[string]Subdomain) (sourceRun, error){
+		SourceVirusTotal:     f.collectFromVirusTotal,
+		SourceSecurityTrails: f.collectFromSecurityTrails,
+		SourceShodan:         f.collectFromShodan,
+		SourceCensys:         f.collectFromCensys,
+	}
+	quotas := map[string]func(context.Context) (*SourceQuota, error){
+		SourceVirusTotal:     f.virusTotalQuota,
+		SourceSecurityTrails: f.securityTrailsQuota,
+		SourceShodan:         f.shodanQuota,
+		SourceCensys:         f.censysQuota,
+	}
+
+	var sources []discoverySource
+	for _, name := range IntelSources {
+		if !containsString(f.intelEnabled, name) {
+			continue
+		}
+		if !f.apiKeys.configured(name) {
+			sources = append(sources, discoverySource{name, func(context.Context, string, map[string]Subdomain) (sourceRun, error) {
+				return sourceRun{skipped: "no API key configured"}, nil
+			}})
+			continue
+		}
+		collect, fetchQuota := collectors[name], quotas[name]
+		sources = append(sources, discoverySource{name, func(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+			run, err := collect(ctx, domain, results)
+			run.quota = f.intelQuota(ctx, name, fetchQuota)
+			if run.quota == nil && errors.Is(err, ErrQuotaExhausted) {
+				run.quota = &SourceQuota{}
+			}
+			return run, err
+		}})
+	}
+	return sources
+}
+
+// intelJSON sends a request to a keyed API and decodes the JSON response.
+// 402 and 429 responses are reported as ErrQuotaExhausted.
+func (f *Finder) intelJSON(ctx context.Context, source, method, url string, header http.Header, body []byte, out any) error {
+	rc, err := f.openRequest(ctx, source, method, url, header, body)
+	if err != nil {
+		switch responseStatus(err) {
+		case http.StatusPaymentRequired, http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %v", ErrQuotaExhausted, err)
+		}
+		return err
+	}
+	defer rc.Close()
+	return json.NewDecoder(io.LimitReader(rc, f.maxBodySize)).Decode(out)
+}
+
+// addIntelName adds name to results when it falls under domain. The APIs
+// do not say when they first saw a name, so the query time is recorded.
+func addIntelName(results map[string]Subdomain, name, source, domain string) {
+	name = normalizeName(name)
+	if isSubdomainOf(name, domain) {
+		addSubdomain(results, name, source, time.Now().UTC(), nil)
+	}
+}
+
+// intelQuota fetches the remaining allowance for source, logging failures
+// since the results are still good without it.
+func (f *Finder) intelQuota(ctx context.Context, source string, fetch func(context.Context) (*SourceQuota, error)) *SourceQuota {
+	quota, err := fetch(ctx)
+	if err != nil {
+		if f.debug {
+			log.Printf("[DEBUG] %s quota lookup failed: %v", source, err)
+		}
+		return nil
+	}
+	return quota
+}
+
+type virusTotalSubdomains struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+	Meta struct {
+		Cursor string `json:"cursor"`
+	} `json:"meta"`
+}
+
+type virusTotalQuotas struct {
+	Data struct {
+		Daily struct {
+			User struct {
+				Used    int `json:"used"`
+				Allowed int `json:"allowed"`
+			} `json:"user"`
+		} `json:"api_requests_daily"`
+	} `json:"data"`
+}
+
+// collectFromVirusTotal pages through the v3 subdomains relationship using
+// the cursor from each response.
+func (f *Finder) collectFromVirusTotal(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	header := http.Header{"X-Apikey": {f.apiKeys.VirusTotal}}
+	baseURL := fmt.Sprintf("%s/api/v3/domains/%s/subdomains?limit=40", f.sourceBaseURL(SourceVirusTotal), neturl.PathEscape(domain))
+
+	cursor := ""
+	for page := 0; ; page++ {
+		if page == f.maxIntelPages {
+			run.capped = true
+			break
+		}
+		url := baseURL
+		if cursor != "" {
+			url += "&cursor=" + neturl.QueryEscape(cursor)
+		}
+		var resp virusTotalSubdomains
+		if err := f.intelJSON(ctx, SourceVirusTotal, http.MethodGet, url, header, nil, &resp); err != nil {
+			return run, fmt.Errorf("virustotal request failed: %w", err)
+		}
+		for _, item := range resp.Data {
+			addIntelName(results, item.ID, SourceVirusTotal, domain)
+		}
+		if resp.Meta.Cursor == "" || resp.Meta.Cursor == cursor || len(resp.Data) == 0 {
+			break
+		}
+		cursor = resp.Meta.Cursor
+	}
+
+	return run, nil
+}
+
+func (f *Finder) virusTotalQuota(ctx context.Context) (*SourceQuota, error) {
+	header := http.Header{"X-Apikey": {f.apiKeys.VirusTotal}}
+	url := fmt.Sprintf("%s/api/v3/users/%s/overall_quotas", f.sourceBaseURL(SourceVirusTotal), neturl.PathEscape(f.apiKeys.VirusTotal))
+	var quotas virusTotalQuotas
+	if err := f.intelJSON(ctx, SourceVirusTotal, http.MethodGet, url, header, nil, &quotas); err != nil {
+		return nil, redactSecret(err, f.apiKeys.VirusTotal)
+	}
+	user := quotas.Data.Daily.User
+	return &SourceQuota{Used: user.Used, Limit: user.Allowed, Remaining: max(user.Allowed-user.Used, 0), Period: "daily"}, nil
+}
+
+type securityTrailsSubdomains struct {
+	Subdomains []string `json:"subdomains"`
+	Meta       struct {
+		LimitReached bool `json:"limit_reached"`
+	} `json:"meta"`
+}
+
+type securityTrailsScroll struct {
+	Records []struct {
+		Hostname string `json:"hostname"`
+	} `json:"records"`
+	Meta struct {
+		ScrollID string `json:"scroll_id"`
+	} `json:"meta"`
+}
+
+type securityTrailsUsage struct {
+	Used    int `json:"current_monthly_usage"`
+	Allowed int `json:"allowed_monthly_usage"`
+}
+
+// collectFromSecurityTrails lists subdomain labels in one call. That
+// endpoint truncates large domains, so when it reports its limit was
+// reached the scrolling domain search is used to page through the rest.
+func (f *Finder) collectFromSecurityTrails(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	header := http.Header{"Apikey": {f.apiKeys.SecurityTrails}}
+	baseURL := f.sourceBaseURL(SourceSecurityTrails)
+
+	url := fmt.Sprintf("%s/v1/domain/%s/subdomains?children_only=false&include_inactive=true", baseURL, neturl.PathEscape(domain))
+	var listing securityTrailsSubdomains
+	if err := f.intelJSON(ctx, SourceSecurityTrails, http.MethodGet, url, header, nil, &listing); err != nil {
+		return run, fmt.Errorf("securitytrails request failed: %w", err)
+	}
+	for _, label := range listing.Subdomains {
+		addIntelName(results, label+"."+domain, SourceSecurityTrails, domain)
+	}
+
+	if listing.Meta.LimitReached {
+		query, err := json.Marshal(map[string]any{"filter": map[string]string{"apex_domain": domain}})
+		if err != nil {
+			return run, err
+		}
+		url = baseURL + "/v1/domains/list?include_ips=false&scroll=true"
+		method, body := http.MethodPost, query
+		for page := 0; ; page++ {
+			if page == f.maxIntelPages {
+				run.capped = true
+				break
+			}
+			var scroll securityTrailsScroll
+			if err := f.intelJSON(ctx, SourceSecurityTrails, method, url, header, body, &scroll); err != nil {
+				return run, fmt.Errorf("securitytrails scroll failed: %w", err)
+			}
+			for _, record := range scroll.Records {
+				addIntelName(results, record.Hostname, SourceSecurityTrails, domain)
+			}
+			if len(scroll.Records) == 0 || scroll.Meta.ScrollID == "" {
+				break
+			}
+			url = baseURL + "/v1/scroll/" + neturl.PathEscape(scroll.Meta.ScrollID)
+			method, body = http.MethodGet, nil
+		}
+	}
+
+	return run, nil
+}
+
+func (f *Finder) securityTrailsQuota(ctx context.Context) (*SourceQuota, error) {
+	header := http.Header{"Apikey": {f.apiKeys.SecurityTrails}}
+	var usage securityTrailsUsage
+	if err := f.intelJSON(ctx, SourceSecurityTrails, http.MethodGet, f.sourceBaseURL(SourceSecurityTrails)+"/v1/account/usage", header, nil, &usage); err != nil {
+		return nil, err
+	}
+	return &SourceQuota{Used: usage.Used, Limit: usage.Allowed, Remaining: max(usage.Allowed-usage.Used, 0), Period: "monthly"}, nil
+}
+
+type shodanDomain struct {
+	Subdomains []string `json:"subdomains"`
+	More       bool     `json:"more"`
+}
+
+type shodanAPIInfo struct {
+	QueryCredits int `json:"query_credits"`
+}
+
+// collectFromShodan pages through the DNS domain endpoint while it reports
+// more results. Shodan takes the key as a query parameter, so it is
+// stripped from any error before it is returned.
+func (f *Finder) collectFromShodan(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	key := neturl.QueryEscape(f.apiKeys.Shodan)
+	baseURL := f.sourceBaseURL(SourceShodan)
+
+	for page := 1; ; page++ {
+		if page > f.maxIntelPages {
+			run.capped = true
+			break
+		}
+		url := fmt.Sprintf("%s/dns/domain/%s?key=%s&page=%d", baseURL, neturl.PathEscape(domain), key, page)
+		var resp shodanDomain
+		if err := f.intelJSON(ctx, SourceShodan, http.MethodGet, url, nil, nil, &resp); err != nil {
+			return run, fmt.Errorf("shodan request failed: %w", redactSecret(err, key))
+		}
+		for _, label := range resp.Subdomains {
+			name := domain
+			if label != "" {
+				name = label + "." + domain
+			}
+			addIntelName(results, name, SourceShodan, domain)
+		}
+		if !resp.More || len(resp.Subdomains) == 0 {
+			break
+		}
+	}
+
+	return run, nil
+}
+
+func (f *Finder) shodanQuota(ctx context.Context) (*SourceQuota, error) {
+	key := neturl.QueryEscape(f.apiKeys.Shodan)
+	var info shodanAPIInfo
+	if err := f.intelJSON(ctx, SourceShodan, http.MethodGet, f.sourceBaseURL(SourceShodan)+"/api-info?key="+key, nil, nil, &info); err != nil {
+		return nil, redactSecret(err, key)
+	}
+	return &SourceQuota{Remaining: info.QueryCredits, Period: "monthly"}, nil
+}
+
+// redactedError is an error whose message has a secret masked out. It
+// still unwraps to the original, so errors.Is sees ErrQuotaExhausted.
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactSecret masks secret out of the message of err.
+func redactSecret(err error, secret string) error {
+	if secret == "" {
+		return err
+	}
+	return &redactedError{msg: strings.ReplaceAll(err.Error(), secret, "REDACTED"), err: err}
+}
+
+type censysCertificateSearch struct {
+	Result struct {
+		Hits []struct {
+			Names []string `json:"names"`
+		} `json:"hits"`
+		Links struct {
+			Next string `json:"next"`
+		} `json:"links"`
+	} `json:"result"`
+}
+
+type censysAccount struct {
+	Quota struct {
+		Used      int `json:"used"`
+		Allowance int `json:"allowance"`
+	} `json:"quota"`
+}
+
+// collectFromCensys searches certificate names, following the next cursor.
+func (f *Finder) collectFromCensys(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	var run sourceRun
+	header := http.Header{}
+	header.Set("Authorization", basicAuth(f.apiKeys.CensysID, f.apiKeys.CensysSecret))
+	baseURL := f.sourceBaseURL(SourceCensys)
+	searchURL := fmt.Sprintf("%s/api/v2/certificates/search?per_page=100&q=%s", baseURL, neturl.QueryEscape("names: "+domain))
+
+	cursor := ""
+	for page := 0; ; page++ {
+		if page == f.maxIntelPages {
+			run.capped = true
+			break
+		}
+		url := searchURL
+		if cursor != "" {
+			url += "&cursor=" + neturl.QueryEscape(cursor)
+		}
+		var resp censysCertificateSearch
+		if err := f.intelJSON(ctx, SourceCensys, http.MethodGet, url, header, nil, &resp); err != nil {
+			return run, fmt.Errorf("censys request failed: %w", err)
+		}
+		for _, hit := range resp.Result.Hits {
+			for _, name := range hit.Names {
+				addIntelName(results, name, SourceCensys, domain)
+			}
+		}
+		next := resp.Result.Links.Next
+		if next == "" || next == cursor || len(resp.Result.Hits) == 0 {
+			break
+		}
+		cursor = next
+	}
+
+	return run, nil
+}
+
+func (f *Finder) censysQuota(ctx context.Context) (*SourceQuota, error) {
+	header := http.Header{}
+	header.Set("Authorization", basicAuth(f.apiKeys.CensysID, f.apiKeys.CensysSecret))
+	var account censysAccount
+	if err := f.intelJSON(ctx, SourceCensys, http.MethodGet, f.sourceBaseURL(SourceCensys)+"/api/v1/account", header, nil, &account); err != nil {
+		return nil, err
+	}
+	q := account.Quota
+	return &SourceQuota{Used: q.Used, Limit: q.Allowance, Remaining: max(q.Allowance-q.Used, 0), Period: "monthly"}, nil
+}
+
+func basicAuth(user, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+}
@@ -0,0 +1,211 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// intelStandIn serves canned responses for the keyed APIs, checking the
+// credentials each one expects.
+func intelStandIn(t *testing.T, keys APIKeys) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	json := func(w http.ResponseWriter, body string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}
+	header := func(key, want string, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get(key) != want {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("GET /api/v3/domains/example.com/subdomains", header("X-Apikey", keys.VirusTotal, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			json(w, `{"data":[{"id":"www.example.com"},{"id":"other.test"}],"meta":{"cursor":"c2"}}`)
+			return
+		}
+		json(w, `{"data":[{"id":"mail.example.com"}],"meta":{}}`)
+	}))
+	mux.HandleFunc("GET /api/v3/users/{key}/overall_quotas", header("X-Apikey", keys.VirusTotal, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"data":{"api_requests_daily":{"user":{"used":10,"allowed":500}}}}`)
+	}))
+
+	mux.HandleFunc("GET /v1/domain/example.com/subdomains", header("Apikey", keys.SecurityTrails, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"subdomains":["api","dev"],"meta":{"limit_reached":true}}`)
+	}))
+	mux.HandleFunc("POST /v1/domains/list", header("Apikey", keys.SecurityTrails, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"records":[{"hostname":"old.example.com"}],"meta":{"scroll_id":"s1"}}`)
+	}))
+	mux.HandleFunc("GET /v1/scroll/s1", header("Apikey", keys.SecurityTrails, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"records":[],"meta":{}}`)
+	}))
+	mux.HandleFunc("GET /v1/account/usage", header("Apikey", keys.SecurityTrails, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"current_monthly_usage":40,"allowed_monthly_usage":50}`)
+	}))
+
+	shodanKey := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("key") != keys.Shodan {
+				http.Error(w, "bad key", http.StatusUnauthorized)
+				return
+			}
+			next(w, r)
+		}
+	}
+	mux.HandleFunc("GET /dns/domain/example.com", shodanKey(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "1" {
+			json(w, `{"subdomains":["","vpn"],"more":true}`)
+			return
+		}
+		json(w, `{"subdomains":["shop"],"more":false}`)
+	}))
+	mux.HandleFunc("GET /api-info", shodanKey(func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"query_credits":99}`)
+	}))
+
+	censysAuth := basicAuth(keys.CensysID, keys.CensysSecret)
+	mux.HandleFunc("GET /api/v2/certificates/search", header("Authorization", censysAuth, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("cursor") == "" {
+			json(w, `{"result":{"hits":[{"names":["*.cdn.example.com","example.com"]}],"links":{"next":"n2"}}}`)
+			return
+		}
+		json(w, `{"result":{"hits":[],"links":{}}}`)
+	}))
+	mux.HandleFunc("GET /api/v1/account", header("Authorization", censysAuth, func(w http.ResponseWriter, r *http.Request) {
+		json(w, `{"quota":{"used":7,"allowance":250}}`)
+	}))
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func standInFinder(baseURL string, keys APIKeys, opts ...FinderOption) *Finder {
+	opts = append([]FinderOption{
+		WithAPIKeys(keys),
+		WithIntelSources(IntelSources...),
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 1}),
+	}, opts...)
+	for _, source := range IntelSources {
+		opts = append(opts, WithSourceBaseURL(source, baseURL))
+	}
+	return NewFinder(opts...)
+}
+
+func TestIntelSources(t *testing.T) {
+	keys := APIKeys{
+		VirusTotal:     "vt-key",
+		SecurityTrails: "st-key",
+		Shodan:         "shodan-key",
+		CensysID:       "censys-id",
+		CensysSecret:   "censys-secret",
+	}
+	srv := intelStandIn(t, keys)
+
+	tests := []struct {
+		source    string
+		wantNames []string
+		wantQuota SourceQuota
+	}{
+		{SourceVirusTotal, []string{"mail.example.com", "www.example.com"}, SourceQuota{Used: 10, Limit: 500, Remaining: 490, Period: "daily"}},
+		{SourceSecurityTrails, []string{"api.example.com", "dev.example.com", "old.example.com"}, SourceQuota{Used: 40, Limit: 50, Remaining: 10, Period: "monthly"}},
+		{SourceShodan, []string{"example.com", "shop.example.com", "vpn.example.com"}, SourceQuota{Remaining: 99, Period: "monthly"}},
+		{SourceCensys, []string{"cdn.example.com", "example.com"}, SourceQuota{Used: 7, Limit: 250, Remaining: 243, Period: "monthly"}},
+	}
+
+	f := standInFinder(srv.URL, keys)
+	sources := make(map[string]discoverySource)
+	for _, source := range f.intelSources() {
+		sources[source.name] = source
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			results := make(map[string]Subdomain)
+			run, err := sources[tt.source].collect(context.Background(), "example.com", results)
+			if err != nil {
+				t.Fatalf("collect: %v", err)
+			}
+			var names []string
+			for name := range results {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+			if run.quota == nil || *run.quota != tt.wantQuota {
+				t.Errorf("quota = %+v, want %+v", run.quota, tt.wantQuota)
+			}
+		})
+	}
+}
+
+func TestIntelSourcesWithoutKey(t *testing.T) {
+	f := NewFinder(WithIntelSources(SourceShodan))
+	sources := f.intelSources()
+	if len(sources) != 1 {
+		t.Fatalf("got %d sources, want 1", len(sources))
+	}
+	run, err := sources[0].collect(context.Background(), "example.com", map[string]Subdomain{})
+	if err != nil || run.skipped == "" {
+		t.Errorf("run = %+v, err = %v; want skipped", run, err)
+	}
+}
+
+func TestIntelQuotaExhausted(t *testing.T) {
+	const key = "shodan-secret"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of credits", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	f := standInFinder(srv.URL, APIKeys{Shodan: key})
+	var shodan discoverySource
+	for _, source := range f.intelSources() {
+		if source.name == SourceShodan {
+			shodan = source
+		}
+	}
+	run, err := shodan.collect(context.Background(), "example.com", map[string]Subdomain{})
+	if !errors.Is(err, ErrQuotaExhausted) {
+		t.Fatalf("err = %v, want ErrQuotaExhausted", err)
+	}
+	if strings.Contains(err.Error(), key) {
+		t.Errorf("error leaks the key: %v", err)
+	}
+	if run.quota == nil || run.quota.Remaining != 0 {
+		t.Errorf("quota = %+v, want an exhausted quota", run.quota)
+	}
+}
+
+func TestRedactURLError(t *testing.T) {
+	const key = "shodan-secret"
+	srv := httptest.NewServer(http.NotFoundHandler())
+	baseURL := srv.URL
+	srv.Close()
+
+	f := standInFinder(baseURL, APIKeys{Shodan: key})
+	_, err := f.doWithRetry(context.Background(), SourceShodan, func() (*http.Request, error) {
+		return http.NewRequest(http.MethodGet, baseURL+"/api-info?key="+key, nil)
+	})
+	if err == nil {
+		t.Fatal("expected a connection error")
+	}
+	if strings.Contains(err.Error(), key) || strings.Contains(err.Error(), "/api-info") {
+		t.Errorf("error keeps the path or query: %v", err)
+	}
+	if !strings.Contains(err.Error(), baseURL) {
+		t.Errorf("error lost the host: %v", err)
+	}
+}
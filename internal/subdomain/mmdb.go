@@ -0,0 +1,438 @@
+// Minimal reader for the MaxMind DB (MMDB) file format.
+
+package subdomain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errMMDBCorrupt = errors.New("mmdb: corrupt database")
+
+// MMDB is an in-memory MaxMind DB, such as GeoLite2-ASN or the ipinfo ASN
+// database.
+type MMDB struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+// OpenMMDB reads a MaxMind DB file into memory.
+func OpenMMDB(path string) (*MMDB, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMMDB(buf)
+}
+
+// ParseMMDB parses a MaxMind DB held in buf.
+func ParseMMDB(buf []byte) (*MMDB, error) {
+	idx := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, errors.New("mmdb: metadata marker not found")
+	}
+	metaStart := uint(idx + len(mmdbMetadataMarker))
+	dec := mmdbDecoder{buf: buf[metaStart:]}
+	raw, _, err := dec.decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb metadata: %w", err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errMMDBCorrupt
+	}
+
+	db := &MMDB{
+		buf:        buf,
+		nodeCount:  uint(mmdbUint(meta["node_count"])),
+		recordSize: uint(mmdbUint(meta["record_size"])),
+		ipVersion:  uint(mmdbUint(meta["ip_version"])),
+	}
+	switch db.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", db.recordSize)
+	}
+	treeSize := db.recordSize * 2 / 8 * db.nodeCount
+	db.dataStart = treeSize + 16
+	if db.dataStart > uint(idx) {
+		return nil, errMMDBCorrupt
+	}
+
+	if db.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < db.nodeCount; i++ {
+			node, err = db.readNode(node, 0)
+			if err != nil {
+				return nil, err
+			}
+		}
+		db.ipv4Start = node
+	}
+	return db, nil
+}
+
+// Lookup returns the decoded record for ip and the prefix length of the
+// network it belongs to. IPv4 lengths count from the start of the IPv4
+// address, also in IPv6 databases.
+func (db *MMDB) Lookup(ip netip.Addr) (any, int, error) {
+	ip = ip.Unmap()
+	node := uint(0)
+	raw := ip.AsSlice()
+	bitCount := len(raw) * 8
+	if ip.Is4() && db.ipVersion == 6 {
+		node = db.ipv4Start
+	} else if !ip.Is4() && db.ipVersion == 4 {
+		return nil, 0, nil
+	}
+
+	depth := 0
+	for ; depth < bitCount && node < db.nodeCount; depth++ {
+		bit := uint(raw[depth/8]>>(7-depth%8)) & 1
+		next, err := db.readNode(node, bit)
+		if err != nil {
+			return nil, 0, err
+		}
+		node = next
+	}
+	if node == db.nodeCount {
+		return nil, depth, nil
+	}
+	if node < db.nodeCount {
+		return nil, 0, errMMDBCorrupt
+	}
+
+	offset := node - db.nodeCount - 16
+	dec := mmdbDecoder{buf: db.buf[db.dataStart:]}
+	value, _, err := dec.decode(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	return value, depth, nil
+}
+
+// LookupASN implements ASNDatabase for GeoLite2-ASN and ipinfo style
+// databases.
+func (db *MMDB) LookupASN(ip netip.Addr) (ASNRecord, bool) {
+	value, bits, err := db.Lookup(ip)
+	if err != nil || value == nil {
+		return ASNRecord{}, false
+	}
+	rec, ok := mmdbASNRecord(value)
+	if !ok {
+		return ASNRecord{}, false
+	}
+
+	// Lookup starts IPv4 addresses at the IPv4 subtree, so bits is
+	// already relative to the 32-bit address.
+	addr := ip.Unmap()
+	if prefix, err := addr.Prefix(bits); err == nil {
+		rec.Network = prefix.String()
+	}
+	return rec, true
+}
+
+// mmdbASNRecord reads the ASN fields of a decoded data record.
+func mmdbASNRecord(value any) (ASNRecord, bool) {
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return ASNRecord{}, false
+	}
+
+	rec := ASNRecord{}
+	switch asn := fields["autonomous_system_number"].(type) {
+	case nil:
+		if s, ok := fields["asn"].(string); ok {
+			n, _ := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+			rec.ASN = uint32(n)
+		} else {
+			rec.ASN = uint32(mmdbUint(fields["asn"]))
+		}
+	default:
+		rec.ASN = uint32(mmdbUint(asn))
+	}
+	if rec.ASN == 0 {
+		return ASNRecord{}, false
+	}
+	for _, key := range []string{"autonomous_system_organization", "as_name", "name"} {
+		if org, ok := fields[key].(string); ok && org != "" {
+			rec.Org = org
+			break
+		}
+	}
+	for _, key := range []string{"country_code", "country"} {
+		if country, ok := fields[key].(string); ok && country != "" {
+			rec.Country = country
+			break
+		}
+	}
+	return rec, true
+}
+
+// Prefixes walks the search tree and returns every network whose record
+// names asn. IPv4 networks are reported once even when the database
+// aliases the IPv4 tree under IPv6 prefixes.
+func (db *MMDB) Prefixes(asn uint32) []netip.Prefix {
+	matches := make(map[uint]bool)
+	var out []netip.Prefix
+	var walk func(node uint, addr []byte, depth int, skipV4 bool)
+	walk = func(node uint, addr []byte, depth int, skipV4 bool) {
+		if skipV4 && depth > 0 && node == db.ipv4Start {
+			return
+		}
+		if node == db.nodeCount {
+			return
+		}
+		if node > db.nodeCount {
+			offset := node - db.nodeCount - 16
+			match, ok := matches[offset]
+			if !ok {
+				dec := mmdbDecoder{buf: db.buf[db.dataStart:]}
+				if value, _, err := dec.decode(offset); err == nil {
+					rec, found := mmdbASNRecord(value)
+					match = found && rec.ASN == asn
+				}
+				matches[offset] = match
+			}
+			if match {
+				ip, _ := netip.AddrFromSlice(addr)
+				out = append(out, netip.PrefixFrom(ip, depth))
+			}
+			return
+		}
+		if depth >= len(addr)*8 {
+			return
+		}
+		for bit := uint(0); bit < 2; bit++ {
+			next, err := db.readNode(node, bit)
+			if err != nil {
+				return
+			}
+			child := append([]byte(nil), addr...)
+			child[depth/8] |= byte(bit) << (7 - depth%8)
+			walk(next, child, depth+1, skipV4)
+		}
+	}
+
+	if db.ipVersion == 6 {
+		walk(db.ipv4Start, make([]byte, 4), 0, false)
+		walk(0, make([]byte, 16), 0, true)
+	} else {
+		walk(0, make([]byte, 4), 0, false)
+	}
+	return out
+}
+
+func (db *MMDB) readNode(node, bit uint) (uint, error) {
+	size := db.recordSize * 2 / 8
+	base := node * size
+	if base+size > uint(len(db.buf)) {
+		return 0, errMMDBCorrupt
+	}
+	b := db.buf[base : base+size]
+
+	switch db.recordSize {
+	case 24:
+		off := bit * 3
+		return uint(b[off])<<16 | uint(b[off+1])<<8 | uint(b[off+2]), nil
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3]&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:])), nil
+	}
+}
+
+type mmdbDecoder struct {
+	buf []byte
+}
+
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// decode reads the value at offset and returns it together with the offset
+// of the next value.
+func (d *mmdbDecoder) decode(offset uint) (any, uint, error) {
+	if offset >= uint(len(d.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := uint(ctrl >> 5)
+
+	if typ == mmdbPointer {
+		ptr, next, err := d.decodePointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(ptr)
+		return value, next, err
+	}
+
+	if typ == mmdbExtended {
+		if offset >= uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		typ = 7 + uint(d.buf[offset])
+		offset++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		extra := size - 28
+		if offset+extra > uint(len(d.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		n := uint(0)
+		for _, b := range d.buf[offset : offset+extra] {
+			n = n<<8 | uint(b)
+		}
+		offset += extra
+		switch size {
+		case 29:
+			size = 29 + n
+		case 30:
+			size = 285 + n
+		default:
+			size = 65821 + n
+		}
+	}
+
+	switch typ {
+	case mmdbMap:
+		out := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			value, after, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, errMMDBCorrupt
+			}
+			out[name] = value
+			offset = after
+		}
+		return out, offset, nil
+	case mmdbArray:
+		out := make([]any, 0, size)
+		for i := uint(0); i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			out = append(out, value)
+			offset = next
+		}
+		return out, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbContainer, mmdbEndMarker:
+		return nil, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	raw := d.buf[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case mmdbString:
+		return string(raw), offset, nil
+	case mmdbBytes:
+		return append([]byte(nil), raw...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(raw)), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64, mmdbUint128:
+		n := uint64(0)
+		for _, b := range raw {
+			n = n<<8 | uint64(b)
+		}
+		return n, offset, nil
+	case mmdbInt32:
+		n := uint32(0)
+		for _, b := range raw {
+			n = n<<8 | uint32(b)
+		}
+		return int64(int32(n)), offset, nil
+	}
+	return nil, 0, fmt.Errorf("mmdb: unknown data type %d", typ)
+}
+
+func (d *mmdbDecoder) decodePointer(ctrl byte, offset uint) (uint, uint, error) {
+	size := uint(ctrl>>3) & 0x3
+	width := size + 1
+	if offset+width > uint(len(d.buf)) {
+		return 0, 0, errMMDBCorrupt
+	}
+	n := uint(0)
+	if size < 3 {
+		n = uint(ctrl & 0x7)
+	}
+	for _, b := range d.buf[offset : offset+width] {
+		n = n<<8 | uint(b)
+	}
+	switch size {
+	case 1:
+		n += 2048
+	case 2:
+		n += 526336
+	}
+	return n, offset + width, nil
+}
+
+func mmdbUint(value any) uint64 {
+	switch v := value.(type) {
+	case uint64:
+		return v
+	case int64:
+		if v > 0 {
+			return uint64(v)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,284 @@
+package subdomain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mmdbWriter builds small MaxMind DB files for tests.
+type mmdbWriter struct {
+	recordSize uint
+	ipVersion  uint
+	// nodes hold child records: a node index, mmdbEmpty, or a data
+	// offset encoded by mmdbData.
+	nodes [][2]int
+	data  []byte
+}
+
+const mmdbEmpty = -1
+
+func mmdbData(offset int) int { return -2 - offset }
+
+func newMMDBWriter(recordSize, ipVersion uint) *mmdbWriter {
+	return &mmdbWriter{recordSize: recordSize, ipVersion: ipVersion, nodes: [][2]int{{mmdbEmpty, mmdbEmpty}}}
+}
+
+// insert points prefix at the data record at offset. IPv4 prefixes in an
+// IPv6 tree go under ::/96, as MaxMind lays them out.
+func (w *mmdbWriter) insert(prefix string, offset int) {
+	p := netip.MustParsePrefix(prefix)
+	raw, bits := p.Addr().AsSlice(), p.Bits()
+	if p.Addr().Is4() && w.ipVersion == 6 {
+		raw, bits = append(make([]byte, 12), raw...), bits+96
+	}
+	node := 0
+	for depth := 0; depth < bits; depth++ {
+		bit := raw[depth/8] >> (7 - depth%8) & 1
+		if depth == bits-1 {
+			w.nodes[node][bit] = mmdbData(offset)
+			return
+		}
+		if w.nodes[node][bit] == mmdbEmpty {
+			w.nodes = append(w.nodes, [2]int{mmdbEmpty, mmdbEmpty})
+			w.nodes[node][bit] = len(w.nodes) - 1
+		}
+		node = w.nodes[node][bit]
+	}
+}
+
+// value appends an encoded value to the data section and returns its
+// offset.
+func (w *mmdbWriter) value(encoded []byte) int {
+	w.data = append(w.data, encoded...)
+	return len(w.data) - len(encoded)
+}
+
+func (w *mmdbWriter) bytes() []byte {
+	count := len(w.nodes)
+	var buf []byte
+	for _, node := range w.nodes {
+		var rec [2]uint
+		for i, child := range node {
+			switch {
+			case child == mmdbEmpty:
+				rec[i] = uint(count)
+			case child < mmdbEmpty:
+				rec[i] = uint(count + 16 + (-2 - child))
+			default:
+				rec[i] = uint(child)
+			}
+		}
+		buf = append(buf, encodeMMDBNode(w.recordSize, rec[0], rec[1])...)
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, w.data...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, mmdbMapValue(
+		"binary_format_major_version", mmdbUintValue(mmdbUint16, 2),
+		"database_type", mmdbStringValue("Test-ASN"),
+		"ip_version", mmdbUintValue(mmdbUint16, uint64(w.ipVersion)),
+		"node_count", mmdbUintValue(mmdbUint32, uint64(count)),
+		"record_size", mmdbUintValue(mmdbUint16, uint64(w.recordSize)),
+	)...)
+	return buf
+}
+
+func encodeMMDBNode(recordSize, left, right uint) []byte {
+	switch recordSize {
+	case 24:
+		return []byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)}
+	case 28:
+		return []byte{
+			byte(left >> 16), byte(left >> 8), byte(left),
+			byte(left>>24&0x0F)<<4 | byte(right>>24&0x0F),
+			byte(right >> 16), byte(right >> 8), byte(right),
+		}
+	default:
+		return binary.BigEndian.AppendUint32(binary.BigEndian.AppendUint32(nil, uint32(left)), uint32(right))
+	}
+}
+
+func mmdbControl(typ int, size int) []byte {
+	var ctrl []byte
+	if typ > 7 {
+		ctrl = []byte{0, byte(typ - 7)}
+	} else {
+		ctrl = []byte{byte(typ << 5)}
+	}
+	switch {
+	case size < 29:
+		ctrl[0] |= byte(size)
+	case size < 285:
+		ctrl[0] |= 29
+		ctrl = append(ctrl, byte(size-29))
+	default:
+		ctrl[0] |= 30
+		ctrl = append(ctrl, byte((size-285)>>8), byte(size-285))
+	}
+	return ctrl
+}
+
+func mmdbStringValue(s string) []byte {
+	return append(mmdbControl(mmdbString, len(s)), s...)
+}
+
+func mmdbUintValue(typ int, n uint64) []byte {
+	var raw []byte
+	for ; n > 0; n >>= 8 {
+		raw = append([]byte{byte(n)}, raw...)
+	}
+	return append(mmdbControl(typ, len(raw)), raw...)
+}
+
+// mmdbPointerValue picks the smallest pointer encoding for offset.
+func mmdbPointerValue(offset int) []byte {
+	switch {
+	case offset < 2048:
+		return []byte{mmdbPointer<<5 | byte(offset>>8), byte(offset)}
+	case offset < 526336:
+		n := offset - 2048
+		return []byte{mmdbPointer<<5 | 1<<3 | byte(n>>16), byte(n >> 8), byte(n)}
+	default:
+		n := offset - 526336
+		return []byte{mmdbPointer<<5 | 2<<3 | byte(n>>24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+}
+
+// mmdbMapValue encodes alternating keys and values; a string key is encoded
+// inline, a []byte key is used as is (for pointers).
+func mmdbMapValue(pairs ...any) []byte {
+	out := mmdbControl(mmdbMap, len(pairs)/2)
+	for _, v := range pairs {
+		switch v := v.(type) {
+		case string:
+			out = append(out, mmdbStringValue(v)...)
+		case []byte:
+			out = append(out, v...)
+		}
+	}
+	return out
+}
+
+// testASNDatabase holds three networks: a plain record, one whose key and
+// value are pointers into the first, and an IPv6 network. Padding puts the
+// records past the 11-bit pointer range.
+func testASNDatabase(t *testing.T, recordSize, ipVersion uint) *MMDB {
+	t.Helper()
+	w := newMMDBWriter(recordSize, ipVersion)
+	w.value(mmdbStringValue(strings.Repeat("x", 3000)))
+
+	first := w.value(mmdbControl(mmdbMap, 3))
+	w.value(mmdbStringValue("autonomous_system_number"))
+	w.value(mmdbUintValue(mmdbUint32, 64496))
+	orgKey := w.value(mmdbStringValue("autonomous_system_organization"))
+	orgValue := w.value(mmdbStringValue("Example Org"))
+	w.value(mmdbStringValue("country"))
+	w.value(mmdbStringValue("NL"))
+
+	second := w.value(mmdbMapValue(
+		"autonomous_system_number", mmdbUintValue(mmdbUint32, 64497),
+		mmdbPointerValue(orgKey), mmdbPointerValue(orgValue),
+	))
+	third := w.value(mmdbMapValue(
+		"asn", mmdbStringValue("AS64498"),
+		"name", mmdbStringValue("IPv6 Net"),
+	))
+
+	w.insert("192.0.2.0/24", first)
+	w.insert("198.51.100.0/25", second)
+	// The pointer-only record is reached through a pointer too.
+	w.insert("198.51.100.128/25", w.value(mmdbPointerValue(second)))
+	if ipVersion == 6 {
+		w.insert("2001:db8::/32", third)
+	}
+
+	db, err := ParseMMDB(w.bytes())
+	if err != nil {
+		t.Fatalf("ParseMMDB: %v", err)
+	}
+	return db
+}
+
+func TestMMDBLookupASN(t *testing.T) {
+	tests := []struct {
+		ip      string
+		want    ASNRecord
+		found   bool
+		onlyIn6 bool
+	}{
+		{ip: "192.0.2.77", want: ASNRecord{ASN: 64496, Org: "Example Org", Country: "NL", Network: "192.0.2.0/24"}, found: true},
+		{ip: "::ffff:192.0.2.1", want: ASNRecord{ASN: 64496, Org: "Example Org", Country: "NL", Network: "192.0.2.0/24"}, found: true},
+		{ip: "198.51.100.5", want: ASNRecord{ASN: 64497, Org: "Example Org", Network: "198.51.100.0/25"}, found: true},
+		{ip: "198.51.100.200", want: ASNRecord{ASN: 64497, Org: "Example Org", Network: "198.51.100.128/25"}, found: true},
+		{ip: "203.0.113.1"},
+		{ip: "2001:db8::1", want: ASNRecord{ASN: 64498, Org: "IPv6 Net", Network: "2001:db8::/32"}, found: true, onlyIn6: true},
+		{ip: "2001:db9::1"},
+	}
+	for _, recordSize := range []uint{24, 28, 32} {
+		for _, ipVersion := range []uint{4, 6} {
+			t.Run(fmt.Sprintf("%d-bit v%d", recordSize, ipVersion), func(t *testing.T) {
+				db := testASNDatabase(t, recordSize, ipVersion)
+				for _, tt := range tests {
+					want, found := tt.want, tt.found
+					if tt.onlyIn6 && ipVersion == 4 {
+						want, found = ASNRecord{}, false
+					}
+					got, ok := db.LookupASN(netip.MustParseAddr(tt.ip))
+					if ok != found || got != want {
+						t.Errorf("LookupASN(%s) = %+v, %v; want %+v, %v", tt.ip, got, ok, want, found)
+					}
+				}
+
+				wantPrefixes := []netip.Prefix{netip.MustParsePrefix("198.51.100.0/25"), netip.MustParsePrefix("198.51.100.128/25")}
+				if got := db.Prefixes(64497); !reflect.DeepEqual(got, wantPrefixes) {
+					t.Errorf("Prefixes(64497) = %v, want %v", got, wantPrefixes)
+				}
+			})
+		}
+	}
+}
+
+func TestMMDBReadNode(t *testing.T) {
+	tests := []struct {
+		recordSize  uint
+		node        []byte
+		left, right uint
+	}{
+		{24, []byte{0x12, 0x34, 0x56, 0x78, 0x9A, 0xBC}, 0x123456, 0x789ABC},
+		{28, []byte{0x12, 0x34, 0x56, 0xAB, 0x78, 0x9A, 0xBC}, 0xA123456, 0xB789ABC},
+		{32, []byte{0xDE, 0xAD, 0xBE, 0xEF, 0x01, 0x02, 0x03, 0x04}, 0xDEADBEEF, 0x01020304},
+	}
+	for _, tt := range tests {
+		db := &MMDB{buf: tt.node, recordSize: tt.recordSize, nodeCount: 1}
+		left, errL := db.readNode(0, 0)
+		right, errR := db.readNode(0, 1)
+		if errL != nil || errR != nil || left != tt.left || right != tt.right {
+			t.Errorf("%d-bit readNode = %#x, %#x (%v, %v); want %#x, %#x", tt.recordSize, left, right, errL, errR, tt.left, tt.right)
+		}
+		if !bytes.Equal(encodeMMDBNode(tt.recordSize, tt.left, tt.right), tt.node) {
+			t.Errorf("%d-bit test encoder disagrees with the fixture", tt.recordSize)
+		}
+	}
+}
+
+func TestParseMMDBErrors(t *testing.T) {
+	good := newMMDBWriter(24, 4).bytes()
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"no marker", []byte("not a database")},
+		{"bad record size", bytes.Replace(good, mmdbUintValue(mmdbUint16, 24), mmdbUintValue(mmdbUint16, 20), 1)},
+		{"tree past metadata", bytes.Replace(good, mmdbUintValue(mmdbUint32, 1), mmdbUintValue(mmdbUint32, 200), 1)},
+	}
+	for _, tt := range tests {
+		if _, err := ParseMMDB(tt.buf); err == nil {
+			t.Errorf("%s: ParseMMDB succeeded", tt.name)
+		}
+	}
+}
@@ -1,10 +1,236 @@
 package subdomain
 
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion identifies the layout of Subdomain. It is bumped whenever
+// fields are renamed or change type.
+const SchemaVersion = 2
+
 // Subdomain captures data discovered for a subdomain name.
 type Subdomain struct {
+	Name         string        `json:"name"`
+	ETLDPlusOne  string        `json:"etld_plus_one,omitempty"`
+	IDN          *IDNInfo      `json:"idn,omitempty"`
+	Sources      []string      `json:"sources,omitempty"`
+	Discoveries  []Discovery   `json:"discoveries,omitempty"`
+	Confidence   float64       `json:"confidence"`
+	Alive        bool          `json:"alive"`
+	FirstSeen    time.Time     `json:"first_seen,omitzero"`
+	LastSeen     time.Time     `json:"last_seen,omitzero"`
+	Certificates []Certificate `json:"certificates,omitempty"`
+	CertTimeline *CertTimeline `json:"cert_timeline,omitempty"`
+	IPs          []IPRecord    `json:"ips,omitempty"`
+	Technologies []Technology  `json:"technologies,omitempty"`
+	Services     []Service     `json:"services,omitempty"`
+}
+
+// Certificate is a certificate that listed the subdomain. Precert is true
+// when only the precertificate was seen, recognised by the CT poison
+// extension, and false for a final or served certificate; it is unset when
+// the source does not say, as with crt.sh.
+type Certificate struct {
+	Issuer     string    `json:"issuer,omitempty"`
+	Serial     string    `json:"serial,omitempty"`
+	NotBefore  time.Time `json:"not_before,omitzero"`
+	NotAfter   time.Time `json:"not_after,omitzero"`
+	Source     string    `json:"source,omitempty"`
+	Precert    *bool     `json:"precert,omitempty"`
+	SANCount   int       `json:"san_count,omitempty"`
+	LogEntries int       `json:"log_entries,omitempty"`
+}
+
+// IPRecord holds everything known about one address a subdomain resolves to.
+type IPRecord struct {
+	Address string       `json:"address"`
+	Owner   *IPOwnerInfo `json:"owner,omitempty"`
+	Cloud   *CloudInfo   `json:"cloud,omitempty"`
+	Ports   []OpenPort   `json:"ports,omitempty"`
+	// PTR holds the reverse DNS names found by the PTR sweep. PTRMismatch
+	// is set when none of them resolves back to Address.
+	PTR         []string `json:"ptr,omitempty"`
+	PTRMismatch bool     `json:"ptr_mismatch,omitempty"`
+}
+
+// ScanResult bundles everything a single scan discovered for a domain.
+type ScanResult struct {
+	Domain string
+	// UnicodeDomain is Domain with punycode labels decoded; it equals
+	// Domain for ASCII names.
+	UnicodeDomain string
+	// ETLDPlusOne is the registrable domain Domain belongs to; it is empty
+	// for a forced scan of a public suffix.
+	ETLDPlusOne    string
+	HasWildcard    bool
+	Subdomains     map[string]Subdomain
+	RelatedDomains []string
+	Sources        []SourceStatus
+	// DNSRecords lists hosts and third-party services found in the
+	// domain's mail, delegation and verification records.
+	DNSRecords []RecordFinding
+	// Excluded lists names that were found but left out, with the reason.
+	Excluded []Exclusion
+	// ActiveSkipped explains why TLS inspection, port scanning and HTTP
+	// probing did not run; it is empty when they ran or were disabled.
+	ActiveSkipped string
+	// PTRMismatches lists in-scope names from the PTR sweep that do not
+	// resolve back to the address they were found on.
+	PTRMismatches []PTRRecord
+	// Partial is set when a source failed or the context expired before
+	// every stage finished; Subdomains then holds what was collected.
+	Partial bool
+}
+
+// Exclusion is a name or address kept out of the results.
+type Exclusion struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// SourceStatus reports how a discovery source fared during a scan.
+type SourceStatus struct {
+	Source     string       `json:"source"`
+	OK         bool         `json:"ok"`
+	Error      string       `json:"error,omitempty"`
+	Items      int          `json:"items"`
+	Capped     bool         `json:"capped,omitempty"`
+	Skipped    bool         `json:"skipped,omitempty"`
+	SkipReason string       `json:"skip_reason,omitempty"`
+	Quota      *SourceQuota `json:"quota,omitempty"`
+	DurationMS int64        `json:"duration_ms"`
+}
+
+// SourceQuota is the API allowance a keyed source reported after a scan.
+// Limit is zero when the API only reports what is left.
+type SourceQuota struct {
+	Used      int    `json:"used,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	Remaining int    `json:"remaining"`
+	Period    string `json:"period,omitempty"`
+}
+
+// LegacySubdomain is the flat, schema version 1 shape of Subdomain kept for
+// existing API clients.
+type LegacySubdomain struct {
 	Name       string   `json:"name"`
 	IPs        []string `json:"ips,omitempty"`
 	IPOwner    string   `json:"ip_owner,omitempty"`
 	CertIssuer string   `json:"cert_issuer,omitempty"`
 	CertExpiry string   `json:"cert_expiry,omitempty"`
 }
+
+// Legacy returns the compatibility view of s. The most recently issued
+// certificate supplies the issuer and expiry.
+func (s Subdomain) Legacy() LegacySubdomain {
+	legacy := LegacySubdomain{
+		Name: s.Name,
+		IPs:  s.Addresses(),
+	}
+
+	owners := make([]string, 0, len(s.IPs))
+	for _, ip := range s.IPs {
+		if ip.Owner != nil {
+			owners = append(owners, ip.Owner.String())
+		}
+	}
+	legacy.IPOwner = strings.Join(uniqueStrings(owners), ", ")
+
+	for i := len(s.Certificates) - 1; i >= 0; i-- {
+		cert := s.Certificates[i]
+		if legacy.CertIssuer == "" && cert.Issuer != "" {
+			legacy.CertIssuer = cert.Issuer
+		}
+		if legacy.CertExpiry == "" && !cert.NotAfter.IsZero() {
+			legacy.CertExpiry = cert.NotAfter.UTC().Format(time.RFC3339)
+		}
+	}
+	return legacy
+}
+
+// Addresses returns the plain IP strings of s.
+func (s Subdomain) Addresses() []string {
+	out := make([]string, 0, len(s.IPs))
+	for _, ip := range s.IPs {
+		out = append(out, ip.Address)
+	}
+	return out
+}
+
+// observe records that source reported the subdomain at t.
+func (s *Subdomain) observe(source string, t time.Time) {
+	if source != "" {
+		s.recordDiscovery(source, t)
+		if !containsString(s.Sources, source) {
+			s.Sources = append(s.Sources, source)
+			sort.Strings(s.Sources)
+		}
+	}
+	if t.IsZero() {
+		return
+	}
+	if s.FirstSeen.IsZero() || t.Before(s.FirstSeen) {
+		s.FirstSeen = t
+	}
+	if t.After(s.LastSeen) {
+		s.LastSeen = t
+	}
+}
+
+// addCertificate appends cert, merging it into an existing entry when the
+// same certificate was already reported.
+func (s *Subdomain) addCertificate(cert Certificate) {
+	cert.Serial = normalizeSerial(cert.Serial)
+	for i := range s.Certificates {
+		if s.Certificates[i].sameAs(cert) {
+			s.Certificates[i].merge(cert)
+			return
+		}
+	}
+	s.Certificates = append(s.Certificates, cert)
+}
+
+// sameAs matches certificates by serial when both sides know it. Otherwise
+// it needs the same validity window and, when both sides name one, the same
+// issuer organization, since sources format issuer names differently. A
+// window with an unparsed bound matches nothing.
+func (c Certificate) sameAs(other Certificate) bool {
+	if c.Serial != "" && other.Serial != "" {
+		return c.Serial == other.Serial
+	}
+	if c.NotBefore.IsZero() || c.NotAfter.IsZero() {
+		return false
+	}
+	if !c.NotBefore.Equal(other.NotBefore) || !c.NotAfter.Equal(other.NotAfter) {
+		return false
+	}
+	if c.Issuer != "" && other.Issuer != "" {
+		return issuerOrganization(c.Issuer) == issuerOrganization(other.Issuer)
+	}
+	return true
+}
+
+// certTimeLayouts are the timestamp formats used by the CT sources.
+var certTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// parseCertTime parses a CT timestamp, treating values without a zone as UTC.
+func parseCertTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range certTimeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,463 @@
+// Pluggable IP ownership providers.
+
+package subdomain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ipinfoBaseURL        = "https://ipinfo.io"
+	rdapBootstrapV4URL   = "https://data.iana.org/rdap/ipv4.json"
+	rdapBootstrapV6URL   = "https://data.iana.org/rdap/ipv6.json"
+	rdapFallbackBaseURL  = "https://rdap.org/"
+	maxOwnerResponseSize = 1 << 20
+	// rdapBootstrapBackoff is how long a failed bootstrap fetch is
+	// remembered before the IANA files are requested again.
+	rdapBootstrapBackoff = 10 * time.Minute
+)
+
+// ErrOwnerNotFound is returned by providers that have no data for an IP.
+var ErrOwnerNotFound = errors.New("ip owner not found")
+
+// IPOwnerInfo is structured ownership data for a single IP.
+type IPOwnerInfo struct {
+	IP      string `json:"ip"`
+	ASN     uint32 `json:"asn,omitempty"`
+	Org     string `json:"org,omitempty"`
+	CIDR    string `json:"cidr,omitempty"`
+	Country string `json:"country,omitempty"`
+	Source  string `json:"source,omitempty"`
+}
+
+// String renders the owner as "AS<number> <org>" like ipinfo.io does.
+func (o IPOwnerInfo) String() string {
+	switch {
+	case o.ASN != 0 && o.Org != "":
+		return fmt.Sprintf("AS%d %s", o.ASN, o.Org)
+	case o.ASN != 0:
+		return fmt.Sprintf("AS%d", o.ASN)
+	}
+	return o.Org
+}
+
+// OwnerProvider looks up who owns an IP address.
+type OwnerProvider interface {
+	Name() string
+	LookupOwner(ctx context.Context, ip netip.Addr) (IPOwnerInfo, error)
+}
+
+// WithOwnerProviders sets the providers consulted for IP ownership, in
+// order. Later providers are only used when earlier ones fail.
+func WithOwnerProviders(providers ...OwnerProvider) FinderOption {
+	return func(f *Finder) {
+		var chain OwnerChain
+		for _, p := range providers {
+			if p != nil {
+				chain = append(chain, p)
+			}
+		}
+		if len(chain) > 0 {
+			f.ownerProvider = chain
+		}
+	}
+}
+
+// OwnerChain tries each provider in turn and returns the first answer.
+type OwnerChain []OwnerProvider
+
+func (c OwnerChain) Name() string {
+	names := make([]string, 0, len(c))
+	for _, p := range c {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (c OwnerChain) LookupOwner(ctx context.Context, ip netip.Addr) (IPOwnerInfo, error) {
+	var errs []error
+	for _, p := range c {
+		info, err := p.LookupOwner(ctx, ip)
+		if err == nil {
+			if info.Source == "" {
+				info.Source = p.Name()
+			}
+			return info, nil
+		}
+		if !errors.Is(err, ErrOwnerNotFound) {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name(), err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) == 0 {
+		return IPOwnerInfo{}, ErrOwnerNotFound
+	}
+	return IPOwnerInfo{}, errors.Join(errs...)
+}
+
+// ASNDatabaseProvider answers ownership queries from a local ASN database.
+type ASNDatabaseProvider struct {
+	DB ASNDatabase
+}
+
+func (p *ASNDatabaseProvider) Name() string { return "asndb" }
+
+func (p *ASNDatabaseProvider) LookupOwner(_ context.Context, ip netip.Addr) (IPOwnerInfo, error) {
+	rec, ok := p.DB.LookupASN(ip)
+	if !ok {
+		return IPOwnerInfo{}, ErrOwnerNotFound
+	}
+	return IPOwnerInfo{
+		IP:      ip.String(),
+		ASN:     rec.ASN,
+		Org:     rec.Org,
+		CIDR:    rec.Network,
+		Country: rec.Country,
+	}, nil
+}
+
+// IPInfoProvider queries the ipinfo.io JSON API. Token is optional but
+// unauthenticated requests are heavily rate limited.
+type IPInfoProvider struct {
+	Client    *http.Client
+	Token     string
+	UserAgent string
+	BaseURL   string
+	// Retry defaults to DefaultRetryPolicy.
+	Retry RetryPolicy
+}
+
+type ipinfoResponse struct {
+	Org     string `json:"org"`
+	Country string `json:"country"`
+	ASN     *struct {
+		ASN   string `json:"asn"`
+		Name  string `json:"name"`
+		Route string `json:"route"`
+	} `json:"asn"`
+}
+
+func (p *IPInfoProvider) Name() string { return "ipinfo" }
+
+func (p *IPInfoProvider) LookupOwner(ctx context.Context, ip netip.Addr) (IPOwnerInfo, error) {
+	base := p.BaseURL
+	if base == "" {
+		base = ipinfoBaseURL
+	}
+	url := fmt.Sprintf("%s/%s/json", strings.TrimSuffix(base, "/"), ip)
+	if p.Token != "" {
+		url += "?token=" + p.Token
+	}
+
+	var resp ipinfoResponse
+	if err := getOwnerJSON(ctx, p.Client, p.Retry, p.Name(), p.UserAgent, url, &resp); err != nil {
+		return IPOwnerInfo{}, err
+	}
+
+	info := IPOwnerInfo{IP: ip.String(), Country: resp.Country}
+	info.ASN, info.Org = parseASNOrg(resp.Org)
+	if resp.ASN != nil {
+		asn, _ := parseASNOrg(resp.ASN.ASN)
+		if asn != 0 {
+			info.ASN = asn
+		}
+		if resp.ASN.Name != "" {
+			info.Org = resp.ASN.Name
+		}
+		info.CIDR = resp.ASN.Route
+	}
+	if info.ASN == 0 && info.Org == "" {
+		return IPOwnerInfo{}, ErrOwnerNotFound
+	}
+	return info, nil
+}
+
+// parseASNOrg splits strings like "AS15169 Google LLC".
+func parseASNOrg(s string) (uint32, string) {
+	s = strings.TrimSpace(s)
+	head, rest, _ := strings.Cut(s, " ")
+	if len(head) > 2 && strings.EqualFold(head[:2], "AS") {
+		if n, err := strconv.ParseUint(head[2:], 10, 32); err == nil {
+			return uint32(n), strings.TrimSpace(rest)
+		}
+	}
+	return 0, s
+}
+
+// RDAPProvider queries the regional internet registry responsible for an IP
+// using the IANA RDAP bootstrap registry.
+type RDAPProvider struct {
+	Client    *http.Client
+	UserAgent string
+	// Retry defaults to DefaultRetryPolicy.
+	Retry RetryPolicy
+	// BootstrapURLs defaults to the IANA IPv4 and IPv6 registries.
+	BootstrapURLs []string
+
+	mu        sync.Mutex
+	loaded    bool
+	loading   bool
+	retryAt   time.Time
+	bootstrap []rdapService
+}
+
+type rdapService struct {
+	prefix netip.Prefix
+	base   string
+}
+
+type rdapBootstrapFile struct {
+	Services [][][]string `json:"services"`
+}
+
+type rdapNetwork struct {
+	Name         string       `json:"name"`
+	Handle       string       `json:"handle"`
+	Country      string       `json:"country"`
+	StartAddress string       `json:"startAddress"`
+	EndAddress   string       `json:"endAddress"`
+	Entities     []rdapEntity `json:"entities"`
+	CIDRs        []struct {
+		V4Prefix string `json:"v4prefix"`
+		V6Prefix string `json:"v6prefix"`
+		Length   int    `json:"length"`
+	} `json:"cidr0_cidrs"`
+	OriginAutnums []uint32 `json:"arin_originas0_originautnums"`
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+func (p *RDAPProvider) Name() string { return "rdap" }
+
+func (p *RDAPProvider) LookupOwner(ctx context.Context, ip netip.Addr) (IPOwnerInfo, error) {
+	ip = ip.Unmap()
+	base := p.baseURLFor(ctx, ip)
+
+	var network rdapNetwork
+	if err := getOwnerJSON(ctx, p.Client, p.Retry, p.Name(), p.UserAgent, base+"ip/"+ip.String(), &network); err != nil {
+		return IPOwnerInfo{}, err
+	}
+
+	info := IPOwnerInfo{
+		IP:      ip.String(),
+		Org:     rdapOrgName(network.Entities),
+		Country: network.Country,
+	}
+	if info.Org == "" {
+		info.Org = network.Name
+	}
+	if len(network.OriginAutnums) > 0 {
+		info.ASN = network.OriginAutnums[0]
+	}
+	for _, c := range network.CIDRs {
+		addr := c.V4Prefix
+		if addr == "" {
+			addr = c.V6Prefix
+		}
+		prefix, err := netip.ParsePrefix(fmt.Sprintf("%s/%d", addr, c.Length))
+		if err == nil && prefix.Contains(ip) {
+			info.CIDR = prefix.String()
+			break
+		}
+	}
+	if info.CIDR == "" {
+		start, errStart := netip.ParseAddr(network.StartAddress)
+		end, errEnd := netip.ParseAddr(network.EndAddress)
+		if errStart == nil && errEnd == nil {
+			info.CIDR = rangePrefix(ip, start.Unmap(), end.Unmap()).String()
+		}
+	}
+	if info.Org == "" && info.CIDR == "" {
+		return IPOwnerInfo{}, ErrOwnerNotFound
+	}
+	return info, nil
+}
+
+// rdapOrgName returns the formatted name of the registrant, falling back to
+// any other entity with a name.
+func rdapOrgName(entities []rdapEntity) string {
+	var fallback string
+	for _, role := range []string{"registrant", "administrative", ""} {
+		for _, entity := range entities {
+			if role != "" && !containsString(entity.Roles, role) {
+				continue
+			}
+			if name := vcardName(entity.VCardArray); name != "" {
+				if role == "registrant" {
+					return name
+				}
+				if fallback == "" {
+					fallback = name
+				}
+			}
+		}
+	}
+	return fallback
+}
+
+// vcardName extracts the "fn" property from a jCard array.
+func vcardName(raw json.RawMessage) string {
+	var card []json.RawMessage
+	if len(raw) == 0 || json.Unmarshal(raw, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	var props [][]json.RawMessage
+	if json.Unmarshal(card[1], &props) != nil {
+		return ""
+	}
+	for _, prop := range props {
+		if len(prop) < 4 {
+			continue
+		}
+		var name, value string
+		if json.Unmarshal(prop[0], &name) != nil || name != "fn" {
+			continue
+		}
+		if json.Unmarshal(prop[3], &value) == nil {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// baseURLFor returns the RDAP base URL of the registry responsible for ip,
+// or rdap.org when the bootstrap registry is unavailable.
+func (p *RDAPProvider) baseURLFor(ctx context.Context, ip netip.Addr) string {
+	best := -1
+	base := rdapFallbackBaseURL
+	for _, svc := range p.services(ctx) {
+		if svc.prefix.Contains(ip) && svc.prefix.Bits() > best {
+			best = svc.prefix.Bits()
+			base = svc.base
+		}
+	}
+	return base
+}
+
+// services returns the bootstrap registry, fetching it on first use. The
+// fetch runs outside the lock; lookups made meanwhile, and for
+// rdapBootstrapBackoff after a failed fetch, get no services and fall back
+// to rdap.org.
+func (p *RDAPProvider) services(ctx context.Context) []rdapService {
+	p.mu.Lock()
+	if p.loaded || p.loading || time.Now().Before(p.retryAt) {
+		defer p.mu.Unlock()
+		return p.bootstrap
+	}
+	p.loading = true
+	p.mu.Unlock()
+
+	var services []rdapService
+	var err error
+	urls := p.BootstrapURLs
+	if len(urls) == 0 {
+		urls = []string{rdapBootstrapV4URL, rdapBootstrapV6URL}
+	}
+	for _, url := range urls {
+		var file rdapBootstrapFile
+		if err = getOwnerJSON(ctx, p.Client, p.Retry, p.Name(), p.UserAgent, url, &file); err != nil {
+			break
+		}
+		services = append(services, parseRDAPBootstrap(file)...)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.loading = false
+	switch {
+	case err == nil:
+		p.bootstrap, p.loaded = services, true
+	case ctx.Err() == nil:
+		// A cancelled lookup says nothing about the registry; only real
+		// failures wait out the backoff.
+		p.retryAt = time.Now().Add(rdapBootstrapBackoff)
+	}
+	return p.bootstrap
+}
+
+func parseRDAPBootstrap(file rdapBootstrapFile) []rdapService {
+	var services []rdapService
+	for _, svc := range file.Services {
+		if len(svc) < 2 {
+			continue
+		}
+		var base string
+		for _, url := range svc[1] {
+			if strings.HasPrefix(url, "https://") {
+				base = url
+				break
+			}
+		}
+		if base == "" && len(svc[1]) > 0 {
+			base = svc[1][0]
+		}
+		if !strings.HasSuffix(base, "/") {
+			base += "/"
+		}
+		for _, cidr := range svc[0] {
+			if prefix, err := netip.ParsePrefix(cidr); err == nil {
+				services = append(services, rdapService{prefix: prefix, base: base})
+			}
+		}
+	}
+	return services
+}
+
+// getOwnerJSON fetches url through the shared retry loop and decodes the
+// JSON response into out.
+func getOwnerJSON(ctx context.Context, client *http.Client, policy RetryPolicy, source, userAgent, url string, out any) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if policy.MaxAttempts <= 0 {
+		policy = DefaultRetryPolicy
+	}
+	r := retrier{client: client, policy: policy}
+	resp, err := r.do(ctx, source, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		req.Header.Set("Accept", "application/json, application/rdap+json")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrOwnerNotFound
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxOwnerResponseSize)).Decode(out)
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,192 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Trimmed RDAP responses as returned by the registries.
+const (
+	arinNetwork = `{
+  "rdapConformance": ["nro_rdap_profile_0", "rdap_level_0", "cidr0", "arin_originas0"],
+  "objectClassName": "ip network",
+  "handle": "NET-8-8-8-0-2",
+  "startAddress": "8.8.8.0",
+  "endAddress": "8.8.8.255",
+  "ipVersion": "v4",
+  "name": "GOGL",
+  "type": "DIRECT ALLOCATION",
+  "entities": [{
+    "objectClassName": "entity",
+    "handle": "GOGL",
+    "roles": ["registrant"],
+    "vcardArray": ["vcard", [
+      ["version", {}, "text", "4.0"],
+      ["fn", {}, "text", "Google LLC"],
+      ["adr", {"label": "1600 Amphitheatre Parkway\nMountain View\nCA\n94043\nUnited States"}, "text", ["", "", "", "", "", "", ""]],
+      ["kind", {}, "text", "org"]
+    ]],
+    "entities": [{
+      "objectClassName": "entity",
+      "handle": "ABUSE5250-ARIN",
+      "roles": ["abuse"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Abuse"], ["kind", {}, "text", "group"]]]
+    }]
+  }],
+  "arin_originas0_originautnums": [15169],
+  "cidr0_cidrs": [{"v4prefix": "8.8.8.0", "length": 24}]
+}`
+	ripeNetwork = `{
+  "rdapConformance": ["cidr0", "rdap_level_0", "nro_rdap_profile_0"],
+  "objectClassName": "ip network",
+  "handle": "193.0.0.0 - 193.0.7.255",
+  "startAddress": "193.0.0.0",
+  "endAddress": "193.0.7.255",
+  "ipVersion": "v4",
+  "name": "RIPE-NCC",
+  "type": "ASSIGNED PA",
+  "country": "NL",
+  "entities": [
+    {"objectClassName": "entity", "handle": "RIPE-NCC-MNT", "roles": ["registrant"]},
+    {"objectClassName": "entity", "handle": "BRD-RIPE", "roles": ["technical", "administrative"]},
+    {
+      "objectClassName": "entity",
+      "handle": "ORG-RIEN1-RIPE",
+      "roles": ["registrant"],
+      "vcardArray": ["vcard", [
+        ["version", {}, "text", "4.0"],
+        ["fn", {}, "text", "Reseaux IP Europeens Network Coordination Centre (RIPE NCC)"],
+        ["kind", {}, "text", "org"],
+        ["adr", {"label": "P.O. Box 10096\n1001EB\nAmsterdam\nNETHERLANDS"}, "text", null]
+      ]]
+    }
+  ]
+}`
+	apnicNetwork = `{
+  "objectClassName": "ip network",
+  "handle": "1.1.1.0 - 1.1.1.255",
+  "startAddress": "1.1.1.0",
+  "endAddress": "1.1.1.255",
+  "ipVersion": "v4",
+  "name": "APNIC-LABS",
+  "type": "ASSIGNED PORTABLE",
+  "country": "AU",
+  "entities": [
+    {
+      "objectClassName": "entity",
+      "handle": "IRT-APNICRANDNET-AU",
+      "roles": ["abuse"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "IRT-APNICRANDNET-AU"], ["kind", {}, "text", "group"]]]
+    },
+    {
+      "objectClassName": "entity",
+      "handle": "AR302-AP",
+      "roles": ["administrative", "technical"],
+      "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "APNIC RESEARCH"], ["kind", {}, "text", "group"]]]
+    }
+  ],
+  "cidr0_cidrs": [{"v4prefix": "1.1.1.0", "length": 24}]
+}`
+)
+
+func TestRDAPLookupOwner(t *testing.T) {
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("GET /ipv4.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"services": [
+			[["8.0.0.0/8"], ["%[1]s/arin"]],
+			[["193.0.0.0/8"], ["%[1]s/ripe/"]],
+			[["1.0.0.0/8"], ["%[1]s/apnic/"]]
+		]}`, srv.URL)
+	})
+	for path, body := range map[string]string{
+		"/arin/ip/8.8.8.8":     arinNetwork,
+		"/ripe/ip/193.0.6.139": ripeNetwork,
+		"/apnic/ip/1.1.1.1":    apnicNetwork,
+	} {
+		mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/rdap+json")
+			w.Write([]byte(body))
+		})
+	}
+
+	p := &RDAPProvider{BootstrapURLs: []string{srv.URL + "/ipv4.json"}}
+	tests := []struct {
+		ip   string
+		want IPOwnerInfo
+	}{
+		{"8.8.8.8", IPOwnerInfo{IP: "8.8.8.8", ASN: 15169, Org: "Google LLC", CIDR: "8.8.8.0/24"}},
+		{"::ffff:193.0.6.139", IPOwnerInfo{IP: "193.0.6.139", Org: "Reseaux IP Europeens Network Coordination Centre (RIPE NCC)", CIDR: "193.0.0.0/21", Country: "NL"}},
+		{"1.1.1.1", IPOwnerInfo{IP: "1.1.1.1", Org: "APNIC RESEARCH", CIDR: "1.1.1.0/24", Country: "AU"}},
+	}
+	for _, tt := range tests {
+		got, err := p.LookupOwner(context.Background(), netip.MustParseAddr(tt.ip))
+		if err != nil || got != tt.want {
+			t.Errorf("LookupOwner(%s) = %+v, %v; want %+v", tt.ip, got, err, tt.want)
+		}
+	}
+
+	if _, err := p.LookupOwner(context.Background(), netip.MustParseAddr("8.8.4.4")); !errors.Is(err, ErrOwnerNotFound) {
+		t.Errorf("LookupOwner of an unknown network: err = %v, want ErrOwnerNotFound", err)
+	}
+}
+
+func TestRDAPOrgName(t *testing.T) {
+	tests := []struct {
+		name     string
+		entities []rdapEntity
+		want     string
+	}{
+		{"none", nil, ""},
+		{"registrant over others", []rdapEntity{
+			{Roles: []string{"administrative"}, VCardArray: []byte(`["vcard",[["fn",{},"text","Admin"]]]`)},
+			{Roles: []string{"registrant"}, VCardArray: []byte(`["vcard",[["fn",{},"text"," Owner Inc "]]]`)},
+		}, "Owner Inc"},
+		{"any named entity", []rdapEntity{
+			{Roles: []string{"registrant"}},
+			{Roles: []string{"abuse"}, VCardArray: []byte(`["vcard",[["version",{},"text","4.0"],["fn",{},"text","Abuse Desk"]]]`)},
+		}, "Abuse Desk"},
+		{"malformed cards", []rdapEntity{
+			{Roles: []string{"registrant"}, VCardArray: []byte(`"vcard"`)},
+			{Roles: []string{"registrant"}, VCardArray: []byte(`["vcard",[["fn",{},"text"]]]`)},
+			{Roles: []string{"registrant"}, VCardArray: []byte(`["vcard",[["fn",{},"text",["not","a","string"]]]]`)},
+		}, ""},
+	}
+	for _, tt := range tests {
+		if got := rdapOrgName(tt.entities); got != tt.want {
+			t.Errorf("%s: rdapOrgName = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRDAPBootstrapBackoff(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	p := &RDAPProvider{
+		BootstrapURLs: []string{srv.URL},
+		Retry:         RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond},
+	}
+	ip := netip.MustParseAddr("192.0.2.1")
+	for i := 0; i < 3; i++ {
+		if got := p.baseURLFor(context.Background(), ip); got != rdapFallbackBaseURL {
+			t.Errorf("baseURLFor = %q, want the rdap.org fallback", got)
+		}
+	}
+	// One fetch, retried once; later lookups wait out the backoff.
+	if n := hits.Load(); n != 2 {
+		t.Errorf("bootstrap requested %d times, want 2", n)
+	}
+}
@@ -0,0 +1,496 @@
+// Related-domain discovery: pivoting from one apex to an organization's
+// other registrable domains.
+
+package subdomain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/netip"
+	neturl "net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of evidence linking a candidate to the pivot domain.
+const (
+	EvidenceCertOrg    = "cert-org"
+	EvidenceCertSAN    = "cert-san"
+	EvidenceSeed       = "seed"
+	EvidenceNameserver = "shared-ns"
+	EvidenceMX         = "shared-mx"
+	EvidenceIP         = "shared-ip"
+	EvidenceASN        = "shared-asn"
+	EvidenceWhoisOrg   = "whois-org"
+	EvidenceWhoisEmail = "whois-email"
+)
+
+const (
+	defaultMaxPivotCandidates = 100
+	pivotWorkers              = 10
+	// maxSharedCertApexes marks certificates that list this many other
+	// apexes as shared hosting certificates, which say nothing about
+	// ownership.
+	maxSharedCertApexes = 20
+	// maxOrgApexes skips organization names whose certificates cover
+	// more apexes than this; such names are shared by registrars,
+	// resellers and large hosts rather than one owner.
+	maxOrgApexes = 50
+)
+
+// Evidence is one reason to believe a candidate belongs to the same
+// organization.
+type Evidence struct {
+	Kind   string  `json:"kind"`
+	Detail string  `json:"detail"`
+	Weight float64 `json:"weight"`
+}
+
+// RelatedCandidate is a registrable domain that may belong to the same
+// organization, with the evidence for it.
+type RelatedCandidate struct {
+	Domain     string     `json:"domain"`
+	Confidence float64    `json:"confidence"`
+	Evidence   []Evidence `json:"evidence"`
+}
+
+// RelatedResult lists candidates sorted by confidence.
+type RelatedResult struct {
+	Domain string `json:"domain"`
+	// Organizations are the subject organizations on the domain's live
+	// certificates, which were searched in CT.
+	Organizations []string           `json:"organizations,omitempty"`
+	Candidates    []RelatedCandidate `json:"candidates"`
+	Sources       []SourceStatus     `json:"sources"`
+}
+
+// PivotOptions adjusts FindRelated.
+type PivotOptions struct {
+	// Seeds are apexes already suspected, such as the related domains of
+	// an earlier scan.
+	Seeds []string
+	// MaxCandidates caps how many candidates are checked for shared
+	// infrastructure; the rest keep their CT and WHOIS evidence only.
+	MaxCandidates int
+	// Override allows the TLS handshakes for an unverified domain.
+	Override *AuthOverride
+}
+
+// pivot collects evidence per candidate apex.
+type pivot struct {
+	apex       string
+	mu         sync.Mutex
+	candidates map[string]map[string]Evidence
+}
+
+// add records evidence for candidate, keeping the strongest item of each
+// kind.
+func (p *pivot) add(candidate string, ev Evidence) {
+	if candidate == "" || candidate == p.apex {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	byKind, ok := p.candidates[candidate]
+	if !ok {
+		byKind = make(map[string]Evidence)
+		p.candidates[candidate] = byKind
+	}
+	if current, ok := byKind[ev.Kind]; !ok || ev.Weight > current.Weight {
+		byKind[ev.Kind] = ev
+	}
+}
+
+// FindRelated proposes other registrable domains of the organization
+// behind domain. Candidates come from certificates (shared SANs and the
+// subject organization) and local WHOIS data, and are then checked for
+// shared nameservers, mail servers, addresses and ASNs.
+func (f *Finder) FindRelated(ctx context.Context, domain string, opts PivotOptions) (*RelatedResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	normalized, err := normalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	apex, err := f.psl.EffectiveTLDPlusOne(normalized)
+	if err != nil {
+		return nil, err
+	}
+	p := &pivot{apex: apex, candidates: make(map[string]map[string]Evidence)}
+	result := &RelatedResult{Domain: apex}
+
+	run := func(name string, fn func() (string, error)) {
+		start := time.Now()
+		skipped, err := fn()
+		status := SourceStatus{
+			Source:     name,
+			OK:         err == nil,
+			Skipped:    skipped != "",
+			SkipReason: skipped,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			status.Error = err.Error()
+		}
+		result.Sources = append(result.Sources, status)
+	}
+
+	for _, seed := range opts.Seeds {
+		if candidate := f.apexOf(normalizeName(seed)); candidate != "" {
+			p.add(candidate, Evidence{Kind: EvidenceSeed, Detail: "supplied as a seed", Weight: 0.35})
+		}
+	}
+	run(EvidenceCertSAN, func() (string, error) {
+		return "", f.pivotSharedSANs(ctx, p)
+	})
+	run(EvidenceCertOrg, func() (string, error) {
+		if ok, reason := f.activeAllowed(apex, opts.Override); !ok {
+			return reason, nil
+		}
+		orgs, err := f.pivotCertOrgs(ctx, p)
+		result.Organizations = orgs
+		return "", err
+	})
+	run("whois", func() (string, error) {
+		if f.whois == nil {
+			return "no WHOIS data loaded", nil
+		}
+		f.pivotWhois(p)
+		return "", nil
+	})
+	if ctx.Err() == nil {
+		run("infrastructure", func() (string, error) {
+			return "", f.pivotInfrastructure(ctx, p, opts.MaxCandidates)
+		})
+	}
+
+	result.Candidates = p.ranked()
+	return result, nil
+}
+
+// ranked scores every candidate as 1-Π(1-w) over its evidence and sorts
+// them, strongest first.
+func (p *pivot) ranked() []RelatedCandidate {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]RelatedCandidate, 0, len(p.candidates))
+	for domain, byKind := range p.candidates {
+		candidate := RelatedCandidate{Domain: domain}
+		miss := 1.0
+		for _, ev := range byKind {
+			candidate.Evidence = append(candidate.Evidence, ev)
+			miss *= 1 - ev.Weight
+		}
+		sort.Slice(candidate.Evidence, func(i, j int) bool {
+			a, b := candidate.Evidence[i], candidate.Evidence[j]
+			if a.Weight != b.Weight {
+				return a.Weight > b.Weight
+			}
+			return a.Kind < b.Kind
+		})
+		candidate.Confidence = math.Round((1-miss)*100) / 100
+		out = append(out, candidate)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Confidence != out[j].Confidence {
+			return out[i].Confidence > out[j].Confidence
+		}
+		return out[i].Domain < out[j].Domain
+	})
+	return out
+}
+
+// pivotSharedSANs adds apexes that appear on the same CT certificates as
+// names under the pivot apex.
+func (f *Finder) pivotSharedSANs(ctx context.Context, p *pivot) error {
+	shared := make(map[string]int)
+	url := fmt.Sprintf("%s/?q=%s&output=json", f.sourceBaseURL(SourceCrtSh), neturl.QueryEscape("%."+p.apex))
+	_, err := streamJSONArray(ctx, f, SourceCrtSh, url, func(entry crtShEntry) {
+		apexes := f.certApexes(entry.NameValue)
+		if len(apexes) > maxSharedCertApexes {
+			return
+		}
+		for apex := range apexes {
+			if apex != p.apex {
+				shared[apex]++
+			}
+		}
+	})
+	for apex, certs := range shared {
+		weight := math.Min(0.3+0.05*float64(certs-1), 0.5)
+		p.add(apex, Evidence{
+			Kind:   EvidenceCertSAN,
+			Detail: fmt.Sprintf("listed with %s on %d certificate(s)", p.apex, certs),
+			Weight: weight,
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("crt.sh request failed: %w", err)
+	}
+	return nil
+}
+
+// certApexes returns the registrable domains of the names on a crt.sh
+// entry.
+func (f *Finder) certApexes(nameValue string) map[string]struct{} {
+	apexes := make(map[string]struct{})
+	for _, name := range strings.Split(nameValue, "\n") {
+		if apex := f.apexOf(normalizeName(name)); apex != "" {
+			apexes[apex] = struct{}{}
+		}
+	}
+	return apexes
+}
+
+// pivotCertOrgs reads the subject organization from the live certificates
+// of the apex and its www host, then searches CT for other certificates
+// issued to that organization.
+func (f *Finder) pivotCertOrgs(ctx context.Context, p *pivot) ([]string, error) {
+	orgSet := make(map[string]struct{})
+	for _, host := range []string{p.apex, "www." + p.apex} {
+		if ok, _ := f.scope.CheckHost(host); !ok {
+			continue
+		}
+		ips, err := f.resolveIPs(ctx, host)
+		if err != nil || len(ips) == 0 {
+			continue
+		}
+		if ok, _ := f.scope.CheckAddr(ips[0]); !ok {
+			continue
+		}
+		cert, err := f.fetchLeafCertificate(ctx, ips[0], host)
+		if err != nil || cert == nil {
+			continue
+		}
+		for _, org := range cert.Subject.Organization {
+			if org = strings.TrimSpace(org); org != "" {
+				orgSet[org] = struct{}{}
+			}
+		}
+	}
+	orgs := make([]string, 0, len(orgSet))
+	for org := range orgSet {
+		orgs = append(orgs, org)
+	}
+	sort.Strings(orgs)
+
+	var errs []string
+	for _, org := range orgs {
+		if err := f.searchCertOrg(ctx, p, org); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return orgs, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return orgs, nil
+}
+
+// searchCertOrg adds the apexes on CT certificates issued to org. An
+// organization seen on more than maxOrgApexes apexes adds nothing.
+func (f *Finder) searchCertOrg(ctx context.Context, p *pivot, org string) error {
+	apexes := make(map[string]struct{})
+	url := fmt.Sprintf("%s/?O=%s&output=json", f.sourceBaseURL(SourceCrtSh), neturl.QueryEscape(org))
+	_, err := streamJSONArray(ctx, f, SourceCrtSh, url, func(entry crtShEntry) {
+		for apex := range f.certApexes(entry.NameValue) {
+			apexes[apex] = struct{}{}
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("crt.sh organization search for %q failed: %v", org, err)
+	}
+	if len(apexes) > maxOrgApexes {
+		if f.debug {
+			log.Printf("[DEBUG] Skipping organization %q: certificates cover %d apexes", org, len(apexes))
+		}
+		return nil
+	}
+	for apex := range apexes {
+		p.add(apex, Evidence{Kind: EvidenceCertOrg, Detail: "certificate issued to " + org, Weight: 0.4})
+	}
+	return nil
+}
+
+// pivotWhois adds domains sharing the apex's registrant organization or
+// email in the local WHOIS data.
+func (f *Finder) pivotWhois(p *pivot) {
+	record, ok := f.whois.Lookup(p.apex)
+	if !ok {
+		return
+	}
+	for _, domain := range f.whois.SameOrganization(p.apex) {
+		p.add(domain, Evidence{Kind: EvidenceWhoisOrg, Detail: "registered to " + record.Organization, Weight: 0.5})
+	}
+	for _, domain := range f.whois.SameEmail(p.apex) {
+		p.add(domain, Evidence{Kind: EvidenceWhoisEmail, Detail: "registrant email " + record.Email, Weight: 0.7})
+	}
+}
+
+// infraProfile is the delegation, mail and hosting footprint of an apex.
+type infraProfile struct {
+	ns   []string
+	mx   []string
+	ips  []string
+	asns map[uint32]string
+}
+
+// pivotInfrastructure compares the strongest candidates' nameservers, mail
+// servers, addresses and ASNs with the pivot apex's.
+func (f *Finder) pivotInfrastructure(ctx context.Context, p *pivot, limit int) error {
+	if limit <= 0 {
+		limit = defaultMaxPivotCandidates
+	}
+	origin := f.infraProfile(ctx, p.apex)
+	if len(origin.ns) == 0 && len(origin.mx) == 0 && len(origin.ips) == 0 {
+		return fmt.Errorf("no NS, MX or address records for %s", p.apex)
+	}
+
+	var candidates []string
+	for _, candidate := range p.ranked() {
+		if ok, _ := f.scope.CheckHost(candidate.Domain); ok {
+			candidates = append(candidates, candidate.Domain)
+		}
+		if len(candidates) == limit {
+			break
+		}
+	}
+
+	sem := make(chan struct{}, pivotWorkers)
+	var wg sync.WaitGroup
+	for _, candidate := range candidates {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(candidate string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			profile := f.infraProfile(ctx, candidate)
+			for _, ev := range f.compareInfra(p.apex, candidate, origin, profile) {
+				p.add(candidate, ev)
+			}
+		}(candidate)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (f *Finder) infraProfile(ctx context.Context, apex string) infraProfile {
+	var profile infraProfile
+	if records, err := f.resolver.LookupNS(ctx, apex); err == nil {
+		for _, ns := range records {
+			profile.ns = append(profile.ns, normalizeName(ns.Host))
+		}
+	}
+	if records, err := f.resolver.LookupMX(ctx, apex); err == nil {
+		for _, mx := range records {
+			if host := normalizeName(mx.Host); host != "" {
+				profile.mx = append(profile.mx, host)
+			}
+		}
+	}
+	for _, host := range []string{apex, "www." + apex} {
+		if ips, err := f.resolveIPs(ctx, host); err == nil {
+			profile.ips = append(profile.ips, ips...)
+		}
+	}
+	profile.ns = uniqueStrings(profile.ns)
+	profile.mx = uniqueStrings(profile.mx)
+	profile.ips = uniqueStrings(profile.ips)
+	if f.lookupIPOwners {
+		profile.asns = make(map[uint32]string)
+		for _, ip := range profile.ips {
+			if owner, err := f.getIPOwner(ctx, ip); err == nil && owner.ASN != 0 {
+				profile.asns[owner.ASN] = owner.String()
+			}
+		}
+	}
+	return profile
+}
+
+// compareInfra turns overlaps between two profiles into evidence. Hosts
+// run by well-known providers or CDNs are shared by unrelated customers
+// and weigh little.
+func (f *Finder) compareInfra(apex, candidate string, origin, other infraProfile) []Evidence {
+	var out []Evidence
+	vanity := func(host string) bool {
+		return isSubdomainOf(host, apex) || isSubdomainOf(host, candidate)
+	}
+
+	if shared := intersectStrings(origin.ns, other.ns); len(shared) > 0 {
+		ev := Evidence{Kind: EvidenceNameserver, Detail: "shares nameserver " + shared[0], Weight: 0.1}
+		switch {
+		case vanity(shared[0]):
+			ev.Weight = 0.6
+		case len(shared) == len(origin.ns) && len(shared) == len(other.ns):
+			// Providers such as Cloudflare hand each account its own
+			// pair, so an identical set is a fair hint.
+			ev.Detail = "uses the same nameserver set " + strings.Join(shared, ", ")
+			ev.Weight = 0.3
+		}
+		out = append(out, ev)
+	}
+
+	for _, host := range intersectStrings(origin.mx, other.mx) {
+		if matchServiceHost(RecordMX, host) != "" {
+			continue
+		}
+		weight := 0.15
+		if vanity(host) {
+			weight = 0.5
+		}
+		out = append(out, Evidence{Kind: EvidenceMX, Detail: "shares mail server " + host, Weight: weight})
+		break
+	}
+
+	if shared := intersectStrings(origin.ips, other.ips); len(shared) > 0 {
+		ev := Evidence{Kind: EvidenceIP, Detail: "shares address " + shared[0], Weight: 0.4}
+		if f.sharedHosting(shared[0]) {
+			ev.Detail += " on a cloud or CDN range"
+			ev.Weight = 0.1
+		}
+		out = append(out, ev)
+	} else {
+		for asn, owner := range origin.asns {
+			if _, ok := other.asns[asn]; ok {
+				out = append(out, Evidence{Kind: EvidenceASN, Detail: "hosted in " + owner, Weight: 0.1})
+				break
+			}
+		}
+	}
+	if f.debug && len(out) > 0 {
+		log.Printf("[DEBUG] Pivot %s -> %s: %d infrastructure matches", apex, candidate, len(out))
+	}
+	return out
+}
+
+// sharedHosting reports whether ip belongs to a known cloud or CDN range.
+func (f *Finder) sharedHosting(ip string) bool {
+	if f.cloudClassifier == nil {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	_, ok := f.cloudClassifier.Classify(addr, nil)
+	return ok
+}
+
+func intersectStrings(a, b []string) []string {
+	set := make(map[string]struct{}, len(b))
+	for _, v := range b {
+		set[v] = struct{}{}
+	}
+	var out []string
+	for _, v := range a {
+		if _, ok := set[v]; ok {
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
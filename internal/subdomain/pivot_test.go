@@ -0,0 +1,137 @@
+package subdomain
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// crtShStandIn serves crt.sh searches: identity queries from byQuery and
+// organization queries from byOrg, each entry being a certificate's names.
+func crtShStandIn(t *testing.T, byQuery, byOrg map[string][][]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		certs := byQuery[r.URL.Query().Get("q")]
+		if org := r.URL.Query().Get("O"); org != "" {
+			certs = byOrg[org]
+		}
+		entries := make([]string, 0, len(certs))
+		for _, names := range certs {
+			entries = append(entries, fmt.Sprintf(`{"name_value":%q}`, strings.Join(names, "\n")))
+		}
+		fmt.Fprintf(w, "[%s]", strings.Join(entries, ","))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSearchCertOrg(t *testing.T) {
+	var hosting []string
+	for i := 0; i <= maxOrgApexes; i++ {
+		hosting = append(hosting, fmt.Sprintf("customer%d.com", i))
+	}
+	srv := crtShStandIn(t, nil, map[string][][]string{
+		"Example Corp": {{"www.example.com", "example.net"}, {"shop.example.org"}},
+		"Big Host":     {hosting[:20], hosting[20:]},
+	})
+	f := NewFinder(WithSourceBaseURL(SourceCrtSh, srv.URL))
+
+	tests := []struct {
+		org  string
+		want []string
+	}{
+		{"Example Corp", []string{"example.net", "example.org"}},
+		{"Big Host", []string{}},
+		{"Nobody", []string{}},
+	}
+	for _, tt := range tests {
+		p := &pivot{apex: "example.com", candidates: make(map[string]map[string]Evidence)}
+		if err := f.searchCertOrg(context.Background(), p, tt.org); err != nil {
+			t.Fatalf("searchCertOrg(%q): %v", tt.org, err)
+		}
+		got := []string{}
+		for _, candidate := range p.ranked() {
+			got = append(got, candidate.Domain)
+			if ev := candidate.Evidence[0]; ev.Kind != EvidenceCertOrg || ev.Weight >= 0.5 {
+				t.Errorf("%s: evidence %+v, want cert-org weighing under 0.5", candidate.Domain, ev)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("searchCertOrg(%q) candidates = %v, want %v", tt.org, got, tt.want)
+		}
+	}
+}
+
+func TestFindRelated(t *testing.T) {
+	var shared []string
+	for i := 0; i <= maxSharedCertApexes; i++ {
+		shared = append(shared, fmt.Sprintf("tenant%d.com", i))
+	}
+	srv := crtShStandIn(t, map[string][][]string{
+		"%.example.com": {
+			{"www.example.com", "www.example.net"},
+			{"api.example.com", "api.example.net"},
+			// A hosting certificate says nothing about ownership.
+			append([]string{"cdn.example.com"}, shared...),
+		},
+	}, nil)
+	zone := &dnsZone{a: map[string][]string{
+		"example.com": {"192.0.2.10"},
+		"example.net": {"192.0.2.10"},
+	}}
+	dir := t.TempDir()
+	registry, err := NewAuthRegistry(filepath.Join(dir, "auth.json"), filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFinder(
+		WithSourceBaseURL(SourceCrtSh, srv.URL),
+		WithResolver(dnsStandIn(t, zone)),
+		WithIPOwnerLookup(false),
+		WithAuthorization(registry),
+	)
+
+	result, err := f.FindRelated(context.Background(), "www.example.com", PivotOptions{Seeds: []string{"shop.example.org"}})
+	if err != nil {
+		t.Fatalf("FindRelated: %v", err)
+	}
+	if result.Domain != "example.com" {
+		t.Errorf("Domain = %q, want example.com", result.Domain)
+	}
+
+	got := make(map[string][]string)
+	for _, candidate := range result.Candidates {
+		for _, ev := range candidate.Evidence {
+			got[candidate.Domain] = append(got[candidate.Domain], ev.Kind)
+		}
+	}
+	want := map[string][]string{
+		"example.net": {EvidenceIP, EvidenceCertSAN},
+		"example.org": {EvidenceSeed},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("evidence = %v, want %v", got, want)
+	}
+	if result.Candidates[0].Domain != "example.net" || result.Candidates[0].Confidence != 0.61 {
+		t.Errorf("top candidate = %+v, want example.net at 0.61", result.Candidates[0])
+	}
+
+	statuses := make(map[string]SourceStatus)
+	for _, s := range result.Sources {
+		statuses[s.Source] = s
+	}
+	if s := statuses[EvidenceCertOrg]; !s.Skipped {
+		t.Errorf("cert-org status = %+v, want skipped for an unverified domain", s)
+	}
+	if s := statuses["whois"]; !s.Skipped {
+		t.Errorf("whois status = %+v, want skipped without data", s)
+	}
+	if s := statuses["infrastructure"]; !s.OK {
+		t.Errorf("infrastructure status = %+v, want OK", s)
+	}
+}
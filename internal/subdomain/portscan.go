@@ -0,0 +1,237 @@
+// TCP connect scanning of resolved IPs.
+
+package subdomain
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	defaultPortScanTimeout     = 2 * time.Second
+	defaultPortScanConcurrency = 100
+	defaultPortScanRate        = 500
+	bannerReadTimeout          = 2 * time.Second
+	maxBannerSize              = 256
+)
+
+// TopPorts is the default list of TCP ports checked by the port scanner.
+var TopPorts = []int{
+	7, 9, 13, 21, 22, 23, 25, 26, 37, 53, 79, 80, 81, 88, 106, 110, 111, 113,
+	119, 135, 139, 143, 144, 179, 199, 389, 427, 443, 444, 445, 465, 513, 514,
+	515, 543, 544, 548, 554, 587, 631, 646, 873, 990, 993, 995, 1025, 1026,
+	1027, 1028, 1029, 1110, 1433, 1720, 1723, 1755, 1900, 2000, 2001, 2049,
+	2121, 2717, 3000, 3128, 3306, 3389, 3986, 4899, 5000, 5009, 5051, 5060,
+	5101, 5190, 5357, 5432, 5631, 5666, 5800, 5900, 6000, 6001, 6646, 7070,
+	8000, 8008, 8009, 8080, 8081, 8443, 8888, 9100, 9999, 10000, 32768, 49152,
+	49153, 49154, 49155, 49156, 49157,
+}
+
+// OpenPort describes a TCP port that accepted a connection.
+type OpenPort struct {
+	Port   int    `json:"port"`
+	Banner string `json:"banner,omitempty"`
+}
+
+// WithPortScan enables TCP connect scanning of every resolved IP.
+func WithPortScan(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.scanPorts = enabled
+	}
+}
+
+// WithScanPorts overrides the list of ports checked by the port scanner.
+func WithScanPorts(ports []int) FinderOption {
+	return func(f *Finder) {
+		valid := make([]int, 0, len(ports))
+		seen := make(map[int]bool, len(ports))
+		for _, port := range ports {
+			if port > 0 && port <= 65535 && !seen[port] {
+				seen[port] = true
+				valid = append(valid, port)
+			}
+		}
+		if len(valid) > 0 {
+			f.portList = valid
+		}
+	}
+}
+
+// WithPortScanConcurrency caps the number of simultaneous connection attempts.
+func WithPortScanConcurrency(n int) FinderOption {
+	return func(f *Finder) {
+		if n > 0 {
+			f.portScanConcurrency = n
+		}
+	}
+}
+
+// WithPortScanRate caps the number of connection attempts per second.
+func WithPortScanRate(perSecond int) FinderOption {
+	return func(f *Finder) {
+		if perSecond > 0 {
+			f.portScanRate = perSecond
+		}
+	}
+}
+
+// WithPortScanTimeout sets the connect timeout used for each host and port.
+func WithPortScanTimeout(timeout time.Duration) FinderOption {
+	return func(f *Finder) {
+		if timeout > 0 {
+			f.portScanTimeout = timeout
+		}
+	}
+}
+
+// ParsePorts parses a comma separated list of ports and ranges such as
+// "22,80,8000-8100". The result is sorted and lists each port once.
+func ParsePorts(spec string) ([]int, error) {
+	var ports []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lo, hi, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(hi); err != nil {
+				return nil, err
+			}
+		}
+		if start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("invalid port range: %q", part)
+		}
+		for port := start; port <= end; port++ {
+			if !seen[port] {
+				seen[port] = true
+				ports = append(ports, port)
+			}
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// scanOpenPorts connect-scans the unique IPs in results and attaches the
+// open ports to every subdomain resolving to each IP.
+func (f *Finder) scanOpenPorts(ctx context.Context, results map[string]Subdomain) {
+	var ips []string
+	for _, data := range results {
+		ips = append(ips, data.Addresses()...)
+	}
+	ips = uniqueStrings(ips)
+	if len(ips) == 0 {
+		return
+	}
+
+	open := f.portScan(ctx, ips, f.portList)
+
+	for _, data := range results {
+		for i := range data.IPs {
+			data.IPs[i].Ports = open[data.IPs[i].Address]
+		}
+	}
+}
+
+// portScan checks every port on every IP and returns the open ports keyed
+// by IP, sorted by port number.
+func (f *Finder) portScan(ctx context.Context, ips []string, ports []int) map[string][]OpenPort {
+	interval := time.Second / time.Duration(f.portScanRate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, f.portScanConcurrency)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		open = make(map[string][]OpenPort)
+	)
+
+scan:
+	for _, ip := range ips {
+		for _, port := range ports {
+			select {
+			case <-ctx.Done():
+				break scan
+			case <-ticker.C:
+			}
+			sem <- struct{}{}
+			wg.Add(1)
+			go func(ip string, port int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if !f.acquireWorker(ctx) {
+					return
+				}
+				defer f.releaseWorker()
+				result, ok := f.probePort(ctx, ip, port)
+				if !ok {
+					return
+				}
+				if f.debug {
+					log.Printf("[DEBUG] Open port %s:%d", ip, port)
+				}
+				mu.Lock()
+				open[ip] = append(open[ip], result)
+				mu.Unlock()
+			}(ip, port)
+		}
+	}
+	wg.Wait()
+
+	for ip := range open {
+		sort.Slice(open[ip], func(i, j int) bool {
+			return open[ip][i].Port < open[ip][j].Port
+		})
+	}
+	return open
+}
+
+func (f *Finder) probePort(ctx context.Context, ip string, port int) (OpenPort, bool) {
+	dialer := &net.Dialer{Timeout: f.portScanTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return OpenPort{}, false
+	}
+	defer conn.Close()
+
+	result := OpenPort{Port: port}
+	readTimeout := bannerReadTimeout
+	if f.portScanTimeout < readTimeout {
+		readTimeout = f.portScanTimeout
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	buf := make([]byte, maxBannerSize)
+	n, _ := conn.Read(buf)
+	if n > 0 {
+		result.Banner = sanitizeBanner(buf[:n])
+	}
+	return result, true
+}
+
+// sanitizeBanner keeps the first line of a banner with non-printable
+// characters removed.
+func sanitizeBanner(raw []byte) string {
+	line, _, _ := strings.Cut(string(raw), "\n")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsPrint(r) {
+			return r
+		}
+		return -1
+	}, strings.TrimSpace(line))
+}
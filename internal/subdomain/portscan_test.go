@@ -0,0 +1,48 @@
+package subdomain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []int
+		wantErr bool
+	}{
+		{name: "single", spec: "443", want: []int{443}},
+		{name: "list", spec: "22,80,443", want: []int{22, 80, 443}},
+		{name: "range", spec: "8000-8003", want: []int{8000, 8001, 8002, 8003}},
+		{name: "mixed with spaces", spec: " 22 , 8080-8081 ,", want: []int{22, 8080, 8081}},
+		{name: "one-port range", spec: "25-25", want: []int{25}},
+		{name: "bounds", spec: "1,65535", want: []int{1, 65535}},
+		{name: "duplicates", spec: "80,80,1-3,2", want: []int{1, 2, 3, 80}},
+		{name: "unsorted", spec: "443,22,8080-8081,80", want: []int{22, 80, 443, 8080, 8081}},
+		{name: "empty", spec: "", want: nil},
+		{name: "zero", spec: "0", wantErr: true},
+		{name: "too high", spec: "65536", wantErr: true},
+		{name: "reversed range", spec: "90-80", wantErr: true},
+		{name: "open range", spec: "80-", wantErr: true},
+		{name: "not a number", spec: "http", wantErr: true},
+		{name: "negative", spec: "-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePorts(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParsePorts(%q) = %v, want an error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePorts(%q): %v", tt.spec, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePorts(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
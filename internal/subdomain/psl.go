@@ -0,0 +1,236 @@
+// Public Suffix List handling: registrable domains and tenant boundaries.
+
+package subdomain
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// PublicSuffixListURL is where the maintained copy of the list is published.
+const PublicSuffixListURL = "https://publicsuffix.org/list/public_suffix_list.dat"
+
+const (
+	pslBeginPrivate = "===BEGIN PRIVATE DOMAINS==="
+	pslEndPrivate   = "===END PRIVATE DOMAINS==="
+	// minPSLRules guards against replacing the list with an error page or
+	// a truncated download.
+	minPSLRules = 1000
+	maxPSLSize  = 8 << 20
+)
+
+// ErrPublicSuffix is returned when asked to scan a bare public suffix such
+// as co.uk or github.io without forcing it.
+var ErrPublicSuffix = errors.New("domain is a public suffix")
+
+//go:embed data/public_suffix_list.dat
+var embeddedPSL []byte
+
+var (
+	defaultPSLOnce sync.Once
+	defaultPSL     *PublicSuffixList
+)
+
+// PublicSuffixList answers which part of a name is a public suffix. Rules
+// from the private section, where companies such as GitHub or Amazon hand
+// out names to their customers, are tracked separately.
+type PublicSuffixList struct {
+	// rules maps each rule as written ("com", "*.ck", "!www.ck"), in
+	// A-label form, to whether it came from the private section.
+	rules map[string]bool
+}
+
+// DefaultPublicSuffixList returns the list embedded at build time.
+func DefaultPublicSuffixList() *PublicSuffixList {
+	defaultPSLOnce.Do(func() {
+		list, err := ParsePublicSuffixList(bytes.NewReader(embeddedPSL))
+		if err != nil {
+			panic("embedded public suffix list: " + err.Error())
+		}
+		defaultPSL = list
+	})
+	return defaultPSL
+}
+
+// LoadPublicSuffixList reads a list in the publicsuffix.org format.
+func LoadPublicSuffixList(path string) (*PublicSuffixList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParsePublicSuffixList(file)
+}
+
+// ParsePublicSuffixList parses the publicsuffix.org format. Unicode rules
+// are stored in their punycode form to match normalized names.
+func ParsePublicSuffixList(r io.Reader) (*PublicSuffixList, error) {
+	list := &PublicSuffixList{rules: make(map[string]bool)}
+	private := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.Contains(line, pslBeginPrivate):
+			private = true
+			continue
+		case strings.Contains(line, pslEndPrivate):
+			private = false
+			continue
+		case line == "" || strings.HasPrefix(line, "//"):
+			continue
+		}
+		// Rules end at the first whitespace.
+		rule := strings.Fields(line)[0]
+		prefix := ""
+		switch {
+		case strings.HasPrefix(rule, "!"):
+			prefix, rule = "!", rule[1:]
+		case strings.HasPrefix(rule, "*."):
+			prefix, rule = "*.", rule[2:]
+		}
+		ascii, err := toASCII(strings.ToLower(rule))
+		if err != nil {
+			return nil, fmt.Errorf("public suffix rule %q: %w", line, err)
+		}
+		list.rules[prefix+strings.ToLower(ascii)] = private
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(list.rules) < minPSLRules {
+		return nil, fmt.Errorf("public suffix list has only %d rules", len(list.rules))
+	}
+	return list, nil
+}
+
+// Len returns the number of rules in the list.
+func (l *PublicSuffixList) Len() int {
+	return len(l.rules)
+}
+
+// PublicSuffix returns the public suffix of a normalized domain and whether
+// the matching rule is in the private section. Names no rule covers fall
+// back to their last label, as the list's implicit "*" rule requires.
+func (l *PublicSuffixList) PublicSuffix(domain string) (string, bool) {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		candidate := strings.Join(labels[i:], ".")
+		if private, ok := l.rules["!"+candidate]; ok {
+			return strings.Join(labels[i+1:], "."), private
+		}
+		if private, ok := l.rules[candidate]; ok {
+			return candidate, private
+		}
+		if i+1 < len(labels) {
+			if private, ok := l.rules["*."+strings.Join(labels[i+1:], ".")]; ok {
+				return candidate, private
+			}
+		}
+	}
+	return labels[len(labels)-1], false
+}
+
+// IsPublicSuffix reports whether domain is itself a public suffix.
+func (l *PublicSuffixList) IsPublicSuffix(domain string) bool {
+	suffix, _ := l.PublicSuffix(domain)
+	return suffix == domain
+}
+
+// EffectiveTLDPlusOne returns the registrable domain of domain: its public
+// suffix plus one more label. Private rules count, so for
+// "a.b.github.io" it is "b.github.io".
+func (l *PublicSuffixList) EffectiveTLDPlusOne(domain string) (string, error) {
+	suffix, _ := l.PublicSuffix(domain)
+	if suffix == domain {
+		return "", fmt.Errorf("%w: %s", ErrPublicSuffix, domain)
+	}
+	rest := strings.TrimSuffix(domain, "."+suffix)
+	if i := strings.LastIndex(rest, "."); i >= 0 {
+		rest = rest[i+1:]
+	}
+	return rest + "." + suffix, nil
+}
+
+// WithPublicSuffixList replaces the embedded list, for example with one
+// refreshed by FetchPublicSuffixList.
+func WithPublicSuffixList(list *PublicSuffixList) FinderOption {
+	return func(f *Finder) {
+		if list != nil {
+			f.psl = list
+		}
+	}
+}
+
+// FetchPublicSuffixList downloads the list from url and checks that it
+// parses before returning the raw bytes for saving.
+func FetchPublicSuffixList(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", defaultUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPSLSize))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ParsePublicSuffixList(bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// otherTenant reports whether name, which lies under domain, belongs to a
+// different registrable domain. That happens below private-section
+// suffixes: scanning amazonaws.com must not pick up customer buckets under
+// s3.amazonaws.com. It needs both registrable domains; on a forced scan of
+// a suffix the suffix itself, and everything under it, is kept.
+func (f *Finder) otherTenant(name, domain string) bool {
+	nameApex, err := f.psl.EffectiveTLDPlusOne(name)
+	if err != nil {
+		return false
+	}
+	domainApex, err := f.psl.EffectiveTLDPlusOne(domain)
+	if err != nil {
+		return false
+	}
+	return nameApex != domainApex
+}
+
+// dropOtherTenants removes names that belong to other tenants of a
+// multi-tenant suffix under domain.
+func (f *Finder) dropOtherTenants(domain string, results map[string]Subdomain) []Exclusion {
+	var excluded []Exclusion
+	for name := range results {
+		if !f.otherTenant(name, domain) {
+			continue
+		}
+		suffix, _ := f.psl.PublicSuffix(name)
+		excluded = append(excluded, Exclusion{
+			Name:   name,
+			Reason: "belongs to another tenant of public suffix " + suffix,
+		})
+		delete(results, name)
+	}
+	return excluded
+}
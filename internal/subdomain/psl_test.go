@@ -0,0 +1,132 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestPublicSuffix(t *testing.T) {
+	list := DefaultPublicSuffixList()
+	tests := []struct {
+		domain      string
+		wantSuffix  string
+		wantPrivate bool
+		wantETLD1   string
+	}{
+		{"example.com", "com", false, "example.com"},
+		{"www.example.co.uk", "co.uk", false, "example.co.uk"},
+		{"user.github.io", "github.io", true, "user.github.io"},
+		{"a.b.github.io", "github.io", true, "b.github.io"},
+		{"bucket.s3.amazonaws.com", "s3.amazonaws.com", true, "bucket.s3.amazonaws.com"},
+		// Wildcard rule *.ck with the exception !www.ck.
+		{"shop.example.ck", "example.ck", false, "shop.example.ck"},
+		{"www.ck", "ck", false, "www.ck"},
+		{"a.city.kawasaki.jp", "kawasaki.jp", false, "city.kawasaki.jp"},
+		// Unicode rules are matched in punycode.
+		{"xn--e1afmkfd.xn--p1ai", "xn--p1ai", false, "xn--e1afmkfd.xn--p1ai"},
+		// Unlisted TLDs fall back to the implicit "*" rule.
+		{"host.example.invalidtld", "invalidtld", false, "example.invalidtld"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			suffix, private := list.PublicSuffix(tt.domain)
+			if suffix != tt.wantSuffix || private != tt.wantPrivate {
+				t.Errorf("PublicSuffix = %q, %v; want %q, %v", suffix, private, tt.wantSuffix, tt.wantPrivate)
+			}
+			etld1, err := list.EffectiveTLDPlusOne(tt.domain)
+			if err != nil || etld1 != tt.wantETLD1 {
+				t.Errorf("EffectiveTLDPlusOne = %q, %v; want %q", etld1, err, tt.wantETLD1)
+			}
+		})
+	}
+}
+
+func TestIsPublicSuffix(t *testing.T) {
+	list := DefaultPublicSuffixList()
+	tests := []struct {
+		domain string
+		want   bool
+	}{
+		{"com", true},
+		{"co.uk", true},
+		{"github.io", true},
+		{"anything.ck", true},
+		{"www.ck", false},
+		{"example.com", false},
+		{"example.github.io", false},
+	}
+	for _, tt := range tests {
+		if got := list.IsPublicSuffix(tt.domain); got != tt.want {
+			t.Errorf("IsPublicSuffix(%q) = %v, want %v", tt.domain, got, tt.want)
+		}
+		if _, err := list.EffectiveTLDPlusOne(tt.domain); tt.want && !errors.Is(err, ErrPublicSuffix) {
+			t.Errorf("EffectiveTLDPlusOne(%q) err = %v, want ErrPublicSuffix", tt.domain, err)
+		}
+	}
+}
+
+func TestParsePublicSuffixListTooShort(t *testing.T) {
+	if _, err := ParsePublicSuffixList(strings.NewReader("<html>not a list</html>\ncom\n")); err == nil {
+		t.Error("a list with too few rules was accepted")
+	}
+}
+
+func TestOtherTenant(t *testing.T) {
+	f := NewFinder()
+	tests := []struct {
+		name, domain string
+		want         bool
+	}{
+		{"www.example.com", "example.com", false},
+		{"a.b.example.co.uk", "example.co.uk", false},
+		{"bucket.s3.amazonaws.com", "amazonaws.com", true},
+		{"user.github.io", "github.io", false},
+		{"deep.user.github.io", "user.github.io", false},
+		// Forced scans of a suffix keep the suffix itself.
+		{"github.io", "github.io", false},
+		{"s3.amazonaws.com", "amazonaws.com", false},
+	}
+	for _, tt := range tests {
+		if got := f.otherTenant(tt.name, tt.domain); got != tt.want {
+			t.Errorf("otherTenant(%q, %q) = %v, want %v", tt.name, tt.domain, got, tt.want)
+		}
+	}
+}
+
+func TestScanForcedSuffix(t *testing.T) {
+	srv := crtShStandIn(t, map[string][][]string{
+		"%.github.io": {{"github.io", "www.github.io"}, {"user.github.io"}},
+	}, nil)
+	zone := &dnsZone{a: map[string][]string{
+		"github.io":      {"192.0.2.1"},
+		"www.github.io":  {"192.0.2.1"},
+		"user.github.io": {"192.0.2.2"},
+	}}
+	f := NewFinder(
+		WithSourceBaseURL(SourceCrtSh, srv.URL),
+		WithSourceBaseURL(SourceCertSpotter, srv.URL),
+		WithResolver(dnsStandIn(t, zone)),
+		WithIPOwnerLookup(false),
+	)
+
+	if _, err := f.Scan(context.Background(), "github.io"); !errors.Is(err, ErrPublicSuffix) {
+		t.Fatalf("Scan of a suffix: err = %v, want ErrPublicSuffix", err)
+	}
+	result, err := f.ScanWith(context.Background(), "github.io", ScanOptions{AllowPublicSuffix: true})
+	if err != nil {
+		t.Fatalf("forced ScanWith: %v", err)
+	}
+	var names []string
+	for name := range result.Subdomains {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"github.io", "user.github.io", "www.github.io"}
+	if !reflect.DeepEqual(names, want) || len(result.Excluded) != 0 {
+		t.Errorf("forced scan kept %v and excluded %v, want %v and nothing excluded", names, result.Excluded, want)
+	}
+}
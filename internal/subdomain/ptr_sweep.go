@@ -0,0 +1,220 @@
+// Reverse DNS sweeps of the networks around resolved addresses.
+
+package subdomain
+
+import (
+	"context"
+	"log"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// SourcePTRSweep marks names found by sweeping PTR records next to a
+// resolved address.
+const SourcePTRSweep = "ptr-sweep"
+
+const (
+	defaultPTRSweepBits = 24
+	// maxPTRSweepAddresses caps one scan's sweep across all networks,
+	// sixteen /24s worth.
+	maxPTRSweepAddresses = 4096
+)
+
+// PTRRecord is a reverse DNS name seen on an address.
+type PTRRecord struct {
+	Address string `json:"address"`
+	Name    string `json:"name"`
+	// Forward is what Name resolves to.
+	Forward []string `json:"forward,omitempty"`
+}
+
+// WithPTRSweep enables PTR lookups across the network around every
+// resolved IPv4 address. The sweep is an active step, so it needs the same
+// authorization as TLS inspection. Lookups share the WithPTRRate limit.
+func WithPTRSweep(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.ptrSweep = enabled
+	}
+}
+
+// WithPTRSweepPrefix sets the size of the swept network, from /22 to /32.
+// The default is /24.
+func WithPTRSweepPrefix(bits int) FinderOption {
+	return func(f *Finder) {
+		if bits >= 22 && bits <= 32 {
+			f.ptrSweepBits = bits
+		}
+	}
+}
+
+// ptrInfo is what the sweep learned about one resolved address.
+type ptrInfo struct {
+	names     []string
+	checked   bool
+	confirmed bool
+}
+
+// sweepNeighbours looks up PTR records around the addresses in results.
+// Addresses in cloud or CDN ranges are skipped, since their neighbours
+// belong to other customers. In-scope names under domain that resolve back
+// to the address they were found on are added; those that do not are
+// returned as mismatches. Every resolved address is annotated with its own
+// PTR names, and marked when none of them resolves back to it. capped
+// reports that the networks held more than maxPTRSweepAddresses addresses.
+func (f *Finder) sweepNeighbours(ctx context.Context, domain string, results map[string]Subdomain) (mismatches []PTRRecord, exclusions []Exclusion, capped bool) {
+	var prefixes []netip.Prefix
+	seenPrefix := make(map[netip.Prefix]bool)
+	for _, data := range results {
+		for _, ip := range data.Addresses() {
+			addr, err := netip.ParseAddr(ip)
+			if err != nil || !addr.Unmap().Is4() {
+				continue
+			}
+			if f.sharedHosting(ip) {
+				if f.debug {
+					log.Printf("[DEBUG] PTR sweep skipping %s: shared hosting", ip)
+				}
+				continue
+			}
+			prefix, _ := addr.Unmap().Prefix(f.ptrSweepBits)
+			if !seenPrefix[prefix] {
+				seenPrefix[prefix] = true
+				prefixes = append(prefixes, prefix)
+			}
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].Addr().Less(prefixes[j].Addr())
+	})
+
+	addrs, capped := f.sweepTargets(prefixes, maxPTRSweepAddresses)
+	if f.debug {
+		if capped {
+			log.Printf("[DEBUG] PTR sweep for %s capped at %d addresses", domain, maxPTRSweepAddresses)
+		}
+		log.Printf("[DEBUG] PTR sweep for %s: %d addresses in %d networks", domain, len(addrs), len(prefixes))
+	}
+
+	ownerCache := make(map[string]IPOwnerInfo)
+	forward := make(map[string][]string)
+	infos := make(map[string]*ptrInfo)
+	excluded := make(map[string]string)
+	resolveForward := func(name string) []string {
+		ips, ok := forward[name]
+		if !ok {
+			ips, _ = f.resolveIPs(ctx, name)
+			forward[name] = ips
+		}
+		return ips
+	}
+
+	for _, hit := range f.sweepAddrs(ctx, addrs, false) {
+		info := &ptrInfo{}
+		infos[hit.addr] = info
+		for _, raw := range hit.names {
+			name := normalizeName(raw)
+			if name == "" {
+				continue
+			}
+			info.names = append(info.names, name)
+			if !isSubdomainOf(name, domain) || f.otherTenant(name, domain) {
+				continue
+			}
+			if _, ok := excluded[name]; ok {
+				continue
+			}
+			if ok, reason := f.scope.CheckHost(name); !ok {
+				if _, known := results[name]; !known {
+					excluded[name] = reason
+				}
+				continue
+			}
+
+			ips := resolveForward(name)
+			info.checked = true
+			if !containsString(ips, hit.addr) {
+				mismatches = append(mismatches, PTRRecord{Address: hit.addr, Name: name, Forward: ips})
+				continue
+			}
+			info.confirmed = true
+
+			seen := time.Now().UTC()
+			if _, ok := results[name]; ok {
+				addSubdomain(results, name, SourcePTRSweep, seen, nil)
+				continue
+			}
+			data := Subdomain{Name: name}
+			data.observe(SourcePTRSweep, seen)
+			data, ok := f.enrichSubdomain(ctx, data, ownerCache)
+			if !ok {
+				continue
+			}
+			if ok, reason := f.addrsInScope(data); !ok {
+				excluded[name] = reason
+				continue
+			}
+			if f.debug {
+				log.Printf("[DEBUG] PTR sweep discovered %s on %s", name, hit.addr)
+			}
+			results[name] = data
+		}
+	}
+
+	for name, data := range results {
+		for i := range data.IPs {
+			info, ok := infos[data.IPs[i].Address]
+			if !ok {
+				continue
+			}
+			if !info.checked {
+				// PTR names outside domain, such as a hosting provider's,
+				// are only checked for the addresses the scan resolved.
+				for _, ptr := range info.names {
+					if _, skip := excluded[ptr]; skip {
+						continue
+					}
+					info.checked = true
+					if containsString(resolveForward(ptr), data.IPs[i].Address) {
+						info.confirmed = true
+						break
+					}
+				}
+			}
+			data.IPs[i].PTR = info.names
+			data.IPs[i].PTRMismatch = info.checked && !info.confirmed
+		}
+		results[name] = data
+	}
+
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Address != mismatches[j].Address {
+			a, _ := netip.ParseAddr(mismatches[i].Address)
+			b, _ := netip.ParseAddr(mismatches[j].Address)
+			return a.Less(b)
+		}
+		return mismatches[i].Name < mismatches[j].Name
+	})
+	exclusions = make([]Exclusion, 0, len(excluded))
+	for name, reason := range excluded {
+		exclusions = append(exclusions, Exclusion{Name: name, Reason: reason})
+	}
+	return mismatches, exclusions, capped
+}
+
+// sweepTargets lists the in-scope addresses of prefixes, stopping at limit.
+// capped reports that addresses were left out.
+func (f *Finder) sweepTargets(prefixes []netip.Prefix, limit int) (addrs []string, capped bool) {
+	for _, prefix := range prefixes {
+		for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+			if ok, _ := f.scope.CheckAddr(addr.String()); !ok {
+				continue
+			}
+			if len(addrs) == limit {
+				return addrs, true
+			}
+			addrs = append(addrs, addr.String())
+		}
+	}
+	return addrs, false
+}
@@ -0,0 +1,92 @@
+package subdomain
+
+import (
+	"context"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+func TestSweepTargets(t *testing.T) {
+	scope := &Scope{DenyCIDRs: []string{"192.0.2.1"}}
+	if err := scope.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFinder(WithScope(scope))
+	prefixes := []netip.Prefix{netip.MustParsePrefix("192.0.2.0/30"), netip.MustParsePrefix("192.0.2.8/31")}
+
+	tests := []struct {
+		limit      int
+		want       []string
+		wantCapped bool
+	}{
+		{10, []string{"192.0.2.0", "192.0.2.2", "192.0.2.3", "192.0.2.8", "192.0.2.9"}, false},
+		{5, []string{"192.0.2.0", "192.0.2.2", "192.0.2.3", "192.0.2.8", "192.0.2.9"}, false},
+		{3, []string{"192.0.2.0", "192.0.2.2", "192.0.2.3"}, true},
+	}
+	for _, tt := range tests {
+		got, capped := f.sweepTargets(prefixes, tt.limit)
+		if !reflect.DeepEqual(got, tt.want) || capped != tt.wantCapped {
+			t.Errorf("sweepTargets(limit %d) = %v, %v; want %v, %v", tt.limit, got, capped, tt.want, tt.wantCapped)
+		}
+	}
+}
+
+func TestSweepNeighbours(t *testing.T) {
+	zone := &dnsZone{
+		a: map[string][]string{
+			"www.example.com":    {"192.0.2.1"},
+			"mail.example.com":   {"192.0.2.2"},
+			"old.example.com":    {"192.0.2.9"},
+			"shop.example.com":   {"192.0.2.5"},
+			"server1.hoster.net": {"198.51.100.7"},
+		},
+		ptr: map[string][]string{
+			"192.0.2.1": {"server1.hoster.net"},
+			"192.0.2.2": {"mail.example.com"},
+			"192.0.2.3": {"old.example.com"},
+			"192.0.2.5": {"shop.example.com"},
+		},
+	}
+	f := NewFinder(
+		WithResolver(dnsStandIn(t, zone)),
+		WithPTRSweepPrefix(29),
+		WithPTRRate(1000),
+		WithIPOwnerLookup(false),
+	)
+	results := map[string]Subdomain{
+		"www.example.com":  {Name: "www.example.com", IPs: []IPRecord{{Address: "192.0.2.1"}}},
+		"shop.example.com": {Name: "shop.example.com", IPs: []IPRecord{{Address: "192.0.2.5"}}},
+	}
+
+	mismatches, exclusions, capped := f.sweepNeighbours(context.Background(), "example.com", results)
+	if capped || len(exclusions) != 0 {
+		t.Errorf("capped = %v, exclusions = %v; want neither", capped, exclusions)
+	}
+	wantMismatches := []PTRRecord{{Address: "192.0.2.3", Name: "old.example.com", Forward: []string{"192.0.2.9"}}}
+	if !reflect.DeepEqual(mismatches, wantMismatches) {
+		t.Errorf("mismatches = %+v, want %+v", mismatches, wantMismatches)
+	}
+
+	type ptrState struct {
+		ptr      []string
+		mismatch bool
+		swept    bool
+	}
+	want := map[string]ptrState{
+		// The provider's name points elsewhere.
+		"www.example.com":  {[]string{"server1.hoster.net"}, true, false},
+		"shop.example.com": {[]string{"shop.example.com"}, false, true},
+		"mail.example.com": {[]string{"mail.example.com"}, false, true},
+	}
+	got := make(map[string]ptrState)
+	for name, data := range results {
+		if len(data.IPs) != 1 {
+			t.Fatalf("%s: IPs = %+v, want one", name, data.IPs)
+		}
+		got[name] = ptrState{data.IPs[0].PTR, data.IPs[0].PTRMismatch, containsString(data.Sources, SourcePTRSweep)}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("results = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,273 @@
+// Retries, backoff and circuit breaking for upstream HTTP sources.
+
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAttempts    = 3
+	defaultRetryBaseDelay   = time.Second
+	defaultRetryMaxDelay    = 30 * time.Second
+	defaultBreakerThreshold = 3
+	defaultBreakerCooldown  = 5 * time.Minute
+)
+
+// ErrCircuitOpen is returned without contacting a source whose recent
+// requests kept failing.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// RetryPolicy controls how failed upstream requests are retried. Requests
+// are retried on network errors, 429 and 5xx responses.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry. Each retry doubles
+	// it, and the actual wait is picked uniformly from [0, delay].
+	BaseDelay time.Duration
+	// MaxDelay caps both the backoff and any Retry-After the server sends.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used when no policy is configured.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: defaultRetryAttempts,
+	BaseDelay:   defaultRetryBaseDelay,
+	MaxDelay:    defaultRetryMaxDelay,
+}
+
+// WithRetryPolicy overrides how upstream source requests are retried.
+func WithRetryPolicy(policy RetryPolicy) FinderOption {
+	return func(f *Finder) {
+		if policy.MaxAttempts > 0 {
+			f.retryPolicy = policy
+		}
+	}
+}
+
+// WithCircuitBreaker makes a source short-circuit for cooldown after
+// threshold consecutive failed requests. The state is kept on the Finder so
+// it carries across scans.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) FinderOption {
+	return func(f *Finder) {
+		if threshold > 0 && cooldown > 0 {
+			f.breaker = newCircuitBreaker(threshold, cooldown)
+		}
+	}
+}
+
+// retryableStatusError is an HTTP response worth retrying.
+type retryableStatusError struct {
+	code       int
+	status     string
+	retryAfter time.Duration
+}
+
+func (e *retryableStatusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.status)
+}
+
+// doWithRetry sends req built by newReq, retrying according to
+// f.retryPolicy and consulting the circuit breaker for source.
+func (f *Finder) doWithRetry(ctx context.Context, source string, newReq func() (*http.Request, error)) (*http.Response, error) {
+	r := retrier{client: f.httpClient, policy: f.retryPolicy, breaker: f.breaker, debug: f.debug}
+	return r.do(ctx, source, newReq)
+}
+
+// retrier is the retry loop behind doWithRetry, usable without a Finder
+// by the IP owner providers. A nil breaker allows every request.
+type retrier struct {
+	client  *http.Client
+	policy  RetryPolicy
+	breaker *circuitBreaker
+	debug   bool
+}
+
+func (r retrier) do(ctx context.Context, source string, newReq func() (*http.Request, error)) (*http.Response, error) {
+	if !r.breaker.allow(source) {
+		return nil, fmt.Errorf("%s: %w", source, ErrCircuitOpen)
+	}
+
+	policy := r.policy
+	var lastErr error
+	for attempt := 0; attempt < policy.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay := policy.backoff(attempt, lastErr)
+			if r.debug {
+				log.Printf("[DEBUG] Retrying %s in %s (attempt %d/%d): %v", source, delay, attempt+1, policy.MaxAttempts, lastErr)
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := r.client.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = redactURLError(err)
+			continue
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+			lastErr = &retryableStatusError{
+				code:       resp.StatusCode,
+				status:     resp.Status,
+				retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+			}
+			resp.Body.Close()
+			continue
+		}
+
+		r.breaker.record(source, true)
+		return resp, nil
+	}
+
+	r.breaker.record(source, false)
+	return nil, lastErr
+}
+
+// redactURLError cuts the URL in a transport error down to its scheme and
+// host. Some APIs take their key in the path or query, and the error ends up
+// in debug logs and in the scan result.
+func redactURLError(err error) error {
+	urlErr, ok := err.(*neturl.Error)
+	if !ok {
+		return err
+	}
+	redacted := *urlErr
+	redacted.URL = ""
+	if u, perr := neturl.Parse(urlErr.URL); perr == nil {
+		redacted.URL = u.Scheme + "://" + u.Host
+	}
+	return &redacted
+}
+
+// statusError is a non-2xx response that was not retried.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status: %s", e.status)
+}
+
+// responseStatus returns the HTTP status code behind err, or 0.
+func responseStatus(err error) int {
+	var retryable *retryableStatusError
+	if errors.As(err, &retryable) {
+		return retryable.code
+	}
+	var plain *statusError
+	if errors.As(err, &plain) {
+		return plain.code
+	}
+	return 0
+}
+
+// backoff returns the wait before the given retry. A Retry-After from the
+// previous response takes precedence over the exponential schedule.
+func (p RetryPolicy) backoff(attempt int, lastErr error) time.Duration {
+	var statusErr *retryableStatusError
+	if errors.As(lastErr, &statusErr) && statusErr.retryAfter > 0 {
+		return min(statusErr.retryAfter, p.MaxDelay)
+	}
+	delay := p.BaseDelay << (attempt - 1)
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return rand.N(delay + 1)
+}
+
+// parseRetryAfter accepts both delay-seconds and HTTP-date values.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// circuitBreaker tracks consecutive failures per source. A nil breaker
+// allows everything.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  map[string]int
+	openUntil map[string]time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		failures:  make(map[string]int),
+		openUntil: make(map[string]time.Time),
+	}
+}
+
+// allow reports whether source may be contacted. Once the cooldown has
+// passed a single trial request is let through; its outcome decides
+// whether the breaker closes or opens again.
+func (b *circuitBreaker) allow(source string) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, open := b.openUntil[source]
+	if !open {
+		return true
+	}
+	if time.Now().Before(until) {
+		return false
+	}
+	b.openUntil[source] = time.Now().Add(b.cooldown)
+	return true
+}
+
+func (b *circuitBreaker) record(source string, ok bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ok {
+		delete(b.failures, source)
+		delete(b.openUntil, source)
+		return
+	}
+	b.failures[source]++
+	if b.failures[source] >= b.threshold {
+		b.openUntil[source] = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,171 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		// min and max bound the result; an HTTP-date is relative to now.
+		min, max time.Duration
+	}{
+		{name: "empty"},
+		{name: "seconds", value: "5", min: 5 * time.Second, max: 5 * time.Second},
+		{name: "zero", value: "0"},
+		{name: "negative", value: "-3"},
+		{name: "garbage", value: "soon"},
+		{name: "future date", value: time.Now().Add(time.Minute).UTC().Format(http.TimeFormat), min: 50 * time.Second, max: time.Minute},
+		{name: "past date", value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseRetryAfter(tt.value)
+			if got < tt.min || got > tt.max {
+				t.Errorf("parseRetryAfter(%q) = %s, want within [%s, %s]", tt.value, got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 4 * time.Second}
+	tests := []struct {
+		name    string
+		attempt int
+		lastErr error
+		min     time.Duration
+		max     time.Duration
+	}{
+		{name: "first retry", attempt: 1, max: time.Second},
+		{name: "doubles", attempt: 2, max: 2 * time.Second},
+		{name: "capped", attempt: 10, max: 4 * time.Second},
+		{name: "overflow is capped", attempt: 80, max: 4 * time.Second},
+		{name: "retry after", attempt: 1, lastErr: &retryableStatusError{retryAfter: 3 * time.Second}, min: 3 * time.Second, max: 3 * time.Second},
+		{name: "retry after capped", attempt: 1, lastErr: &retryableStatusError{retryAfter: time.Hour}, min: 4 * time.Second, max: 4 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				if got := policy.backoff(tt.attempt, tt.lastErr); got < tt.min || got > tt.max {
+					t.Fatalf("backoff(%d) = %s, want within [%s, %s]", tt.attempt, got, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	const source = "example"
+	tests := []struct {
+		name string
+		// steps is a sequence of recorded outcomes.
+		steps []bool
+		// expire moves any open period into the past before checking.
+		expire bool
+		want   bool
+	}{
+		{name: "fresh", want: true},
+		{name: "below threshold", steps: []bool{false, false}, want: true},
+		{name: "open at threshold", steps: []bool{false, false, false}, want: false},
+		{name: "success resets count", steps: []bool{false, false, true, false, false}, want: true},
+		{name: "trial after cooldown", steps: []bool{false, false, false}, expire: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newCircuitBreaker(3, time.Minute)
+			for _, ok := range tt.steps {
+				b.record(source, ok)
+			}
+			if tt.expire {
+				b.openUntil[source] = time.Now().Add(-time.Second)
+			}
+			if got := b.allow(source); got != tt.want {
+				t.Errorf("allow = %v, want %v", got, tt.want)
+			}
+			if !b.allow("other") {
+				t.Error("an unrelated source was blocked")
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerTrial(t *testing.T) {
+	b := newCircuitBreaker(1, time.Minute)
+	b.record("example", false)
+	b.openUntil["example"] = time.Now().Add(-time.Second)
+
+	if !b.allow("example") {
+		t.Fatal("no trial request after the cooldown")
+	}
+	if b.allow("example") {
+		t.Error("a second request was let through during the trial")
+	}
+	b.record("example", true)
+	if !b.allow("example") {
+		t.Error("breaker stayed open after a successful trial")
+	}
+
+	var nilBreaker *circuitBreaker
+	nilBreaker.record("example", false)
+	if !nilBreaker.allow("example") {
+		t.Error("nil breaker blocked a request")
+	}
+}
+
+func TestDoWithRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// statuses are served in order; the last one repeats.
+		statuses  []int
+		wantCalls int32
+		wantCode  int
+		wantOpen  bool
+	}{
+		{name: "success", statuses: []int{200}, wantCalls: 1},
+		{name: "recovers", statuses: []int{503, 429, 200}, wantCalls: 3},
+		{name: "not retried", statuses: []int{404}, wantCalls: 1},
+		{name: "gives up", statuses: []int{500}, wantCalls: 3, wantCode: 500, wantOpen: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(calls.Add(1))
+				w.WriteHeader(tt.statuses[min(n, len(tt.statuses))-1])
+			}))
+			defer srv.Close()
+
+			f := NewFinder(
+				WithRetryPolicy(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}),
+				WithCircuitBreaker(1, time.Minute),
+			)
+			resp, err := f.doWithRetry(context.Background(), "stand-in", func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			})
+			if resp != nil {
+				resp.Body.Close()
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server saw %d requests, want %d", got, tt.wantCalls)
+			}
+			if got := responseStatus(err); got != tt.wantCode {
+				t.Errorf("error status = %d (%v), want %d", got, err, tt.wantCode)
+			}
+
+			_, err = f.doWithRetry(context.Background(), "stand-in", func() (*http.Request, error) {
+				return http.NewRequest(http.MethodGet, srv.URL, nil)
+			})
+			if open := errors.Is(err, ErrCircuitOpen); open != tt.wantOpen {
+				t.Errorf("breaker open = %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
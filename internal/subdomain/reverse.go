@@ -0,0 +1,339 @@
+// Reverse discovery of hostnames from IP ranges and autonomous systems.
+
+package subdomain
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SourcePTR marks names found in reverse DNS records.
+const SourcePTR = "ptr"
+
+const (
+	// MaxRangeAddresses caps how many addresses one range scan sweeps,
+	// a /16 worth.
+	MaxRangeAddresses = 1 << 16
+	defaultPTRRate    = 100
+	ptrWorkers        = 20
+)
+
+var (
+	ErrRangeTooLarge = errors.New("address range too large")
+	ErrNoASNDatabase = errors.New("expanding an ASN needs a local ASN database")
+)
+
+// WithPTRRate caps the number of reverse lookups per second made by range
+// scans and PTR sweeps.
+func WithPTRRate(perSecond int) FinderOption {
+	return func(f *Finder) {
+		if perSecond > 0 {
+			f.ptrRate = perSecond
+		}
+	}
+}
+
+// RangeOptions selects the networks swept by ScanRanges.
+type RangeOptions struct {
+	// CIDRs are networks or single addresses.
+	CIDRs []string
+	// ASNs are expanded to the IPv4 networks they announce in the local
+	// ASN database.
+	ASNs []uint32
+	// Domains, if set, keeps only hostnames under these domains. The
+	// configured scope applies either way.
+	Domains []string
+	// Override allows the TLS handshakes and other active steps when an
+	// authorization registry is configured, since ownership of a range
+	// cannot be verified.
+	Override *AuthOverride
+	// MaxAddresses lowers the MaxRangeAddresses limit for this scan.
+	MaxAddresses int
+}
+
+// RangeScanResult is what a range scan found. Subdomains went through the
+// same resolution, scope checks and scoring as in Scan.
+type RangeScanResult struct {
+	Prefixes []string `json:"prefixes"`
+	// Addresses is how many addresses were swept; OutOfScope is how many
+	// more the scope ruled out.
+	Addresses  int                  `json:"addresses"`
+	OutOfScope int                  `json:"out_of_scope,omitempty"`
+	Subdomains map[string]Subdomain `json:"subdomains"`
+	Excluded   []Exclusion          `json:"excluded,omitempty"`
+	// ActiveSkipped explains why no TLS handshakes were made.
+	ActiveSkipped string `json:"active_skipped,omitempty"`
+	Partial       bool   `json:"partial"`
+}
+
+// ParseASN accepts an AS number with or without the "AS" prefix.
+func ParseASN(value string) (uint32, error) {
+	value = strings.TrimSpace(value)
+	if len(value) > 2 && strings.EqualFold(value[:2], "AS") {
+		value = value[2:]
+	}
+	n, err := strconv.ParseUint(value, 10, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid ASN %q", value)
+	}
+	return uint32(n), nil
+}
+
+// ScanRanges sweeps every address of the given networks with PTR lookups
+// and TLS handshakes on port 443, and runs the in-scope hostnames found
+// that way through the normal pipeline.
+func (f *Finder) ScanRanges(ctx context.Context, opts RangeOptions) (*RangeScanResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	prefixes, err := f.rangePrefixes(opts)
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]string, 0, len(opts.Domains))
+	for _, domain := range opts.Domains {
+		d, err := normalizeDomain(domain)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+
+	out := &RangeScanResult{Subdomains: make(map[string]Subdomain)}
+	var addrs []string
+	for _, prefix := range prefixes {
+		out.Prefixes = append(out.Prefixes, prefix.String())
+		for addr := prefix.Addr(); addr.IsValid() && prefix.Contains(addr); addr = addr.Next() {
+			if ok, _ := f.scope.CheckAddr(addr.String()); !ok {
+				out.OutOfScope++
+				continue
+			}
+			addrs = append(addrs, addr.String())
+		}
+	}
+	out.Addresses = len(addrs)
+
+	active, activeSkipped := f.rangeActiveAllowed(strings.Join(out.Prefixes, ","), opts.Override)
+	out.ActiveSkipped = activeSkipped
+	if !active && f.debug {
+		log.Printf("[DEBUG] Skipping TLS handshakes for range scan: %s", activeSkipped)
+	}
+
+	excluded := make(map[string]string)
+	for _, hit := range f.sweepAddrs(ctx, addrs, active) {
+		var cert *Certificate
+		if hit.cert != nil {
+			c := liveCertificate(hit.cert)
+			cert = &c
+		}
+		for _, raw := range hit.names {
+			name := normalizeName(raw)
+			// Single-label PTR names such as "localhost" have no apex.
+			if name == "" || f.apexOf(name) == "" {
+				continue
+			}
+			if _, ok := excluded[name]; ok {
+				continue
+			}
+			if ok, reason := rangeDomainAllowed(name, domains); !ok {
+				excluded[name] = reason
+				continue
+			}
+			if ok, reason := f.scope.CheckHost(name); !ok {
+				excluded[name] = reason
+				continue
+			}
+			addSubdomain(out.Subdomains, name, hit.source, hit.seen, cert)
+		}
+	}
+
+	f.enrichResults(ctx, out.Subdomains)
+	for _, e := range f.excludeOutOfScopeAddrs(out.Subdomains) {
+		excluded[e.Name] = e.Reason
+	}
+	f.finishResults(ctx, out.Subdomains, active)
+
+	for name, reason := range excluded {
+		out.Excluded = append(out.Excluded, Exclusion{Name: name, Reason: reason})
+	}
+	sort.Slice(out.Excluded, func(i, j int) bool {
+		return out.Excluded[i].Name < out.Excluded[j].Name
+	})
+	out.Partial = ctx.Err() != nil
+	return out, nil
+}
+
+// rangePrefixes parses and expands the requested networks, dropping any
+// covered by another, and enforces the address limit.
+func (f *Finder) rangePrefixes(opts RangeOptions) ([]netip.Prefix, error) {
+	limit := MaxRangeAddresses
+	if opts.MaxAddresses > 0 && opts.MaxAddresses < limit {
+		limit = opts.MaxAddresses
+	}
+	var prefixes []netip.Prefix
+	for _, value := range opts.CIDRs {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		var prefix netip.Prefix
+		addr, err := netip.ParseAddr(value)
+		if err == nil {
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		} else if prefix, err = netip.ParsePrefix(value); err != nil {
+			return nil, fmt.Errorf("invalid network %q", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	if len(opts.ASNs) > 0 {
+		expander, ok := f.asnDB.(ASNExpander)
+		if !ok {
+			return nil, ErrNoASNDatabase
+		}
+		for _, asn := range opts.ASNs {
+			found := 0
+			// IPv6 allocations are far too large to sweep.
+			for _, prefix := range expander.Prefixes(asn) {
+				if prefix.Addr().Is4() {
+					prefixes = append(prefixes, prefix)
+					found++
+				}
+			}
+			if found == 0 {
+				return nil, fmt.Errorf("AS%d announces no IPv4 networks in the ASN database", asn)
+			}
+			if f.debug {
+				log.Printf("[DEBUG] AS%d expanded to %d networks", asn, found)
+			}
+		}
+	}
+	if len(prefixes) == 0 {
+		return nil, errors.New("no networks to scan")
+	}
+
+	sort.Slice(prefixes, func(i, j int) bool {
+		if prefixes[i].Addr() != prefixes[j].Addr() {
+			return prefixes[i].Addr().Less(prefixes[j].Addr())
+		}
+		return prefixes[i].Bits() < prefixes[j].Bits()
+	})
+	kept := prefixes[:0]
+	total := 0
+	for _, prefix := range prefixes {
+		if n := len(kept); n > 0 && kept[n-1].Contains(prefix.Addr()) {
+			continue
+		}
+		hostBits := prefix.Addr().BitLen() - prefix.Bits()
+		if hostBits > 16 || 1<<hostBits > limit {
+			return nil, fmt.Errorf("%w: %s; the limit is %d addresses", ErrRangeTooLarge, prefix, limit)
+		}
+		if total += 1 << hostBits; total > limit {
+			return nil, fmt.Errorf("%w: more than %d addresses", ErrRangeTooLarge, limit)
+		}
+		kept = append(kept, prefix)
+	}
+	return kept, nil
+}
+
+// rangeDomainAllowed keeps names under one of domains; an empty list keeps
+// everything.
+func rangeDomainAllowed(name string, domains []string) (bool, string) {
+	if len(domains) == 0 {
+		return true, ""
+	}
+	for _, domain := range domains {
+		if isSubdomainOf(name, domain) {
+			return true, ""
+		}
+	}
+	return false, "not under a requested domain"
+}
+
+// rangeActiveAllowed reports whether a range scan may make TLS handshakes.
+// Ownership of a range cannot be verified, so with a registry configured
+// only an audited override allows them, whatever domains filter is given.
+func (f *Finder) rangeActiveAllowed(target string, override *AuthOverride) (bool, string) {
+	if f.authz == nil {
+		return true, ""
+	}
+	if override == nil {
+		return false, "ownership of an address range cannot be verified; an override is required"
+	}
+	if err := f.authz.RecordOverride(target, override.Actor, override.Reason); err != nil {
+		return false, fmt.Sprintf("%v; override could not be audited: %v", ErrNotAuthorized, err)
+	}
+	return true, ""
+}
+
+// rangeHit is what one address revealed through one source.
+type rangeHit struct {
+	addr   string
+	source string
+	names  []string
+	cert   *x509.Certificate
+	seen   time.Time
+}
+
+// sweepAddrs looks up the PTR names of every address, at most ptrRate per
+// second, and when active also collects the names on the certificate
+// served on port 443.
+func (f *Finder) sweepAddrs(ctx context.Context, addrs []string, active bool) []rangeHit {
+	interval := time.Second / time.Duration(f.ptrRate)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	sem := make(chan struct{}, ptrWorkers)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		hits []rangeHit
+	)
+
+sweep:
+	for _, ip := range addrs {
+		select {
+		case <-ctx.Done():
+			break sweep
+		case <-ticker.C:
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if !f.acquireWorker(ctx) {
+				return
+			}
+			defer f.releaseWorker()
+			var found []rangeHit
+			if names, err := f.resolver.LookupAddr(ctx, ip); err == nil && len(names) > 0 {
+				if f.debug {
+					log.Printf("[DEBUG] PTR %s -> %v", ip, names)
+				}
+				found = append(found, rangeHit{addr: ip, source: SourcePTR, names: names, seen: time.Now().UTC()})
+			}
+			if active {
+				if cert, err := f.fetchLeafCertificate(ctx, ip, ""); err == nil && cert != nil && len(cert.DNSNames) > 0 {
+					if f.debug {
+						log.Printf("[DEBUG] TLS certificate on %s lists %d names", ip, len(cert.DNSNames))
+					}
+					found = append(found, rangeHit{addr: ip, source: SourceTLS, names: cert.DNSNames, cert: cert, seen: time.Now().UTC()})
+				}
+			}
+			mu.Lock()
+			hits = append(hits, found...)
+			mu.Unlock()
+		}(ip)
+	}
+	wg.Wait()
+	return hits
+}
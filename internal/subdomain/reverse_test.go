@@ -0,0 +1,110 @@
+package subdomain
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRangePrefixes(t *testing.T) {
+	withDB := NewFinder(WithASNDatabase(testASNDatabase(t, 24, 4)))
+	tests := []struct {
+		name    string
+		f       *Finder
+		opts    RangeOptions
+		want    []string
+		wantErr error
+	}{
+		{name: "single address", opts: RangeOptions{CIDRs: []string{" 192.0.2.7 "}}, want: []string{"192.0.2.7/32"}},
+		{name: "masked and sorted", opts: RangeOptions{CIDRs: []string{"198.51.100.9/30", "192.0.2.1/24"}}, want: []string{"192.0.2.0/24", "198.51.100.8/30"}},
+		{name: "covered networks dropped", opts: RangeOptions{CIDRs: []string{"192.0.2.128/25", "192.0.2.0/24", "192.0.2.5"}}, want: []string{"192.0.2.0/24"}},
+		{name: "asn", f: withDB, opts: RangeOptions{ASNs: []uint32{64497}}, want: []string{"198.51.100.0/25", "198.51.100.128/25"}},
+		{name: "too large", opts: RangeOptions{CIDRs: []string{"10.0.0.0/8"}}, wantErr: ErrRangeTooLarge},
+		{name: "lowered limit", opts: RangeOptions{CIDRs: []string{"192.0.2.0/24"}, MaxAddresses: 100}, wantErr: ErrRangeTooLarge},
+		{name: "total over limit", opts: RangeOptions{CIDRs: []string{"192.0.2.0/25", "198.51.100.0/25"}, MaxAddresses: 200}, wantErr: ErrRangeTooLarge},
+		{name: "asn without database", opts: RangeOptions{ASNs: []uint32{64497}}, wantErr: ErrNoASNDatabase},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := tt.f
+			if f == nil {
+				f = NewFinder()
+			}
+			prefixes, err := f.rangePrefixes(tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("rangePrefixes = %v, %v; want %v", prefixes, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rangePrefixes: %v", err)
+			}
+			var got []string
+			for _, prefix := range prefixes {
+				got = append(got, prefix.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rangePrefixes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, opts := range []RangeOptions{{}, {CIDRs: []string{"not-a-network"}}, {ASNs: []uint32{64999}}} {
+		if _, err := withDB.rangePrefixes(opts); err == nil {
+			t.Errorf("rangePrefixes(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestScanRanges(t *testing.T) {
+	zone := &dnsZone{
+		a: map[string][]string{"www.example.com": {"192.0.2.1"}},
+		ptr: map[string][]string{
+			"192.0.2.1": {"www.example.com"},
+			"192.0.2.2": {"host.example.net"},
+			"192.0.2.3": {"localhost"},
+		},
+	}
+	// Without an override the registry rules out the TLS handshakes, so
+	// only the stub resolver is consulted.
+	dir := t.TempDir()
+	registry, err := NewAuthRegistry(filepath.Join(dir, "auth.json"), filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFinder(
+		WithResolver(dnsStandIn(t, zone)),
+		WithAuthorization(registry),
+		WithPTRRate(1000),
+		WithIPOwnerLookup(false),
+	)
+
+	result, err := f.ScanRanges(context.Background(), RangeOptions{CIDRs: []string{"192.0.2.0/30"}, Domains: []string{"Example.com"}})
+	if err != nil {
+		t.Fatalf("ScanRanges: %v", err)
+	}
+	if result.Addresses != 4 || !reflect.DeepEqual(result.Prefixes, []string{"192.0.2.0/30"}) {
+		t.Errorf("swept %d addresses in %v, want 4 in 192.0.2.0/30", result.Addresses, result.Prefixes)
+	}
+	if result.ActiveSkipped == "" {
+		t.Error("ActiveSkipped is empty without an override")
+	}
+	if result.Partial {
+		t.Error("Partial set on a complete scan")
+	}
+
+	www, ok := result.Subdomains["www.example.com"]
+	if len(result.Subdomains) != 1 || !ok {
+		t.Fatalf("Subdomains = %v, want only www.example.com", result.Subdomains)
+	}
+	if !reflect.DeepEqual(www.Addresses(), []string{"192.0.2.1"}) || !containsString(www.Sources, SourcePTR) {
+		t.Errorf("www.example.com = %v from %v, want 192.0.2.1 from ptr", www.Addresses(), www.Sources)
+	}
+	wantExcluded := []Exclusion{{Name: "host.example.net", Reason: "not under a requested domain"}}
+	if !reflect.DeepEqual(result.Excluded, wantExcluded) {
+		t.Errorf("Excluded = %+v, want %+v", result.Excluded, wantExcluded)
+	}
+}
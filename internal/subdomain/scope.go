@@ -0,0 +1,360 @@
+// Scope rules that keep active steps on authorized hosts and networks.
+
+package subdomain
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	neturl "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Scope decides which hosts and addresses a scan may touch. Names come
+// from passive sources regardless; a name or address outside the scope is
+// never resolved, probed or scanned and is reported as an Exclusion.
+//
+// A name is in scope when it is not listed in OutOfScope, matches no
+// Exclude glob or ExcludeRegex, and matches an Include glob or
+// IncludeRegex (or both include lists are empty). An address is in scope
+// when it is in no DenyCIDRs range and, if AllowCIDRs is set, in one of
+// those ranges.
+type Scope struct {
+	// Include and Exclude are globs such as "*.example.com"; "*" also
+	// matches dots, so it covers any depth.
+	Include      []string `json:"include,omitempty" yaml:"include,omitempty"`
+	Exclude      []string `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	IncludeRegex []string `json:"include_regex,omitempty" yaml:"include_regex,omitempty"`
+	ExcludeRegex []string `json:"exclude_regex,omitempty" yaml:"exclude_regex,omitempty"`
+	// AllowCIDRs and DenyCIDRs accept prefixes or single addresses.
+	AllowCIDRs []string `json:"allow_cidrs,omitempty" yaml:"allow_cidrs,omitempty"`
+	DenyCIDRs  []string `json:"deny_cidrs,omitempty" yaml:"deny_cidrs,omitempty"`
+	// OutOfScope lists exact hosts that must not be touched.
+	OutOfScope []string `json:"out_of_scope,omitempty" yaml:"out_of_scope,omitempty"`
+
+	includeRe  []*regexp.Regexp
+	excludeRe  []*regexp.Regexp
+	allowNets  []netip.Prefix
+	denyNets   []netip.Prefix
+	outOfScope map[string]bool
+}
+
+// burpScope is the part of a Burp Suite project options export that holds
+// the target scope. Advanced-mode rules carry a host regex, simple ones a
+// URL prefix.
+type burpScope struct {
+	Target *struct {
+		Scope *struct {
+			Include []burpEntry `json:"include"`
+			Exclude []burpEntry `json:"exclude"`
+		} `json:"scope"`
+	} `json:"target"`
+}
+
+type burpEntry struct {
+	Enabled bool   `json:"enabled"`
+	Host    string `json:"host"`
+	File    string `json:"file"`
+	Prefix  string `json:"prefix"`
+}
+
+// LoadScope reads a scope from a JSON or YAML file in the Scope layout, or
+// from a Burp Suite scope export.
+func LoadScope(path string) (*Scope, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	scope := &Scope{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, scope)
+	default:
+		var burp burpScope
+		if json.Unmarshal(data, &burp) == nil && burp.Target != nil && burp.Target.Scope != nil {
+			scope, err = scopeFromBurp(burp)
+		} else {
+			err = json.Unmarshal(data, scope)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse scope: %w", err)
+	}
+	if err := scope.Compile(); err != nil {
+		return nil, err
+	}
+	return scope, nil
+}
+
+// scopeFromBurp converts host rules; Burp rules that only cover some paths
+// of a host do not exclude the host itself and are ignored.
+func scopeFromBurp(burp burpScope) (*Scope, error) {
+	scope := &Scope{}
+	rules := burp.Target.Scope
+	convert := func(entry burpEntry, exclude bool) error {
+		if !entry.Enabled {
+			return nil
+		}
+		if entry.Prefix != "" {
+			u, err := neturl.Parse(entry.Prefix)
+			if err != nil || u.Hostname() == "" {
+				return fmt.Errorf("burp prefix %q: not a URL", entry.Prefix)
+			}
+			if exclude && strings.Trim(u.Path, "/") != "" {
+				return nil
+			}
+			entry.Host = "^" + regexp.QuoteMeta(u.Hostname()) + "$"
+		} else if exclude && entry.File != "" && entry.File != "^/.*" && entry.File != ".*" {
+			return nil
+		}
+		if entry.Host == "" {
+			return nil
+		}
+		// Burp matches IP rules against the request host only, so an
+		// included IP does not limit where names may resolve; an excluded
+		// one is kept off limits entirely.
+		if addr, ok := burpAddress(entry.Host); ok {
+			if exclude {
+				scope.DenyCIDRs = append(scope.DenyCIDRs, addr)
+			}
+			return nil
+		}
+		if exclude {
+			scope.ExcludeRegex = append(scope.ExcludeRegex, entry.Host)
+		} else {
+			scope.IncludeRegex = append(scope.IncludeRegex, entry.Host)
+		}
+		return nil
+	}
+	for _, entry := range rules.Include {
+		if err := convert(entry, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range rules.Exclude {
+		if err := convert(entry, true); err != nil {
+			return nil, err
+		}
+	}
+	return scope, nil
+}
+
+// burpAddress recognizes host rules that are just an escaped IP address.
+func burpAddress(host string) (string, bool) {
+	literal := strings.TrimSuffix(strings.TrimPrefix(host, "^"), "$")
+	literal = strings.ReplaceAll(literal, `\.`, ".")
+	if addr, err := netip.ParseAddr(literal); err == nil {
+		return addr.String(), true
+	}
+	return "", false
+}
+
+// Compile validates the rules and prepares them for matching. LoadScope
+// calls it; scopes built in code must call it before use.
+func (s *Scope) Compile() error {
+	s.includeRe, s.excludeRe = nil, nil
+	s.allowNets, s.denyNets = nil, nil
+	s.outOfScope = make(map[string]bool)
+
+	for i, pattern := range s.Include {
+		glob, err := scopeGlob(pattern)
+		if err != nil {
+			return err
+		}
+		s.Include[i] = glob
+	}
+	for i, pattern := range s.Exclude {
+		glob, err := scopeGlob(pattern)
+		if err != nil {
+			return err
+		}
+		s.Exclude[i] = glob
+	}
+	for _, pattern := range s.IncludeRegex {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return fmt.Errorf("scope regex %q: %w", pattern, err)
+		}
+		s.includeRe = append(s.includeRe, re)
+	}
+	for _, pattern := range s.ExcludeRegex {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return fmt.Errorf("scope regex %q: %w", pattern, err)
+		}
+		s.excludeRe = append(s.excludeRe, re)
+	}
+	for _, cidr := range s.AllowCIDRs {
+		prefix, err := parseScopePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		s.allowNets = append(s.allowNets, prefix)
+	}
+	for _, cidr := range s.DenyCIDRs {
+		prefix, err := parseScopePrefix(cidr)
+		if err != nil {
+			return err
+		}
+		s.denyNets = append(s.denyNets, prefix)
+	}
+	for _, host := range s.OutOfScope {
+		if addr, err := netip.ParseAddr(strings.TrimSpace(host)); err == nil {
+			s.denyNets = append(s.denyNets, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		if name := normalizeName(host); name != "" {
+			s.outOfScope[name] = true
+		}
+	}
+	return nil
+}
+
+// scopeGlob normalizes a glob the way names are normalized and checks its
+// syntax.
+func scopeGlob(pattern string) (string, error) {
+	glob := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(pattern)), ".")
+	if ascii, err := toASCII(glob); err == nil {
+		glob = ascii
+	}
+	if _, err := path.Match(glob, ""); err != nil {
+		return "", fmt.Errorf("scope glob %q: %w", pattern, err)
+	}
+	return glob, nil
+}
+
+func parseScopePrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("scope range %q: %w", value, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("scope range %q: %w", value, err)
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// CheckHost reports whether name is in scope and, if not, why. A nil scope
+// allows everything.
+func (s *Scope) CheckHost(name string) (bool, string) {
+	if s == nil {
+		return true, ""
+	}
+	if s.outOfScope[name] {
+		return false, "listed as out of scope"
+	}
+	for _, glob := range s.Exclude {
+		if ok, _ := path.Match(glob, name); ok {
+			return false, "matches exclude pattern " + glob
+		}
+	}
+	for i, re := range s.excludeRe {
+		if re.MatchString(name) {
+			return false, "matches exclude regex " + s.ExcludeRegex[i]
+		}
+	}
+	if len(s.Include) == 0 && len(s.includeRe) == 0 {
+		return true, ""
+	}
+	for _, glob := range s.Include {
+		if ok, _ := path.Match(glob, name); ok {
+			return true, ""
+		}
+	}
+	for _, re := range s.includeRe {
+		if re.MatchString(name) {
+			return true, ""
+		}
+	}
+	return false, "matches no include pattern"
+}
+
+// CheckAddr reports whether ip is in scope and, if not, why.
+func (s *Scope) CheckAddr(ip string) (bool, string) {
+	if s == nil {
+		return true, ""
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false, "not an IP address"
+	}
+	addr = addr.Unmap()
+	for _, prefix := range s.denyNets {
+		if prefix.Contains(addr) {
+			return false, "in denied range " + prefix.String()
+		}
+	}
+	if len(s.allowNets) == 0 {
+		return true, ""
+	}
+	for _, prefix := range s.allowNets {
+		if prefix.Contains(addr) {
+			return true, ""
+		}
+	}
+	return false, "outside the allowed ranges"
+}
+
+// WithScope restricts active steps to the hosts and addresses scope allows.
+func WithScope(scope *Scope) FinderOption {
+	return func(f *Finder) {
+		f.scope = scope
+	}
+}
+
+// excludeOutOfScopeHosts removes names the scope rejects before anything
+// resolves them.
+func (f *Finder) excludeOutOfScopeHosts(results map[string]Subdomain) []Exclusion {
+	if f.scope == nil {
+		return nil
+	}
+	var excluded []Exclusion
+	for name := range results {
+		if ok, reason := f.scope.CheckHost(name); !ok {
+			excluded = append(excluded, Exclusion{Name: name, Reason: reason})
+			delete(results, name)
+		}
+	}
+	return excluded
+}
+
+// excludeOutOfScopeAddrs removes resolved names that point at an address
+// outside the scope. The whole name goes, since probing it by name could
+// reach that address.
+func (f *Finder) excludeOutOfScopeAddrs(results map[string]Subdomain) []Exclusion {
+	if f.scope == nil {
+		return nil
+	}
+	var excluded []Exclusion
+	for name, data := range results {
+		if ok, reason := f.addrsInScope(data); !ok {
+			excluded = append(excluded, Exclusion{Name: name, Reason: reason})
+			delete(results, name)
+		}
+	}
+	return excluded
+}
+
+// addrsInScope checks every address data resolved to.
+func (f *Finder) addrsInScope(data Subdomain) (bool, string) {
+	if f.scope == nil {
+		return true, ""
+	}
+	for _, ip := range data.Addresses() {
+		if ok, reason := f.scope.CheckAddr(ip); !ok {
+			return false, "resolves to " + ip + ", " + reason
+		}
+	}
+	return true, ""
+}
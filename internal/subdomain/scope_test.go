@@ -0,0 +1,156 @@
+package subdomain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScopeCheckHost(t *testing.T) {
+	scope := &Scope{
+		Include:      []string{"*.Example.com.", "example.com"},
+		Exclude:      []string{"*.corp.example.com"},
+		IncludeRegex: []string{`^api-\d+\.example\.net$`},
+		ExcludeRegex: []string{`^vpn\.`},
+		OutOfScope:   []string{"Legacy.Example.com", "192.0.2.10"},
+	}
+	if err := scope.Compile(); err != nil {
+		t.Fatalf("Compile: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		host string
+		want bool
+	}{
+		{"apex", "example.com", true},
+		{"include glob", "www.example.com", true},
+		{"glob covers any depth", "a.b.example.com", true},
+		{"include regex", "api-12.example.net", true},
+		{"regex is case-insensitive", "API-3.EXAMPLE.NET", true},
+		{"no include match", "www.example.org", false},
+		{"exclude glob", "mail.corp.example.com", false},
+		{"exclude regex", "vpn.example.com", false},
+		{"out of scope list", "legacy.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := scope.CheckHost(tt.host)
+			if got != tt.want {
+				t.Errorf("CheckHost(%q) = %v (%s), want %v", tt.host, got, reason, tt.want)
+			}
+			if !got && reason == "" {
+				t.Errorf("CheckHost(%q) gave no reason", tt.host)
+			}
+		})
+	}
+}
+
+func TestScopeCheckAddr(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope *Scope
+		ip    string
+		want  bool
+	}{
+		{"nil scope", nil, "203.0.113.1", true},
+		{"no ranges", &Scope{}, "203.0.113.1", true},
+		{"inside allowed", &Scope{AllowCIDRs: []string{"203.0.113.0/24"}}, "203.0.113.7", true},
+		{"outside allowed", &Scope{AllowCIDRs: []string{"203.0.113.0/24"}}, "198.51.100.7", false},
+		{"mapped IPv4", &Scope{AllowCIDRs: []string{"203.0.113.0/24"}}, "::ffff:203.0.113.7", true},
+		{"deny beats allow", &Scope{AllowCIDRs: []string{"203.0.113.0/24"}, DenyCIDRs: []string{"203.0.113.128/25"}}, "203.0.113.200", false},
+		{"single denied address", &Scope{DenyCIDRs: []string{"2001:db8::1"}}, "2001:db8::1", false},
+		{"out of scope address", &Scope{OutOfScope: []string{"192.0.2.10"}}, "192.0.2.10", false},
+		{"not an address", &Scope{}, "example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.scope != nil {
+				if err := tt.scope.Compile(); err != nil {
+					t.Fatalf("Compile: %v", err)
+				}
+			}
+			if got, reason := tt.scope.CheckAddr(tt.ip); got != tt.want {
+				t.Errorf("CheckAddr(%q) = %v (%s), want %v", tt.ip, got, reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeCompileErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope Scope
+	}{
+		{"bad glob", Scope{Include: []string{"[example.com"}}},
+		{"bad regex", Scope{ExcludeRegex: []string{"("}}},
+		{"bad range", Scope{AllowCIDRs: []string{"203.0.113.0/33"}}},
+		{"bad address", Scope{DenyCIDRs: []string{"not-an-ip"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.scope.Compile(); err == nil {
+				t.Error("Compile succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadScopeBurp(t *testing.T) {
+	const export = `{"target":{"scope":{"advanced_mode":true,
+		"include":[{"enabled":true,"host":"^.*\\.example\\.com$","protocol":"any"}],
+		"exclude":[
+			{"enabled":true,"host":"^admin\\.example\\.com$","file":"^/.*"},
+			{"enabled":true,"host":"^shop\\.example\\.com$","file":"^/checkout"},
+			{"enabled":true,"host":"^192\\.0\\.2\\.5$"},
+			{"enabled":false,"host":"^www\\.example\\.com$"}
+		]}}}`
+	path := filepath.Join(t.TempDir(), "burp.json")
+	if err := os.WriteFile(path, []byte(export), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	scope, err := LoadScope(path)
+	if err != nil {
+		t.Fatalf("LoadScope: %v", err)
+	}
+
+	hosts := map[string]bool{
+		"www.example.com":   true,
+		"shop.example.com":  true,
+		"admin.example.com": false,
+		"www.example.org":   false,
+	}
+	for host, want := range hosts {
+		if got, _ := scope.CheckHost(host); got != want {
+			t.Errorf("CheckHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if ok, _ := scope.CheckAddr("192.0.2.5"); ok {
+		t.Error("excluded Burp address is in scope")
+	}
+}
+
+func TestExcludeOutOfScope(t *testing.T) {
+	scope := &Scope{Exclude: []string{"internal.example.com"}, DenyCIDRs: []string{"10.0.0.0/8"}}
+	if err := scope.Compile(); err != nil {
+		t.Fatal(err)
+	}
+	f := NewFinder(WithScope(scope))
+	results := map[string]Subdomain{
+		"www.example.com":      {Name: "www.example.com", IPs: []IPRecord{{Address: "203.0.113.1"}}},
+		"internal.example.com": {Name: "internal.example.com"},
+		"db.example.com":       {Name: "db.example.com", IPs: []IPRecord{{Address: "203.0.113.2"}, {Address: "10.1.2.3"}}},
+	}
+
+	hosts := f.excludeOutOfScopeHosts(results)
+	addrs := f.excludeOutOfScopeAddrs(results)
+	if len(hosts) != 1 || hosts[0].Name != "internal.example.com" {
+		t.Errorf("host exclusions = %+v", hosts)
+	}
+	if len(addrs) != 1 || addrs[0].Name != "db.example.com" {
+		t.Errorf("address exclusions = %+v", addrs)
+	}
+	if _, ok := results["www.example.com"]; !ok || len(results) != 1 {
+		t.Errorf("results = %v, want only www.example.com", results)
+	}
+}
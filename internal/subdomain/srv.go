@@ -0,0 +1,172 @@
+// Service discovery through SRV records under underscore labels.
+
+package subdomain
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SourceSRV reports SRV owner names and in-scope SRV targets.
+const SourceSRV = "srv"
+
+const srvWorkers = 10
+
+// CommonSRVServices are the SRV owner prefixes queried under the scanned
+// domain by default.
+var CommonSRVServices = []string{
+	"_autodiscover._tcp",
+	"_caldav._tcp", "_caldavs._tcp", "_carddav._tcp", "_carddavs._tcp",
+	"_cisco-uds._tcp", "_collab-edge._tls",
+	"_ftp._tcp",
+	"_gc._tcp",
+	"_h323cs._tcp", "_h323ls._udp",
+	"_hkp._tcp",
+	"_http._tcp", "_https._tcp",
+	"_imap._tcp", "_imaps._tcp",
+	"_jabber._tcp",
+	"_kerberos._tcp", "_kerberos._udp", "_kerberos-master._tcp", "_kpasswd._tcp", "_kpasswd._udp",
+	"_ldap._tcp", "_ldap._tcp.dc._msdcs", "_ldaps._tcp",
+	"_matrix._tcp", "_matrix-fed._tcp",
+	"_minecraft._tcp",
+	"_mongodb._tcp",
+	"_ntp._udp",
+	"_pop3._tcp", "_pop3s._tcp",
+	"_puppet._tcp", "_x-puppet._tcp",
+	"_rdp._tcp",
+	"_sip._tcp", "_sip._tls", "_sip._udp", "_sips._tcp", "_sipfederationtls._tcp", "_sipinternaltls._tcp",
+	"_smtp._tcp", "_submission._tcp", "_submissions._tcp",
+	"_ssh._tcp",
+	"_stun._tcp", "_stun._udp", "_turn._tcp", "_turn._udp", "_turns._tcp",
+	"_vlmcs._tcp",
+	"_xmpp-client._tcp", "_xmpp-server._tcp",
+}
+
+// Service is an SRV record published under a subdomain.
+type Service struct {
+	// Name is the service and protocol labels, e.g. "_sip._tcp".
+	Name     string `json:"name"`
+	Target   string `json:"target"`
+	Port     uint16 `json:"port"`
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+}
+
+// WithSRVDiscovery enables SRV lookups for the services in
+// CommonSRVServices, or the list given with WithSRVServices.
+func WithSRVDiscovery(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.discoverSRV = enabled
+	}
+}
+
+// WithSRVServices replaces the SRV owner prefixes that are queried.
+func WithSRVServices(services ...string) FinderOption {
+	return func(f *Finder) {
+		if len(services) > 0 {
+			f.srvServices = uniqueStrings(services)
+		}
+	}
+}
+
+func (f *Finder) srvSources() []discoverySource {
+	if !f.discoverSRV {
+		return nil
+	}
+	return []discoverySource{{SourceSRV, f.collectFromSRV}}
+}
+
+// collectFromSRV looks up each service under domain. Owner names with
+// records are added with their services attached; targets under domain
+// are added as names of their own. When ctx ends first, the records found
+// so far are still added and the context error is returned.
+func (f *Finder) collectFromSRV(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+	found := make(map[string][]Service)
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	sem := make(chan struct{}, srvWorkers)
+lookups:
+	for _, service := range f.srvServices {
+		owner := service + "." + domain
+		if !isValidDomain(owner) {
+			continue
+		}
+		if ok, _ := f.scope.CheckHost(owner); !ok {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			break lookups
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(service, owner string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if !f.acquireWorker(ctx) {
+				return
+			}
+			defer f.releaseWorker()
+			records := f.lookupSRV(ctx, service, owner)
+			if len(records) == 0 {
+				return
+			}
+			mu.Lock()
+			found[owner] = records
+			mu.Unlock()
+		}(service, owner)
+	}
+	wg.Wait()
+
+	now := time.Now().UTC()
+	for owner, services := range found {
+		addSubdomain(results, owner, SourceSRV, now, nil)
+		entry := results[owner]
+		entry.Services = services
+		results[owner] = entry
+		for _, svc := range services {
+			if isSubdomainOf(svc.Target, domain) {
+				addSubdomain(results, svc.Target, SourceSRV, now, nil)
+			}
+		}
+	}
+	return sourceRun{}, ctx.Err()
+}
+
+// lookupSRV returns the records at owner sorted by priority and weight.
+// A lone "." target means the service is explicitly not offered.
+func (f *Finder) lookupSRV(ctx context.Context, service, owner string) []Service {
+	_, records, err := f.resolver.LookupSRV(ctx, "", "", owner)
+	if err != nil {
+		return nil
+	}
+	services := make([]Service, 0, len(records))
+	for _, rec := range records {
+		target := normalizeName(rec.Target)
+		if target == "" {
+			continue
+		}
+		services = append(services, Service{
+			Name:     service,
+			Target:   target,
+			Port:     rec.Port,
+			Priority: rec.Priority,
+			Weight:   rec.Weight,
+		})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		if services[i].Priority != services[j].Priority {
+			return services[i].Priority < services[j].Priority
+		}
+		return services[i].Weight > services[j].Weight
+	})
+	if f.debug && len(services) > 0 {
+		log.Printf("[DEBUG] SRV %s -> %d records", owner, len(services))
+	}
+	return services
+}
@@ -3,8 +3,10 @@
 package subdomain
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
@@ -13,13 +15,24 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/netip"
+	neturl "net/url"
+	"sort"
 	"strings"
 	"time"
 )
 
 const (
-	defaultUserAgent   = "goscouter-subdomain-finder/1.0"
-	defaultMaxBodySize = 25 << 20
+	defaultUserAgent          = "goscouter-subdomain-finder/1.0"
+	defaultMaxBodySize        = 25 << 20
+	defaultMaxCertSpotterPage = 100
+)
+
+// Names of the sources that can report a subdomain.
+const (
+	SourceCrtSh       = "crt.sh"
+	SourceCertSpotter = "certspotter"
+	SourceTLS         = "tls"
 )
 
 var ErrInvalidDomain = errors.New("invalid domain")
@@ -29,8 +42,52 @@ type Finder struct {
 	resolver       *net.Resolver
 	userAgent      string
 	maxBodySize    int64
+	maxCSPages     int
+	retryPolicy    RetryPolicy
+	breaker        *circuitBreaker
 	lookupIPOwners bool
+	ownerProvider  OwnerProvider
+	asnDB          ASNDatabase
+	ipinfoFallback bool
+	inspectTLS     bool
+	tlsTimeout     time.Duration
 	debug          bool
+
+	apiKeys        APIKeys
+	intelEnabled   []string
+	maxIntelPages  int
+	sourceBaseURLs map[string]string
+
+	webArchives       bool
+	maxArchiveResults int
+	maxArchivePages   int
+	ccIndexes         int
+	datasets          *DatasetStore
+	mineDNSRecords    bool
+	discoverSRV       bool
+	srvServices       []string
+	psl               *PublicSuffixList
+	scope             *Scope
+	authz             *AuthRegistry
+	cache             *scanCache
+	workers           chan struct{}
+	whois             *WhoisData
+
+	scanPorts           bool
+	portList            []int
+	portScanConcurrency int
+	portScanRate        int
+	portScanTimeout     time.Duration
+
+	ptrRate      int
+	ptrSweep     bool
+	ptrSweepBits int
+
+	probeHTTP       bool
+	probeTimeout    time.Duration
+	fingerprint     bool
+	fingerprintDB   *FingerprintDB
+	cloudClassifier *CloudClassifier
 }
 
 type FinderOption func(*Finder)
@@ -43,16 +100,55 @@ func NewFinder(opts ...FinderOption) *Finder {
 		resolver:       net.DefaultResolver,
 		userAgent:      defaultUserAgent,
 		maxBodySize:    defaultMaxBodySize,
+		maxCSPages:     defaultMaxCertSpotterPage,
+		maxIntelPages:  defaultMaxIntelPages,
+		retryPolicy:    DefaultRetryPolicy,
+		breaker:        newCircuitBreaker(defaultBreakerThreshold, defaultBreakerCooldown),
 		lookupIPOwners: true,
+		tlsTimeout:     defaultTLSTimeout,
+
+		maxArchiveResults: defaultMaxArchiveResults,
+		maxArchivePages:   defaultMaxArchivePages,
+		ccIndexes:         defaultCommonCrawlIndexes,
+		srvServices:       CommonSRVServices,
+
+		portList:            TopPorts,
+		portScanConcurrency: defaultPortScanConcurrency,
+		portScanRate:        defaultPortScanRate,
+		portScanTimeout:     defaultPortScanTimeout,
+
+		probeTimeout: defaultProbeTimeout,
+		ptrRate:      defaultPTRRate,
+		ptrSweepBits: defaultPTRSweepBits,
 	}
 	for _, opt := range opts {
 		if opt != nil {
 			opt(f)
 		}
 	}
+	if f.ownerProvider == nil {
+		f.ownerProvider = f.defaultOwnerProvider()
+	}
+	if f.psl == nil {
+		f.psl = DefaultPublicSuffixList()
+	}
 	return f
 }
 
+// defaultOwnerProvider prefers the local ASN database when configured and
+// otherwise uses ipinfo.io.
+func (f *Finder) defaultOwnerProvider() OwnerProvider {
+	ipinfo := &IPInfoProvider{Client: f.httpClient, UserAgent: f.userAgent, Retry: f.retryPolicy}
+	if f.asnDB == nil {
+		return ipinfo
+	}
+	chain := OwnerChain{&ASNDatabaseProvider{DB: f.asnDB}}
+	if f.ipinfoFallback {
+		chain = append(chain, ipinfo)
+	}
+	return chain
+}
+
 func WithHTTPClient(client *http.Client) FinderOption {
 	return func(f *Finder) {
 		if client != nil {
@@ -86,12 +182,38 @@ func WithMaxBodySize(maxBytes int64) FinderOption {
 	}
 }
 
+// WithMaxCertSpotterPages caps how many pages of CertSpotter issuances are
+// read per query.
+func WithMaxCertSpotterPages(pages int) FinderOption {
+	return func(f *Finder) {
+		if pages > 0 {
+			f.maxCSPages = pages
+		}
+	}
+}
+
 func WithIPOwnerLookup(enabled bool) FinderOption {
 	return func(f *Finder) {
 		f.lookupIPOwners = enabled
 	}
 }
 
+// WithTLSInspection enables handshakes against discovered hosts so that
+// SANs from live certificates can feed back into the results.
+func WithTLSInspection(enabled bool) FinderOption {
+	return func(f *Finder) {
+		f.inspectTLS = enabled
+	}
+}
+
+func WithTLSTimeout(timeout time.Duration) FinderOption {
+	return func(f *Finder) {
+		if timeout > 0 {
+			f.tlsTimeout = timeout
+		}
+	}
+}
+
 func WithDebug(enabled bool) FinderOption {
 	return func(f *Finder) {
 		f.debug = enabled
@@ -103,117 +225,388 @@ func SubdomainFinder(domain string) (map[string]Subdomain, bool, error) {
 }
 
 type crtShEntry struct {
-	NameValue  string `json:"name_value"`
-	IssuerName string `json:"issuer_name,omitempty"`
-	NotAfter   string `json:"not_after,omitempty"`
+	NameValue      string `json:"name_value"`
+	IssuerName     string `json:"issuer_name,omitempty"`
+	SerialNumber   string `json:"serial_number,omitempty"`
+	NotBefore      string `json:"not_before,omitempty"`
+	NotAfter       string `json:"not_after,omitempty"`
+	EntryTimestamp string `json:"entry_timestamp,omitempty"`
 }
 
 type certSpotterEntry struct {
-	DNSNames []string `json:"dns_names"`
-	Issuer   string   `json:"issuer,omitempty"`
-	NotAfter string   `json:"not_after,omitempty"`
+	ID        string             `json:"id"`
+	DNSNames  []string           `json:"dns_names"`
+	Issuer    *certSpotterIssuer `json:"issuer,omitempty"`
+	NotBefore string             `json:"not_before,omitempty"`
+	NotAfter  string             `json:"not_after,omitempty"`
+	CertDER   []byte             `json:"cert_der,omitempty"`
+}
+
+type certSpotterIssuer struct {
+	Name         string `json:"name"`
+	FriendlyName string `json:"friendly_name"`
 }
 
 func (f *Finder) Find(ctx context.Context, domain string) (map[string]Subdomain, bool, error) {
+	result, err := f.Scan(ctx, domain)
+	if err != nil {
+		return nil, false, err
+	}
+	return result.Subdomains, result.HasWildcard, nil
+}
+
+// ScanOptions adjusts a single scan.
+type ScanOptions struct {
+	// AllowPublicSuffix permits scanning a bare public suffix such as
+	// co.uk or github.io.
+	AllowPublicSuffix bool
+	// Override runs active steps against a domain the authorization
+	// registry has not verified; it is audited.
+	Override *AuthOverride
+}
+
+// Scan runs the full discovery pipeline for domain and returns the
+// subdomains along with anything learned about neighbouring domains.
+func (f *Finder) Scan(ctx context.Context, domain string) (*ScanResult, error) {
+	return f.ScanWith(ctx, domain, ScanOptions{})
+}
+
+// ScanWith is Scan with per-scan options.
+func (f *Finder) ScanWith(ctx context.Context, domain string, opts ScanOptions) (*ScanResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 	normalizedDomain, err := normalizeDomain(domain)
 	if err != nil {
-		return nil, false, err
+		return nil, err
+	}
+	if f.psl.IsPublicSuffix(normalizedDomain) && !opts.AllowPublicSuffix {
+		return nil, fmt.Errorf("%w: %s", ErrPublicSuffix, normalizedDomain)
 	}
 
 	results := make(map[string]Subdomain)
 	var sourceErrs []error
-
-	if err := f.collectFromCrtSh(ctx, normalizedDomain, results); err != nil {
-		sourceErrs = append(sourceErrs, err)
-	}
-	if err := f.collectFromCertSpotter(ctx, normalizedDomain, results); err != nil {
-		sourceErrs = append(sourceErrs, err)
+	var sources []SourceStatus
+	var records []RecordFinding
+
+	for _, c := range f.discoverySources() {
+		start := time.Now()
+		run, err := c.collect(ctx, normalizedDomain, results)
+		status := SourceStatus{
+			Source:     c.name,
+			OK:         err == nil,
+			Items:      countFromSource(results, c.name),
+			Capped:     run.capped,
+			Skipped:    run.skipped != "",
+			SkipReason: run.skipped,
+			Quota:      run.quota,
+			DurationMS: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			sourceErrs = append(sourceErrs, err)
+			status.Error = err.Error()
+		}
+		records = append(records, run.records...)
+		if f.debug {
+			switch {
+			case run.skipped != "":
+				log.Printf("[DEBUG] Skipping %s for %s: %s", c.name, normalizedDomain, run.skipped)
+			case run.capped:
+				log.Printf("[DEBUG] %s results for %s were capped", c.name, normalizedDomain)
+			}
+		}
+		sources = append(sources, status)
 	}
 
+	excluded := f.dropOtherTenants(normalizedDomain, results)
 	if len(results) == 0 && len(sourceErrs) > 0 {
-		return nil, false, errors.Join(sourceErrs...)
+		return nil, errors.Join(sourceErrs...)
 	}
+	excluded = append(excluded, f.excludeOutOfScopeHosts(results)...)
 
 	hasWildcard, _ := f.hasWildcardDNS(ctx, normalizedDomain)
 	f.enrichResults(ctx, results)
+	excluded = append(excluded, f.excludeOutOfScopeAddrs(results)...)
 
-	return results, hasWildcard, nil
+	active, activeSkipped := true, ""
+	if f.inspectTLS || f.scanPorts || f.probeHTTP || f.fingerprint || f.ptrSweep {
+		active, activeSkipped = f.activeAllowed(normalizedDomain, opts.Override)
+		if !active && f.debug {
+			log.Printf("[DEBUG] Skipping active steps for %s: %s", normalizedDomain, activeSkipped)
+		}
+	}
+
+	var mismatches []PTRRecord
+	if f.ptrSweep && active {
+		start := time.Now()
+		var sweepExcluded []Exclusion
+		var capped bool
+		mismatches, sweepExcluded, capped = f.sweepNeighbours(ctx, normalizedDomain, results)
+		excluded = append(excluded, sweepExcluded...)
+		sources = append(sources, SourceStatus{
+			Source:     SourcePTRSweep,
+			OK:         true,
+			Items:      countFromSource(results, SourcePTRSweep),
+			Capped:     capped,
+			DurationMS: time.Since(start).Milliseconds(),
+		})
+	}
+
+	var related []string
+	if f.inspectTLS && active {
+		var tlsExcluded []Exclusion
+		related, tlsExcluded = f.inspectCertificates(ctx, normalizedDomain, results)
+		excluded = append(excluded, tlsExcluded...)
+	}
+	f.finishResults(ctx, results, active)
+	etldPlusOne, _ := f.psl.EffectiveTLDPlusOne(normalizedDomain)
+	sort.Slice(excluded, func(i, j int) bool {
+		return excluded[i].Name < excluded[j].Name
+	})
+
+	return &ScanResult{
+		Domain:         normalizedDomain,
+		UnicodeDomain:  ToUnicode(normalizedDomain),
+		ETLDPlusOne:    etldPlusOne,
+		HasWildcard:    hasWildcard,
+		Subdomains:     results,
+		RelatedDomains: related,
+		Sources:        sources,
+		DNSRecords:     records,
+		Excluded:       excluded,
+		ActiveSkipped:  activeSkipped,
+		PTRMismatches:  mismatches,
+		Partial:        len(sourceErrs) > 0 || ctx.Err() != nil,
+	}, nil
 }
 
-func (f *Finder) collectFromCrtSh(ctx context.Context, domain string, results map[string]Subdomain) error {
-	url := fmt.Sprintf("https://crt.sh/?q=%%25.%s&output=json", domain)
-	var entries []crtShEntry
-	if err := f.fetchJSON(ctx, url, &entries); err != nil {
-		return fmt.Errorf("crt.sh request failed: %w", err)
+// finishResults runs port scanning and HTTP probing when active steps are
+// allowed, then fingerprints, classifies and scores resolved results.
+func (f *Finder) finishResults(ctx context.Context, results map[string]Subdomain, active bool) {
+	if f.scanPorts && active {
+		f.scanOpenPorts(ctx, results)
 	}
-	for _, entry := range entries {
-		for _, name := range strings.Split(entry.NameValue, "\n") {
+
+	var probes map[string]*httpProbe
+	if (f.probeHTTP || f.fingerprint) && active {
+		probes = f.probeHTTPHosts(ctx, results)
+	}
+	if f.fingerprint {
+		f.fingerprintResults(results, probes)
+	}
+	if f.cloudClassifier != nil {
+		f.classifyResults(results, probes)
+	}
+	scoreResults(results, probes)
+	for name, data := range results {
+		data.finalizeCertificates()
+		data.IDN = analyzeIDN(name)
+		data.ETLDPlusOne, _ = f.psl.EffectiveTLDPlusOne(name)
+		results[name] = data
+	}
+}
+
+// discoverySource is a passive source queried at the start of a scan.
+type discoverySource struct {
+	name    string
+	collect func(context.Context, string, map[string]Subdomain) (sourceRun, error)
+}
+
+// sourceRun describes how a source run went apart from the names it added.
+type sourceRun struct {
+	capped  bool
+	skipped string
+	quota   *SourceQuota
+	records []RecordFinding
+}
+
+// discoverySources lists the sources to query, CT logs first.
+func (f *Finder) discoverySources() []discoverySource {
+	sources := []discoverySource{
+		{SourceCrtSh, ctSource(f.collectFromCrtSh)},
+		{SourceCertSpotter, ctSource(f.collectFromCertSpotter)},
+	}
+	sources = append(sources, f.intelSources()...)
+	sources = append(sources, f.dnsRecordSources()...)
+	sources = append(sources, f.srvSources()...)
+	sources = append(sources, f.archiveSources()...)
+	return append(sources, f.importSources()...)
+}
+
+// ctSource adapts a CT collector, which only reports capping.
+func ctSource(collect func(context.Context, string, map[string]Subdomain) (bool, error)) func(context.Context, string, map[string]Subdomain) (sourceRun, error) {
+	return func(ctx context.Context, domain string, results map[string]Subdomain) (sourceRun, error) {
+		capped, err := collect(ctx, domain, results)
+		return sourceRun{capped: capped}, err
+	}
+}
+
+// countFromSource returns how many results source reported.
+func countFromSource(results map[string]Subdomain, source string) int {
+	n := 0
+	for _, data := range results {
+		if containsString(data.Sources, source) {
+			n++
+		}
+	}
+	return n
+}
+
+func (f *Finder) collectFromCrtSh(ctx context.Context, domain string, results map[string]Subdomain) (bool, error) {
+	return f.crtShQuery(ctx, "%."+domain, domain, results)
+}
+
+// crtShQuery runs a crt.sh identity search and adds the names under domain.
+// The response is decoded one entry at a time so that a body larger than
+// maxBodySize still yields the entries read so far; capped reports that.
+func (f *Finder) crtShQuery(ctx context.Context, query, domain string, results map[string]Subdomain) (bool, error) {
+	url := fmt.Sprintf("%s/?q=%s&output=json", f.sourceBaseURL(SourceCrtSh), neturl.QueryEscape(query))
+	capped, err := streamJSONArray(ctx, f, SourceCrtSh, url, func(entry crtShEntry) {
+		names := uniqueStrings(strings.Split(entry.NameValue, "\n"))
+		cert := Certificate{
+			Issuer:     entry.IssuerName,
+			Serial:     entry.SerialNumber,
+			NotBefore:  parseCertTime(entry.NotBefore),
+			NotAfter:   parseCertTime(entry.NotAfter),
+			Source:     SourceCrtSh,
+			SANCount:   len(names),
+			LogEntries: 1,
+		}
+		seen := parseCertTime(entry.EntryTimestamp)
+		if seen.IsZero() {
+			seen = cert.NotBefore
+		}
+		for _, name := range names {
 			name = normalizeName(name)
 			if !isSubdomainOf(name, domain) {
 				continue
 			}
-			addSubdomain(results, name, entry.IssuerName, entry.NotAfter)
+			addSubdomain(results, name, SourceCrtSh, seen, &cert)
 		}
+	})
+	if err != nil {
+		return capped, fmt.Errorf("crt.sh request failed: %w", err)
 	}
-	return nil
+	return capped, nil
+}
+
+func (f *Finder) collectFromCertSpotter(ctx context.Context, domain string, results map[string]Subdomain) (bool, error) {
+	return f.certSpotterQuery(ctx, domain, true, domain, results)
 }
 
-func (f *Finder) collectFromCertSpotter(ctx context.Context, domain string, results map[string]Subdomain) error {
-	url := fmt.Sprintf(
-		"https://api.certspotter.com/v1/issuances?domain=%s&include_subdomains=true&expand=dns_names",
-		domain,
+// certSpotterQuery lists issuances for query and adds the names under domain.
+// It follows the after cursor until an empty page or maxCSPages pages have
+// been read, reporting capped in the latter case.
+func (f *Finder) certSpotterQuery(ctx context.Context, query string, includeSubdomains bool, domain string, results map[string]Subdomain) (bool, error) {
+	baseURL := fmt.Sprintf(
+		"%s/v1/issuances?domain=%s&include_subdomains=%t&expand=dns_names&expand=issuer&expand=cert_der",
+		f.sourceBaseURL(SourceCertSpotter), neturl.QueryEscape(query), includeSubdomains,
 	)
-	var entries []certSpotterEntry
-	if err := f.fetchJSON(ctx, url, &entries); err != nil {
-		return fmt.Errorf("certspotter request failed: %w", err)
-	}
-	for _, entry := range entries {
-		for _, name := range entry.DNSNames {
-			name = normalizeName(name)
-			if !isSubdomainOf(name, domain) {
-				continue
+
+	after := ""
+	for page := 0; page < f.maxCSPages; page++ {
+		url := baseURL
+		if after != "" {
+			url += "&after=" + neturl.QueryEscape(after)
+		}
+		var entries []certSpotterEntry
+		if err := f.fetchJSON(ctx, SourceCertSpotter, url, &entries); err != nil {
+			return false, fmt.Errorf("certspotter request failed: %w", err)
+		}
+		if f.debug {
+			log.Printf("[DEBUG] certspotter page %d for %s: %d issuances", page+1, query, len(entries))
+		}
+
+		for _, entry := range entries {
+			cert := Certificate{
+				NotBefore: parseCertTime(entry.NotBefore),
+				NotAfter:  parseCertTime(entry.NotAfter),
+				Source:    SourceCertSpotter,
+				SANCount:  len(entry.DNSNames),
+			}
+			if entry.Issuer != nil {
+				cert.Issuer = entry.Issuer.Name
 			}
-			addSubdomain(results, name, entry.Issuer, entry.NotAfter)
+			// The DER is the precertificate when the final certificate
+			// was never logged.
+			if parsed, err := x509.ParseCertificate(entry.CertDER); err == nil {
+				cert.Serial = serialHex(parsed.SerialNumber)
+				cert.Precert = precertFlag(parsed)
+			}
+			for _, name := range entry.DNSNames {
+				name = normalizeName(name)
+				if !isSubdomainOf(name, domain) {
+					continue
+				}
+				addSubdomain(results, name, SourceCertSpotter, cert.NotBefore, &cert)
+			}
+		}
+
+		if len(entries) == 0 || entries[len(entries)-1].ID == "" || entries[len(entries)-1].ID == after {
+			return false, nil
 		}
+		after = entries[len(entries)-1].ID
 	}
-	return nil
+	return true, nil
 }
 
 func (f *Finder) enrichResults(ctx context.Context, results map[string]Subdomain) {
-	ownerCache := make(map[string]string)
+	ownerCache := make(map[string]IPOwnerInfo)
 
 	for name := range results {
-		ips, err := f.resolveIPs(ctx, name)
-		if err != nil || len(ips) == 0 {
-			delete(results, name)
+		// Once the context is done nothing more resolves; keep the
+		// remaining names unresolved rather than dropping them.
+		if ctx.Err() != nil {
+			return
+		}
+		data, ok := f.enrichSubdomain(ctx, results[name], ownerCache)
+		if !ok {
+			// SRV owner names have no addresses of their own.
+			if ctx.Err() == nil && len(data.Services) == 0 {
+				delete(results, name)
+			}
 			continue
 		}
+		results[name] = data
+	}
+}
 
-		data := results[name]
-		data.IPs = ips
+// enrichSubdomain resolves data.Name and fills in IP ownership. It reports
+// false when the name does not resolve.
+func (f *Finder) enrichSubdomain(ctx context.Context, data Subdomain, ownerCache map[string]IPOwnerInfo) (Subdomain, bool) {
+	ips, err := f.resolveIPs(ctx, data.Name)
+	if err != nil || len(ips) == 0 {
+		return data, false
+	}
+	data.observe("", time.Now().UTC())
+
+	// A name with an out-of-scope address is dropped later, so its
+	// addresses are not sent to the owner lookup services.
+	lookupOwners := f.lookupIPOwners
+	for _, ip := range ips {
+		if ok, _ := f.scope.CheckAddr(ip); !ok {
+			lookupOwners = false
+			break
+		}
+	}
 
-		if f.lookupIPOwners {
-			owners := make([]string, 0, len(ips))
-			for _, ip := range ips {
-				owner, ok := ownerCache[ip]
-				if !ok {
-					owner, _ = f.getIPOwner(ctx, ip)
-					ownerCache[ip] = owner
-				}
-				if owner != "" {
-					owners = append(owners, owner)
-				}
+	data.IPs = make([]IPRecord, 0, len(ips))
+	for _, ip := range ips {
+		record := IPRecord{Address: ip}
+		if lookupOwners {
+			owner, ok := ownerCache[ip]
+			if !ok {
+				owner, _ = f.getIPOwner(ctx, ip)
+				ownerCache[ip] = owner
 			}
-			if len(owners) > 0 {
-				data.IPOwner = strings.Join(uniqueStrings(owners), ", ")
+			if owner.IP != "" {
+				record.Owner = &owner
 			}
 		}
-
-		results[name] = data
+		data.IPs = append(data.IPs, record)
 	}
+
+	return data, true
 }
 
 func (f *Finder) hasWildcardDNS(ctx context.Context, domain string) (bool, error) {
@@ -222,6 +615,9 @@ func (f *Finder) hasWildcardDNS(ctx context.Context, domain string) (bool, error
 		return false, err
 	}
 	randomSub := fmt.Sprintf("%s.%s", sub, domain)
+	if ok, _ := f.scope.CheckHost(randomSub); !ok {
+		return false, nil
+	}
 
 	if f.debug {
 		log.Printf("[DEBUG] Checking wildcard DNS: %s", randomSub)
@@ -238,11 +634,21 @@ func (f *Finder) hasWildcardDNS(ctx context.Context, domain string) (bool, error
 }
 
 func (f *Finder) resolveIPs(ctx context.Context, domain string) ([]string, error) {
+	if f.cache != nil {
+		if answer, ok := f.cache.host(domain); ok {
+			return answer.ips, answer.err
+		}
+	}
 	if f.debug {
 		log.Printf("[DEBUG] DNS lookup: %s", domain)
 	}
 
 	ips, err := f.resolver.LookupHost(ctx, domain)
+	// Only definite answers are shared; timeouts are retried by the next
+	// scan that needs the name.
+	if f.cache != nil && (err == nil || isDNSNotFound(err)) {
+		f.cache.setHost(domain, hostAnswer{ips: uniqueStrings(ips), err: err})
+	}
 	if err != nil {
 		if f.debug {
 			log.Printf("[DEBUG] DNS lookup failed for %s: %v", domain, err)
@@ -258,72 +664,149 @@ func (f *Finder) resolveIPs(ctx context.Context, domain string) ([]string, error
 	return uniqueIPs, nil
 }
 
-func (f *Finder) fetchJSON(ctx context.Context, url string, out any) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+func (f *Finder) fetchJSON(ctx context.Context, source, url string, out any) error {
+	body, err := f.openURL(ctx, source, url)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("User-Agent", f.userAgent)
+	defer body.Close()
 
-	resp, err := f.httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("unexpected status: %s", resp.Status)
-	}
-
-	body := io.LimitReader(resp.Body, f.maxBodySize)
-	decoder := json.NewDecoder(body)
+	decoder := json.NewDecoder(io.LimitReader(body, f.maxBodySize))
 	if err := decoder.Decode(out); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (f *Finder) fetchText(ctx context.Context, url string) (string, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// openURL issues a GET request for source and returns the body of a 2xx
+// response. Transient failures are retried.
+func (f *Finder) openURL(ctx context.Context, source, url string) (io.ReadCloser, error) {
+	return f.openRequest(ctx, source, http.MethodGet, url, nil, nil)
+}
+
+// openRequest is openURL with a method, extra headers and an optional JSON
+// body, as needed by the keyed intel APIs.
+func (f *Finder) openRequest(ctx context.Context, source, method, url string, header http.Header, body []byte) (io.ReadCloser, error) {
+	resp, err := f.doWithRetry(ctx, source, func() (*http.Request, error) {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("User-Agent", f.userAgent)
+		return req, nil
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, &statusError{code: resp.StatusCode, status: resp.Status}
 	}
-	req.Header.Set("User-Agent", f.userAgent)
+	return resp.Body, nil
+}
 
-	resp, err := f.httpClient.Do(req)
+// streamJSONArray decodes a top-level JSON array from url one element at a
+// time, calling fn for each. Reading stops at f.maxBodySize; elements
+// decoded before that point are kept and capped is reported instead of an
+// error.
+func streamJSONArray[T any](ctx context.Context, f *Finder, source, url string, fn func(T)) (bool, error) {
+	body, err := f.openURL(ctx, source, url)
 	if err != nil {
-		return "", err
+		return false, err
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("unexpected status: %s", resp.Status)
+	defer body.Close()
+
+	limited := &io.LimitedReader{R: body, N: f.maxBodySize}
+	decoder := json.NewDecoder(limited)
+	// A body cut between tokens surfaces as a syntax error at the limit
+	// rather than as an EOF.
+	exhausted := func(err error) bool {
+		if limited.N > 0 {
+			return false
+		}
+		var syntaxErr *json.SyntaxError
+		return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) ||
+			errors.As(err, &syntaxErr) && syntaxErr.Offset >= f.maxBodySize
 	}
 
-	body := io.LimitReader(resp.Body, 2048)
-	data, err := io.ReadAll(body)
+	tok, err := decoder.Token()
 	if err != nil {
-		return "", err
+		if exhausted(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return false, fmt.Errorf("expected JSON array, got %v", tok)
+	}
+
+	for decoder.More() {
+		var elem T
+		if err := decoder.Decode(&elem); err != nil {
+			if exhausted(err) {
+				return true, nil
+			}
+			return false, err
+		}
+		fn(elem)
 	}
-	return strings.TrimSpace(string(data)), nil
+	if _, err := decoder.Token(); err != nil {
+		if exhausted(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
 }
 
-func (f *Finder) getIPOwner(ctx context.Context, ip string) (string, error) {
-	url := fmt.Sprintf("https://ipinfo.io/%s/org", ip)
-	owner, err := f.fetchText(ctx, url)
+func (f *Finder) getIPOwner(ctx context.Context, ip string) (IPOwnerInfo, error) {
+	addr, err := netip.ParseAddr(ip)
 	if err != nil {
-		return "", err
+		return IPOwnerInfo{}, err
+	}
+	if f.cache != nil {
+		if owner, ok := f.cache.owner(addr.String()); ok {
+			return owner, nil
+		}
+	}
+	owner, err := f.ownerProvider.LookupOwner(ctx, addr)
+	if err != nil {
+		if f.debug && !errors.Is(err, ErrOwnerNotFound) {
+			log.Printf("[DEBUG] IP owner lookup failed for %s: %v", ip, err)
+		}
+		return IPOwnerInfo{}, err
+	}
+	owner.IP = addr.String()
+	if f.cache != nil {
+		f.cache.setOwner(owner.IP, owner)
 	}
 	return owner, nil
 }
 
+// normalizeDomain lowercases domain and converts Unicode labels to their
+// punycode A-label form, which is what gets resolved and compared.
 func normalizeDomain(domain string) (string, error) {
-	domain = strings.TrimSpace(strings.ToLower(domain))
-	domain = strings.TrimSuffix(domain, ".")
-	if domain == "" || !isValidDomain(domain) {
-		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, domain)
+	input := strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	domain, err := toASCII(input)
+	domain = strings.ToLower(domain)
+	if err != nil || domain == "" || !isValidDomain(domain) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidDomain, input)
 	}
 	return domain, nil
 }
 
+// normalizeName is normalizeDomain for names reported by sources: wildcard
+// prefixes are stripped and anything unusable becomes "".
 func normalizeName(name string) string {
 	name = strings.TrimSpace(strings.ToLower(name))
 	name = strings.TrimSuffix(name, ".")
@@ -331,7 +814,11 @@ func normalizeName(name string) string {
 	if strings.Contains(name, "*") {
 		return ""
 	}
-	return name
+	ascii, err := toASCII(name)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(ascii)
 }
 
 func isSubdomainOf(name, domain string) bool {
@@ -347,7 +834,9 @@ func isSubdomainOf(name, domain string) bool {
 	return isValidDomain(name)
 }
 
-func addSubdomain(results map[string]Subdomain, name, issuer, expiry string) {
+// addSubdomain records that source reported name at seen, together with the
+// certificate it was listed in, if any.
+func addSubdomain(results map[string]Subdomain, name, source string, seen time.Time, cert *Certificate) {
 	name = normalizeName(name)
 	if name == "" {
 		return
@@ -355,19 +844,11 @@ func addSubdomain(results map[string]Subdomain, name, issuer, expiry string) {
 
 	entry, exists := results[name]
 	if !exists {
-		results[name] = Subdomain{
-			Name:       name,
-			CertIssuer: issuer,
-			CertExpiry: expiry,
-		}
-		return
-	}
-
-	if entry.CertIssuer == "" && issuer != "" {
-		entry.CertIssuer = issuer
+		entry = Subdomain{Name: name}
 	}
-	if entry.CertExpiry == "" && expiry != "" {
-		entry.CertExpiry = expiry
+	entry.observe(source, seen)
+	if cert != nil {
+		entry.addCertificate(*cert)
 	}
 	results[name] = entry
 }
@@ -389,13 +870,16 @@ func uniqueStrings(values []string) []string {
 	return result
 }
 
+// isValidDomain checks name against the DNS label rules. Underscores are
+// accepted in every label but the top-level one, since service and
+// attribute names such as _sip._tcp (RFC 8552) depend on them.
 func isValidDomain(name string) bool {
 	if len(name) == 0 || len(name) > 253 {
 		return false
 	}
 
 	labels := strings.Split(name, ".")
-	for _, label := range labels {
+	for n, label := range labels {
 		if len(label) == 0 || len(label) > 63 {
 			return false
 		}
@@ -407,6 +891,9 @@ func isValidDomain(name string) bool {
 			if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '-' {
 				continue
 			}
+			if ch == '_' && n < len(labels)-1 {
+				continue
+			}
 			return false
 		}
 	}
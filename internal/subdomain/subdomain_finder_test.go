@@ -0,0 +1,76 @@
+package subdomain
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestCrtShQuery(t *testing.T) {
+	entries := []string{
+		`{"name_value":"www.example.com\nexample.com","issuer_name":"C=US, O=Let's Encrypt","not_before":"2024-01-01T00:00:00"}`,
+		`{"name_value":"*.api.example.com\nother.test"}`,
+		`{"name_value":"mail.example.com"}`,
+	}
+	full := "[" + strings.Join(entries, ",") + "]"
+	// cut ends partway through the third entry.
+	cut := int64(len("["+entries[0]+","+entries[1]+",") + 10)
+
+	tests := []struct {
+		name       string
+		body       string
+		maxBody    int64
+		wantNames  []string
+		wantCapped bool
+		wantErr    bool
+	}{
+		{name: "complete", body: full, wantNames: []string{"api.example.com", "example.com", "mail.example.com", "www.example.com"}},
+		{name: "empty array", body: "[]"},
+		{name: "capped mid-entry", body: full, maxBody: cut, wantNames: []string{"api.example.com", "example.com", "www.example.com"}, wantCapped: true},
+		{name: "capped after the bracket", body: full, maxBody: 1, wantCapped: true},
+		{name: "not an array", body: `{"error":"rate limited"}`, wantErr: true},
+		{name: "malformed entry", body: `[{"name_value":"www.example.com"},{"name_value":]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("q") != "%.example.com" || r.URL.Query().Get("output") != "json" {
+					http.Error(w, "unexpected query", http.StatusBadRequest)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			f := NewFinder(WithSourceBaseURL(SourceCrtSh, srv.URL), WithMaxBodySize(tt.maxBody))
+			results := make(map[string]Subdomain)
+			capped, err := f.collectFromCrtSh(context.Background(), "example.com", results)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("collectFromCrtSh succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("collectFromCrtSh: %v", err)
+			}
+			if capped != tt.wantCapped {
+				t.Errorf("capped = %v, want %v", capped, tt.wantCapped)
+			}
+
+			var names []string
+			for name := range results {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, tt.wantNames) {
+				t.Errorf("names = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+// Certificate harvesting from live TLS endpoints of discovered hosts.
+
+package subdomain
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTLSTimeout  = 5 * time.Second
+	defaultTLSPort     = "443"
+	tlsInspectWorkers  = 10
+	maxTLSInspectHosts = 2000
+)
+
+type tlsInspectTarget struct {
+	name string
+	ip   string
+}
+
+type tlsInspectResult struct {
+	target tlsInspectTarget
+	cert   *x509.Certificate
+}
+
+// inspectCertificates connects to every address of every resolved host,
+// collects SANs from the served certificates and merges in-scope names back
+// into results. Names under other apexes are returned as related domains,
+// and new names the scope rejects as exclusions.
+func (f *Finder) inspectCertificates(ctx context.Context, domain string, results map[string]Subdomain) ([]string, []Exclusion) {
+	ownerCache := make(map[string]IPOwnerInfo)
+	inspected := make(map[string]struct{})
+	related := make(map[string]struct{})
+	excluded := make(map[string]string)
+
+	// A scanned subdomain's own parent is not a related domain.
+	scannedApex := f.apexOf(domain)
+	if scannedApex == "" {
+		scannedApex = domain
+	}
+
+	var pending []tlsInspectTarget
+	for name, data := range results {
+		pending = append(pending, tlsTargets(name, data)...)
+	}
+
+	handshakes := 0
+	for len(pending) > 0 && handshakes < maxTLSInspectHosts && ctx.Err() == nil {
+		batch := pending
+		if remaining := maxTLSInspectHosts - handshakes; len(batch) > remaining {
+			if f.debug {
+				log.Printf("[DEBUG] TLS inspection limit reached, skipping %d handshakes", len(batch)-remaining)
+			}
+			batch = batch[:remaining]
+		}
+		pending = nil
+		handshakes += len(batch)
+		for _, target := range batch {
+			inspected[target.name] = struct{}{}
+		}
+
+		for _, res := range f.handshakeAll(ctx, batch) {
+			if res.cert == nil {
+				continue
+			}
+			cert := liveCertificate(res.cert)
+			seen := time.Now().UTC()
+
+			for _, san := range res.cert.DNSNames {
+				name := normalizeName(san)
+				if name == "" {
+					continue
+				}
+				if !isSubdomainOf(name, domain) {
+					if apex := f.apexOf(name); apex != "" && apex != scannedApex {
+						related[apex] = struct{}{}
+					}
+					continue
+				}
+				if f.otherTenant(name, domain) {
+					continue
+				}
+				if _, ok := results[name]; ok {
+					addSubdomain(results, name, SourceTLS, seen, &cert)
+					continue
+				}
+
+				if _, ok := excluded[name]; ok {
+					continue
+				}
+				if ok, reason := f.scope.CheckHost(name); !ok {
+					excluded[name] = reason
+					continue
+				}
+
+				data := Subdomain{Name: name}
+				data.observe(SourceTLS, seen)
+				data.addCertificate(cert)
+				data, ok := f.enrichSubdomain(ctx, data, ownerCache)
+				if !ok {
+					continue
+				}
+				if ok, reason := f.addrsInScope(data); !ok {
+					excluded[name] = reason
+					continue
+				}
+				if f.debug {
+					log.Printf("[DEBUG] TLS SAN discovered %s via %s", name, res.target.name)
+				}
+				results[name] = data
+				if _, seen := inspected[name]; !seen {
+					pending = append(pending, tlsTargets(name, data)...)
+				}
+			}
+		}
+	}
+
+	out := make([]string, 0, len(related))
+	for apex := range related {
+		out = append(out, apex)
+	}
+	sort.Strings(out)
+	exclusions := make([]Exclusion, 0, len(excluded))
+	for name, reason := range excluded {
+		exclusions = append(exclusions, Exclusion{Name: name, Reason: reason})
+	}
+	return out, exclusions
+}
+
+// tlsTargets lists one handshake per distinct address of data, since the
+// addresses behind a name can serve different certificates.
+func tlsTargets(name string, data Subdomain) []tlsInspectTarget {
+	seen := make(map[string]struct{}, len(data.IPs))
+	targets := make([]tlsInspectTarget, 0, len(data.IPs))
+	for _, ip := range data.IPs {
+		if _, ok := seen[ip.Address]; ok {
+			continue
+		}
+		seen[ip.Address] = struct{}{}
+		targets = append(targets, tlsInspectTarget{name: name, ip: ip.Address})
+	}
+	return targets
+}
+
+func (f *Finder) handshakeAll(ctx context.Context, targets []tlsInspectTarget) []tlsInspectResult {
+	out := make([]tlsInspectResult, len(targets))
+	sem := make(chan struct{}, tlsInspectWorkers)
+	var wg sync.WaitGroup
+
+	for i, target := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, target tlsInspectTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			out[i] = tlsInspectResult{target: target}
+			if !f.acquireWorker(ctx) {
+				return
+			}
+			defer f.releaseWorker()
+			cert, err := f.fetchLeafCertificate(ctx, target.ip, target.name)
+			if err != nil && f.debug {
+				log.Printf("[DEBUG] TLS handshake failed for %s (%s): %v", target.name, target.ip, err)
+			}
+			out[i] = tlsInspectResult{target: target, cert: cert}
+		}(i, target)
+	}
+	wg.Wait()
+	return out
+}
+
+// liveCertificate describes a certificate served over TLS.
+func liveCertificate(cert *x509.Certificate) Certificate {
+	return Certificate{
+		Issuer:    cert.Issuer.String(),
+		Serial:    serialHex(cert.SerialNumber),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+		Source:    SourceTLS,
+		Precert:   precertFlag(cert),
+		SANCount:  len(cert.DNSNames),
+	}
+}
+
+// fetchLeafCertificate performs a TLS handshake with ip using serverName
+// for SNI and returns the leaf certificate without verifying it.
+func (f *Finder) fetchLeafCertificate(ctx context.Context, ip, serverName string) (*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, f.tlsTimeout)
+	defer cancel()
+
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: f.tlsTimeout},
+		Config: &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip, defaultTLSPort))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.(*tls.Conn).ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, nil
+	}
+	return certs[0], nil
+}
+
+// apexOf returns the registrable domain of name, or "" for a bare public
+// suffix.
+func (f *Finder) apexOf(name string) string {
+	apex, err := f.psl.EffectiveTLDPlusOne(name)
+	if err != nil || !isValidDomain(apex) {
+		return ""
+	}
+	return apex
+}
@@ -0,0 +1,31 @@
+package subdomain
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTLSTargets(t *testing.T) {
+	tests := []struct {
+		name string
+		ips  []string
+		want []tlsInspectTarget
+	}{
+		{name: "unresolved", want: []tlsInspectTarget{}},
+		{name: "every address", ips: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}, want: []tlsInspectTarget{
+			{"www.example.com", "192.0.2.1"}, {"www.example.com", "192.0.2.2"}, {"www.example.com", "2001:db8::1"},
+		}},
+		{name: "duplicates", ips: []string{"192.0.2.1", "192.0.2.1"}, want: []tlsInspectTarget{{"www.example.com", "192.0.2.1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := Subdomain{Name: "www.example.com"}
+			for _, ip := range tt.ips {
+				data.IPs = append(data.IPs, IPRecord{Address: ip})
+			}
+			if got := tlsTargets(data.Name, data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tlsTargets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+// Local registration data used as reverse-WHOIS hints.
+
+package subdomain
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// WhoisRecord is the registration data kept for one domain.
+type WhoisRecord struct {
+	Domain       string `json:"domain"`
+	Registrant   string `json:"registrant,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Email        string `json:"email,omitempty"`
+}
+
+// WhoisData indexes local registration records by organization and
+// contact email so that other domains of the same registrant can be found.
+type WhoisData struct {
+	byDomain map[string]WhoisRecord
+	byOrg    map[string][]string
+	byEmail  map[string][]string
+}
+
+// whoisColumns maps accepted CSV headers to record fields.
+var whoisColumns = map[string]string{
+	"domain":                  "domain",
+	"domain_name":             "domain",
+	"registrant":              "registrant",
+	"registrant_name":         "registrant",
+	"name":                    "registrant",
+	"organization":            "organization",
+	"organisation":            "organization",
+	"org":                     "organization",
+	"registrant_organization": "organization",
+	"email":                   "email",
+	"registrant_email":        "email",
+}
+
+// redactedWhois marks values that privacy services put in place of the
+// real registrant; they link unrelated domains and are ignored.
+var redactedWhois = []string{
+	"redacted", "privacy", "private", "proxy", "whoisguard", "withheld",
+	"not disclosed", "data protected", "contact privacy", "gdpr",
+}
+
+// LoadWhoisData reads registration records from a CSV file with a header
+// row (domain, organization, email, registrant) or from JSON lines.
+func LoadWhoisData(path string) (*WhoisData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var records []WhoisRecord
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		records, err = parseWhoisJSONLines(bytes.NewReader(data))
+	} else {
+		records, err = parseWhoisCSV(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse WHOIS data: %w", err)
+	}
+	return NewWhoisData(records), nil
+}
+
+func parseWhoisJSONLines(r io.Reader) ([]WhoisRecord, error) {
+	var records []WhoisRecord
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var record WhoisRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func parseWhoisCSV(r io.Reader) ([]WhoisRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(header))
+	hasDomain := false
+	for i, name := range header {
+		fields[i] = whoisColumns[strings.ToLower(strings.TrimSpace(name))]
+		hasDomain = hasDomain || fields[i] == "domain"
+	}
+	if !hasDomain {
+		return nil, errors.New("no domain column")
+	}
+	var records []WhoisRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var record WhoisRecord
+		for i, value := range row {
+			if i >= len(fields) {
+				break
+			}
+			value = strings.TrimSpace(value)
+			switch fields[i] {
+			case "domain":
+				record.Domain = value
+			case "registrant":
+				record.Registrant = value
+			case "organization":
+				record.Organization = value
+			case "email":
+				record.Email = value
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// NewWhoisData indexes records; entries with invalid domains are dropped.
+func NewWhoisData(records []WhoisRecord) *WhoisData {
+	w := &WhoisData{
+		byDomain: make(map[string]WhoisRecord),
+		byOrg:    make(map[string][]string),
+		byEmail:  make(map[string][]string),
+	}
+	for _, record := range records {
+		domain, err := normalizeDomain(record.Domain)
+		if err != nil {
+			continue
+		}
+		record.Domain = domain
+		w.byDomain[domain] = record
+		if org := whoisKey(record.Organization); org != "" {
+			w.byOrg[org] = append(w.byOrg[org], domain)
+		}
+		if email := whoisKey(record.Email); email != "" {
+			w.byEmail[email] = append(w.byEmail[email], domain)
+		}
+	}
+	return w
+}
+
+// Len returns the number of domains with records.
+func (w *WhoisData) Len() int {
+	return len(w.byDomain)
+}
+
+// Lookup returns the record for domain.
+func (w *WhoisData) Lookup(domain string) (WhoisRecord, bool) {
+	record, ok := w.byDomain[domain]
+	return record, ok
+}
+
+// SameOrganization returns other domains registered to domain's
+// organization.
+func (w *WhoisData) SameOrganization(domain string) []string {
+	record, ok := w.byDomain[domain]
+	if !ok {
+		return nil
+	}
+	return w.byOrg[whoisKey(record.Organization)]
+}
+
+// SameEmail returns other domains sharing domain's registrant email.
+func (w *WhoisData) SameEmail(domain string) []string {
+	record, ok := w.byDomain[domain]
+	if !ok {
+		return nil
+	}
+	return w.byEmail[whoisKey(record.Email)]
+}
+
+// whoisKey normalizes a value for matching, returning "" for values that
+// privacy services substitute.
+func whoisKey(value string) string {
+	value = strings.ToLower(strings.Join(strings.Fields(value), " "))
+	for _, marker := range redactedWhois {
+		if strings.Contains(value, marker) {
+			return ""
+		}
+	}
+	return value
+}
+
+// WithWhoisData supplies registration records for related-domain pivoting.
+func WithWhoisData(data *WhoisData) FinderOption {
+	return func(f *Finder) {
+		f.whois = data
+	}
+}